@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,6 +15,11 @@ import (
 	"github.com/zaz600/go-musthave-shortener/internal/app/config"
 	"github.com/zaz600/go-musthave-shortener/internal/controller/httpcontroller"
 	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/geoip"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/ratelimit"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/shortid"
+	"github.com/zaz600/go-musthave-shortener/internal/service/policy"
+	"github.com/zaz600/go-musthave-shortener/internal/service/quota"
 	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
 )
 
@@ -31,20 +37,95 @@ func Run(args []string) (err error) {
 	ctx, cancel := signal.NotifyContext(ctxBg, os.Interrupt, syscall.SIGINT)
 	defer cancel()
 
-	cfg := config.GetConfig(args)
+	cfg, err := config.GetConfig(args)
+	if err != nil {
+		return err
+	}
 	log.Info().Msgf("app cfg: %+v", cfg)
 
-	repo, err := repository.NewRepository(ctx, cfg)
+	quotas, err := quota.Load(quota.Limits{
+		MaxLinks:     cfg.QuotaMaxLinks,
+		MaxBatchSize: cfg.QuotaMaxBatchSize,
+	}, cfg.QuotaOverridesFile)
+	if err != nil {
+		return err
+	}
+
+	idGenerator, err := shortid.New(shortid.Config{
+		Strategy: cfg.IDStrategy,
+		Alphabet: cfg.IDAlphabet,
+		Length:   cfg.IDLength,
+		Salt:     cfg.IDSalt,
+	})
 	if err != nil {
 		return err
 	}
 
-	linksService := shortener.NewService(cfg.BaseURL, shortener.WithRepository(repo))
+	canonicalizer := shortener.NewCanonicalizer(cfg.StripTrackingParams)
+	repo, err := repository.NewRepository(ctx, cfg,
+		repository.WithLinksQuota(quotas),
+		repository.WithIDGenerator(idGenerator),
+		repository.WithCanonicalizer(canonicalizer),
+	)
+	if err != nil {
+		return err
+	}
+	if advancer, ok := idGenerator.(shortid.Advancer); ok {
+		// счетчик не хранится, поэтому после рестарта пропускаем столько значений, сколько ссылок уже сохранено
+		count, err := repo.Count(ctx)
+		if err != nil {
+			return err
+		}
+		advancer.Advance(uint64(count))
+	}
+
+	opts, err := serviceOptions(ctx, cfg, repo)
+	if err != nil {
+		return err
+	}
+	if cfg.GeoIPDatabase != "" {
+		countries, err := geoip.Open(cfg.GeoIPDatabase)
+		if err != nil {
+			return err
+		}
+		defer countries.Close()
+		opts = append(opts, shortener.WithCountryResolver(countries))
+	}
+	rateLimitStore := ratelimit.NewMemoryStore()
+	opts = append(opts,
+		shortener.WithQuotas(quotas),
+		shortener.WithIDGenerator(idGenerator),
+		shortener.WithCanonicalizer(canonicalizer),
+		shortener.WithPasswordAttempts(rateLimitStore, cfg.RateLimitPassword),
+		shortener.WithLinkCache(cfg.LinkCacheTTL, cfg.LinkCacheSize),
+		shortener.WithQRCache(cfg.QRCacheSize),
+		shortener.WithDefaultRedirectCode(cfg.RedirectCode),
+		shortener.WithQueryMerge(shortener.QueryMergeRule(cfg.QueryMerge)),
+	)
+	linksService := shortener.NewService(cfg.BaseURL, opts...)
 	defer func(ctx context.Context, s *shortener.Service) {
 		_ = s.Shutdown(ctx)
 	}(ctx, linksService)
 
-	server := &http.Server{Addr: cfg.ServerAddress, Handler: httpcontroller.New(linksService)}
+	rateLimiter := httpcontroller.NewRateLimiter(rateLimitStore, httpcontroller.RateLimits{
+		Shorten:  cfg.RateLimitShorten,
+		Batch:    cfg.RateLimitBatch,
+		Redirect: cfg.RateLimitRedirect,
+	})
+	controllerOpts := []httpcontroller.Option{
+		httpcontroller.WithRateLimiter(rateLimiter),
+		httpcontroller.WithRedirectMaxAge(cfg.RedirectMaxAge),
+		httpcontroller.WithTrustedProxies(cfg.TrustedProxies),
+	}
+	if cfg.InactivePageFile != "" {
+		inactivePage, err := template.ParseFiles(cfg.InactivePageFile)
+		if err != nil {
+			return err
+		}
+		controllerOpts = append(controllerOpts, httpcontroller.WithInactivePage(inactivePage))
+	}
+	controller := httpcontroller.New(linksService, controllerOpts...)
+	server := &http.Server{Addr: cfg.ServerAddress, Handler: controller}
 
 	go func() {
 		<-ctx.Done()
@@ -63,6 +144,30 @@ func Run(args []string) (err error) {
 	return nil
 }
 
+// serviceOptions собирает настройки сервиса сокращения ссылок из конфигурации приложения
+func serviceOptions(ctx context.Context, cfg *config.ShortenConfig, repo repository.LinksRepository) ([]shortener.Option, error) {
+	opts := []shortener.Option{
+		shortener.WithRepository(repo),
+		shortener.WithURLPolicy(shortener.URLPolicy{
+			AllowedSchemes:       cfg.URLAllowedSchemes,
+			MaxLength:            cfg.URLMaxLength,
+			RequireHost:          cfg.URLRequireHost,
+			DenyPrivateAddresses: cfg.URLDenyPrivate,
+			DenySelfLinks:        cfg.URLDenySelfLinks,
+		}),
+	}
+
+	if cfg.BlocklistFile != "" || cfg.AllowlistFile != "" {
+		destinationPolicy, err := policy.NewEngine(cfg.BlocklistFile, cfg.AllowlistFile)
+		if err != nil {
+			return nil, err
+		}
+		go destinationPolicy.Watch(ctx, cfg.PolicyReloadInterval)
+		opts = append(opts, shortener.WithDestinationPolicy(destinationPolicy, cfg.DisableBlockedLinks))
+	}
+	return opts, nil
+}
+
 func printBuildInfo() {
 	fmt.Println("Build version:", BuildVersion)
 	fmt.Println("Build date:", BuildTime)
@@ -2,11 +2,30 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/ratelimit"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/shortid"
 )
 
 const (
 	defaultBaseURL       = "http://localhost:8080"
 	defaultServerAddress = "localhost:8080"
+	defaultDedupScope    = "global"
+	defaultURLSchemes    = "http,https"
+	defaultURLMaxLength  = 2048
+
+	defaultPolicyReloadInterval = 10 * time.Second
+	defaultRateLimitPassword    = "5/15m"
+	defaultLinkCacheTTL         = time.Minute
+	defaultLinkCacheSize        = 10000
+	defaultQRCacheSize          = 1000
+	defaultRedirectCode         = 307
+	defaultRedirectMaxAge       = 24 * time.Hour
+	defaultQueryMerge           = "link"
 )
 
 // ShortenConfig настройки приложения
@@ -19,6 +38,83 @@ type ShortenConfig struct {
 	FileStoragePath string
 	// DatabaseDSN строка подключения к БД. Поддерживается PG. Параметр опциональный
 	DatabaseDSN string
+	// DedupScope область поиска дубликатов длинных ссылок при сокращении
+	DedupScope DedupScope
+	// StripTrackingParams удалять параметры отслеживания (utm_*, fbclid и т.п.) при поиске дубликатов ссылок
+	StripTrackingParams bool
+	// URLAllowedSchemes схемы, которые разрешено сокращать. Пустой список - любые
+	URLAllowedSchemes []string
+	// URLMaxLength максимальная длина сокращаемой ссылки. 0 - без ограничений
+	URLMaxLength int
+	// URLRequireHost сокращаемая ссылка обязана содержать хост
+	URLRequireHost bool
+	// URLDenyPrivate запрет сокращения ссылок на localhost и приватные IP-адреса
+	URLDenyPrivate bool
+	// URLDenySelfLinks запрет сокращения ссылок на сам сервис (BaseURL)
+	URLDenySelfLinks bool
+	// BlocklistFile путь к файлу со списком запрещенных хостов. Опциональный параметр
+	BlocklistFile string
+	// AllowlistFile путь к файлу со списком разрешенных хостов. Опциональный параметр
+	AllowlistFile string
+	// PolicyReloadInterval как часто проверять изменения файлов списков хостов
+	PolicyReloadInterval time.Duration
+	// DisableBlockedLinks перестать отдавать уже сохраненные ссылки, хост которых попал под запрет
+	DisableBlockedLinks bool
+	// TrustedProxies сети прокси, от которых принимается адрес клиента в X-Forwarded-For и X-Real-IP.
+	// Пустой список - адресом клиента считается адрес соединения
+	TrustedProxies []*net.IPNet
+	// RateLimitShorten ограничение частоты сокращения ссылок на пользователя и IP. Нулевое - без ограничений
+	RateLimitShorten ratelimit.Limit
+	// RateLimitBatch ограничение количества ссылок в пакетных запросах на пользователя и IP
+	RateLimitBatch ratelimit.Limit
+	// RateLimitRedirect ограничение частоты переходов по коротким ссылкам на пользователя и IP
+	RateLimitRedirect ratelimit.Limit
+	// RateLimitPassword ограничение неудачных попыток ввода пароля одной защищенной ссылки
+	RateLimitPassword ratelimit.Limit
+	// QuotaMaxLinks максимальное количество активных ссылок у пользователя. 0 - без ограничений
+	QuotaMaxLinks int
+	// QuotaMaxBatchSize максимальное количество ссылок в одном пакетном запросе. 0 - без ограничений
+	QuotaMaxBatchSize int
+	// QuotaOverridesFile путь к JSON файлу с индивидуальными квотами пользователей. Опциональный параметр
+	QuotaOverridesFile string
+	// IDStrategy способ генерации коротких идентификаторов ссылок: random, sequence, hashids
+	IDStrategy shortid.Strategy
+	// IDLength длина коротких идентификаторов ссылок
+	IDLength int
+	// IDAlphabet символы коротких идентификаторов ссылок
+	IDAlphabet string
+	// IDSalt соль для стратегии hashids
+	IDSalt string
+	// LinkCacheTTL время жизни ссылок в кеше переходов. 0 - кеш выключен
+	LinkCacheTTL time.Duration
+	// LinkCacheSize максимальное количество ссылок в кеше переходов. 0 - кеш выключен
+	LinkCacheSize int
+	// QRCacheSize максимальное количество изображений QR кодов в кеше. 0 - кеш выключен
+	QRCacheSize int
+	// RedirectCode код ответа при переходе по ссылкам, для которых он не задан: 301, 302, 307 или 308
+	RedirectCode int
+	// RedirectMaxAge сколько браузеры и прокси могут хранить постоянные переходы (301, 308)
+	RedirectMaxAge time.Duration
+	// QueryMerge правило объединения параметров адреса назначения и запроса на короткую ссылку: link, request, append
+	QueryMerge string
+	// GeoIPDatabase путь к базе стран по IP-адресам в формате MaxMind DB для правил выбора адреса. Опциональный параметр
+	GeoIPDatabase string
+	// InactivePageFile путь к html шаблону страницы ссылки вне окна работы. Опциональный параметр
+	InactivePageFile string
+}
+
+// redacted чем заменяются секреты при выводе настроек
+const redacted = "***"
+
+// String выводит настройки для лога. Секреты, например соль IDSalt, скрываются
+func (s ShortenConfig) String() string {
+	// у plain нет метода String, поэтому fmt не уходит в рекурсию
+	type plain ShortenConfig
+	p := plain(s)
+	if p.IDSalt != "" {
+		p.IDSalt = redacted
+	}
+	return fmt.Sprintf("%+v", p)
 }
 
 // RepoType тип хранилища для хранения БД сокращенных ссылок
@@ -52,12 +148,172 @@ func (s ShortenConfig) GetRepositoryType() RepoType {
 // GetConfig возвращает конфигурацию приложения, вычитывая в таком порядке
 // аргументы командной строки -> env
 // args - пока не используется
-func GetConfig(args []string) *ShortenConfig {
+func GetConfig(args []string) (*ShortenConfig, error) {
 	cfg := &ShortenConfig{}
+	if err := cfg.DedupScope.Set(getEnvOrDefault("DEDUP_SCOPE", defaultDedupScope)); err != nil {
+		return nil, fmt.Errorf("DEDUP_SCOPE: %w", err)
+	}
+	stripTrackingParams, err := getEnvBoolOrDefault("STRIP_TRACKING_PARAMS", false)
+	if err != nil {
+		return nil, err
+	}
+	urlMaxLength, err := getEnvIntOrDefault("URL_MAX_LENGTH", defaultURLMaxLength)
+	if err != nil {
+		return nil, err
+	}
+	urlRequireHost, err := getEnvBoolOrDefault("URL_REQUIRE_HOST", true)
+	if err != nil {
+		return nil, err
+	}
+	urlDenyPrivate, err := getEnvBoolOrDefault("URL_DENY_PRIVATE", true)
+	if err != nil {
+		return nil, err
+	}
+	urlDenySelfLinks, err := getEnvBoolOrDefault("URL_DENY_SELF_LINKS", true)
+	if err != nil {
+		return nil, err
+	}
+	policyReloadInterval, err := getEnvDurationOrDefault("POLICY_RELOAD_INTERVAL", defaultPolicyReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	disableBlockedLinks, err := getEnvBoolOrDefault("DISABLE_BLOCKED_LINKS", false)
+	if err != nil {
+		return nil, err
+	}
+	quotaMaxLinks, err := getEnvIntOrDefault("QUOTA_MAX_LINKS", 0)
+	if err != nil {
+		return nil, err
+	}
+	quotaMaxBatchSize, err := getEnvIntOrDefault("QUOTA_MAX_BATCH", 0)
+	if err != nil {
+		return nil, err
+	}
+	idLength, err := getEnvIntOrDefault("ID_LENGTH", shortid.DefaultLength)
+	if err != nil {
+		return nil, err
+	}
+	linkCacheTTL, err := getEnvDurationOrDefault("LINK_CACHE_TTL", defaultLinkCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	linkCacheSize, err := getEnvIntOrDefault("LINK_CACHE_SIZE", defaultLinkCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	qrCacheSize, err := getEnvIntOrDefault("QR_CACHE_SIZE", defaultQRCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	redirectCode, err := getEnvIntOrDefault("REDIRECT_CODE", defaultRedirectCode)
+	if err != nil {
+		return nil, err
+	}
+	redirectMaxAge, err := getEnvDurationOrDefault("REDIRECT_MAX_AGE", defaultRedirectMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	var idStrategy, urlSchemes, trustedProxies, rateLimitShorten, rateLimitBatch, rateLimitRedirect, rateLimitPassword string
 	flag.StringVar(&cfg.ServerAddress, "a", getEnvOrDefault("SERVER_ADDRESS", defaultServerAddress), "listen address. env: SERVER_ADDRESS")
 	flag.StringVar(&cfg.BaseURL, "b", getEnvOrDefault("BASE_URL", defaultBaseURL), "base url for short link. env: BASE_URL")
 	flag.StringVar(&cfg.FileStoragePath, "f", getEnvOrDefault("FILE_STORAGE_PATH", ""), "file storage path. env: FILE_STORAGE_PATH")
 	flag.StringVar(&cfg.DatabaseDSN, "d", getEnvOrDefault("DATABASE_DSN", ""), "PG dsn. env: DATABASE_DSN")
+	flag.Var(&cfg.DedupScope, "dedup", "dedup scope for original urls: global, user, none. env: DEDUP_SCOPE")
+	flag.BoolVar(&cfg.StripTrackingParams, "strip-tracking", stripTrackingParams, "ignore tracking params (utm_*, fbclid...) when looking for duplicate urls. env: STRIP_TRACKING_PARAMS")
+	flag.StringVar(&urlSchemes, "url-schemes", getEnvOrDefault("URL_ALLOWED_SCHEMES", defaultURLSchemes), "comma separated url schemes allowed to shorten, empty - any. env: URL_ALLOWED_SCHEMES")
+	flag.IntVar(&cfg.URLMaxLength, "url-max-length", urlMaxLength, "max length of url to shorten, 0 - unlimited. env: URL_MAX_LENGTH")
+	flag.BoolVar(&cfg.URLRequireHost, "url-require-host", urlRequireHost, "url to shorten must contain host. env: URL_REQUIRE_HOST")
+	flag.BoolVar(&cfg.URLDenyPrivate, "url-deny-private", urlDenyPrivate, "deny urls to localhost and private ip addresses. env: URL_DENY_PRIVATE")
+	flag.BoolVar(&cfg.URLDenySelfLinks, "url-deny-self", urlDenySelfLinks, "deny urls to the shortener itself. env: URL_DENY_SELF_LINKS")
+	flag.StringVar(&cfg.BlocklistFile, "blocklist", getEnvOrDefault("BLOCKLIST_FILE", ""), "blocked hosts file path. env: BLOCKLIST_FILE")
+	flag.StringVar(&cfg.AllowlistFile, "allowlist", getEnvOrDefault("ALLOWLIST_FILE", ""), "allowed hosts file path. env: ALLOWLIST_FILE")
+	flag.DurationVar(&cfg.PolicyReloadInterval, "policy-reload", policyReloadInterval, "hosts lists reload check interval. env: POLICY_RELOAD_INTERVAL")
+	flag.BoolVar(&cfg.DisableBlockedLinks, "disable-blocked", disableBlockedLinks, "stop redirecting existing links to blocked hosts. env: DISABLE_BLOCKED_LINKS")
+	flag.StringVar(&trustedProxies, "trusted-proxies", getEnvOrDefault("TRUSTED_PROXIES", ""), "comma separated proxy networks or addresses allowed to pass client ip in X-Forwarded-For/X-Real-IP. env: TRUSTED_PROXIES")
+	flag.StringVar(&rateLimitShorten, "rl-shorten", getEnvOrDefault("RATE_LIMIT_SHORTEN", ""), "shorten rate limit per user and ip as <burst>/<period>, e.g. 60/1m. env: RATE_LIMIT_SHORTEN")
+	flag.StringVar(&rateLimitBatch, "rl-batch", getEnvOrDefault("RATE_LIMIT_BATCH", ""), "batch shorten rate limit in urls per user and ip as <burst>/<period>. env: RATE_LIMIT_BATCH")
+	flag.StringVar(&rateLimitRedirect, "rl-redirect", getEnvOrDefault("RATE_LIMIT_REDIRECT", ""), "redirect rate limit per user and ip as <burst>/<period>. env: RATE_LIMIT_REDIRECT")
+	flag.StringVar(&rateLimitPassword, "rl-password", getEnvOrDefault("RATE_LIMIT_PASSWORD", defaultRateLimitPassword), "wrong password attempts limit per protected link as <burst>/<period>. env: RATE_LIMIT_PASSWORD")
+	flag.IntVar(&cfg.QuotaMaxLinks, "quota-links", quotaMaxLinks, "max active links per user, 0 - unlimited. env: QUOTA_MAX_LINKS")
+	flag.IntVar(&cfg.QuotaMaxBatchSize, "quota-batch", quotaMaxBatchSize, "max urls in one batch request, 0 - unlimited. env: QUOTA_MAX_BATCH")
+	flag.StringVar(&cfg.QuotaOverridesFile, "quota-overrides", getEnvOrDefault("QUOTA_OVERRIDES_FILE", ""), "per user quotas json file path. env: QUOTA_OVERRIDES_FILE")
+	flag.StringVar(&idStrategy, "id-strategy", getEnvOrDefault("ID_STRATEGY", string(shortid.StrategyRandom)), "short id generation strategy: random, sequence, hashids. env: ID_STRATEGY")
+	flag.IntVar(&cfg.IDLength, "id-length", idLength, "short id length. env: ID_LENGTH")
+	flag.StringVar(&cfg.IDAlphabet, "id-alphabet", getEnvOrDefault("ID_ALPHABET", shortid.DefaultAlphabet), "short id alphabet. env: ID_ALPHABET")
+	flag.StringVar(&cfg.IDSalt, "id-salt", getEnvOrDefault("ID_SALT", ""), "salt for hashids short id strategy. env: ID_SALT")
+	flag.DurationVar(&cfg.LinkCacheTTL, "link-cache-ttl", linkCacheTTL, "redirect cache ttl, 0 - disabled. env: LINK_CACHE_TTL")
+	flag.IntVar(&cfg.LinkCacheSize, "link-cache-size", linkCacheSize, "max links in redirect cache, 0 - disabled. env: LINK_CACHE_SIZE")
+	flag.IntVar(&cfg.QRCacheSize, "qr-cache-size", qrCacheSize, "max qr code images in cache, 0 - disabled. env: QR_CACHE_SIZE")
+	flag.IntVar(&cfg.RedirectCode, "redirect-code", redirectCode, "default redirect status code: 301, 302, 307 or 308. env: REDIRECT_CODE")
+	flag.DurationVar(&cfg.RedirectMaxAge, "redirect-max-age", redirectMaxAge, "cache max age for permanent redirects. env: REDIRECT_MAX_AGE")
+	flag.StringVar(&cfg.QueryMerge, "query-merge", getEnvOrDefault("QUERY_MERGE", defaultQueryMerge), "how to merge duplicate query params on passthrough: link, request, append. env: QUERY_MERGE")
+	flag.StringVar(&cfg.GeoIPDatabase, "geoip-db", getEnvOrDefault("GEOIP_DB", ""), "MaxMind DB country database path for targeting rules. env: GEOIP_DB")
+	flag.StringVar(&cfg.InactivePageFile, "inactive-page", getEnvOrDefault("INACTIVE_PAGE_FILE", ""), "html template of the page for links outside their schedule. env: INACTIVE_PAGE_FILE")
 	flag.Parse()
-	return cfg
+	if cfg.IDStrategy, err = shortid.ParseStrategy(idStrategy); err != nil {
+		return nil, fmt.Errorf("ID_STRATEGY: %w", err)
+	}
+	cfg.URLAllowedSchemes = splitList(urlSchemes)
+	if cfg.TrustedProxies, err = parseNetworks(splitList(trustedProxies)); err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	if cfg.RateLimitShorten, err = ratelimit.ParseLimit(rateLimitShorten); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_SHORTEN: %w", err)
+	}
+	if cfg.RateLimitBatch, err = ratelimit.ParseLimit(rateLimitBatch); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_BATCH: %w", err)
+	}
+	if cfg.RateLimitRedirect, err = ratelimit.ParseLimit(rateLimitRedirect); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_REDIRECT: %w", err)
+	}
+	if cfg.RateLimitPassword, err = ratelimit.ParseLimit(rateLimitPassword); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_PASSWORD: %w", err)
+	}
+	switch cfg.QueryMerge {
+	case "link", "request", "append":
+	default:
+		return nil, fmt.Errorf("QUERY_MERGE: unknown rule '%s', expected link, request or append", cfg.QueryMerge)
+	}
+	switch cfg.RedirectCode {
+	case 301, 302, 307, 308:
+	default:
+		return nil, fmt.Errorf("REDIRECT_CODE: unsupported redirect code %d, expected 301, 302, 307 or 308", cfg.RedirectCode)
+	}
+	return cfg, nil
+}
+
+// splitList разбирает список значений, разделенных запятыми
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseNetworks разбирает список сетей в формате CIDR. Отдельный адрес считается сетью из одного адреса
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address '%s'", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
 }
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DedupScope область, в пределах которой одинаковые длинные ссылки считаются дубликатами
+type DedupScope int
+
+const (
+	// DedupGlobal длинная ссылка уникальна среди ссылок всех пользователей
+	DedupGlobal DedupScope = iota
+	// DedupPerUser длинная ссылка уникальна в пределах ссылок одного пользователя
+	DedupPerUser
+	// DedupNone дубликаты не отслеживаются, каждое сокращение создает новую ссылку
+	DedupNone
+)
+
+var dedupScopeNames = map[DedupScope]string{
+	DedupGlobal:  "global",
+	DedupPerUser: "user",
+	DedupNone:    "none",
+}
+
+// ParseDedupScope разбирает строковое представление DedupScope: global, user или none
+func ParseDedupScope(value string) (DedupScope, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for scope, name := range dedupScopeNames {
+		if name == value {
+			return scope, nil
+		}
+	}
+	return DedupGlobal, fmt.Errorf("unknown dedup scope '%s'", value)
+}
+
+func (d DedupScope) String() string {
+	if name, ok := dedupScopeNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("DedupScope(%d)", int(d))
+}
+
+// Set реализует flag.Value
+func (d *DedupScope) Set(value string) error {
+	scope, err := ParseDedupScope(value)
+	if err != nil {
+		return err
+	}
+	*d = scope
+	return nil
+}
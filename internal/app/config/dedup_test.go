@@ -0,0 +1,40 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDedupScope(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    DedupScope
+		wantErr bool
+	}{
+		{value: "global", want: DedupGlobal},
+		{value: "User", want: DedupPerUser},
+		{value: " none ", want: DedupNone},
+		{value: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDedupScope(tt.value)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want, mustParse(t, got.String()))
+		})
+	}
+}
+
+func mustParse(t *testing.T, value string) DedupScope {
+	t.Helper()
+	scope, err := ParseDedupScope(value)
+	require.NoError(t, err)
+	return scope
+}
@@ -1,6 +1,11 @@
 package config
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
 
 // getEnvOrDefault возвращает значение из переменной среды окружения,
 // если такая задана или значение по умолчанию.
@@ -11,3 +16,45 @@ func getEnvOrDefault(key string, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvBoolOrDefault возвращает булево значение из переменной среды окружения,
+// если такая задана или значение по умолчанию.
+func getEnvBoolOrDefault(key string, defaultValue bool) (bool, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return result, nil
+}
+
+// getEnvIntOrDefault возвращает целое число из переменной среды окружения,
+// если такая задана или значение по умолчанию.
+func getEnvIntOrDefault(key string, defaultValue int) (int, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return result, nil
+}
+
+// getEnvDurationOrDefault возвращает длительность из переменной среды окружения,
+// если такая задана или значение по умолчанию.
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%s: %w", key, err)
+	}
+	return result, nil
+}
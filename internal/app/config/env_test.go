@@ -1,10 +1,13 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetEnvOrDefault_Env_Exists(t *testing.T) {
@@ -23,3 +26,25 @@ func TestGetEnvOrDefault_Env_not_Exists(t *testing.T) {
 	actual := getEnvOrDefault(key, defValue)
 	assert.Equal(t, defValue, actual)
 }
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := parseNetworks([]string{"10.0.0.0/8", "192.168.1.10", "::1"})
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+	assert.True(t, networks[0].Contains(net.ParseIP("10.1.2.3")))
+	assert.True(t, networks[1].Contains(net.ParseIP("192.168.1.10")))
+	assert.False(t, networks[1].Contains(net.ParseIP("192.168.1.11")))
+	assert.True(t, networks[2].Contains(net.ParseIP("::1")))
+
+	_, err = parseNetworks([]string{"proxy.local"})
+	assert.Error(t, err)
+}
+
+func TestShortenConfig_String(t *testing.T) {
+	cfg := &ShortenConfig{BaseURL: "http://localhost:8080", IDSalt: "secret-salt"}
+	out := fmt.Sprintf("%+v", cfg)
+	assert.Contains(t, out, "BaseURL:http://localhost:8080")
+	assert.Contains(t, out, "IDSalt:***")
+	assert.NotContains(t, out, "secret-salt")
+	assert.Equal(t, "secret-salt", cfg.IDSalt)
+}
@@ -0,0 +1,89 @@
+package httpcontroller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// bearerPrefix начало значения заголовка Authorization с API ключом
+const bearerPrefix = "Bearer "
+
+// apiKeyContextKey ключ контекста запроса, под которым хранится API ключ запроса
+type apiKeyContextKey struct{}
+
+// RequireScope middleware авторизации по API ключу из заголовка Authorization: Bearer.
+// Запросы без заголовка проходят дальше и авторизуются по cookie. Неизвестный или отозванный ключ
+// получает 401, ключ без области действия scope - 403. Пользователя запроса возвращает requestUID
+func (s ShortenerController) RequireScope(scope entity.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key, err := s.linksService.AuthenticateAPIKey(r.Context(), token)
+			if errors.Is(err, shortener.ErrInvalidAPIKey) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "invalid api key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Warn().Err(err).Msg("")
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !key.HasScope(scope) {
+				http.Error(w, "api key has no scope "+string(scope), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+		})
+	}
+}
+
+// CookieOnly middleware запросов, которые нельзя выполнять по API ключу: управление ключами, передача ссылок
+// и управление участниками пространств. Иначе утекший ключ с узкой областью действия дал бы полный доступ
+// к ссылкам пользователя или сделал бы владельцем пространства другого пользователя
+func CookieOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := bearerToken(r); ok {
+			http.Error(w, "not allowed with api key", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestUID возвращает пользователя запроса: владельца API ключа, если запрос прошел RequireScope с ключом,
+// иначе uid из cookie, как ExtractUID
+func requestUID(r *http.Request) (string, error) {
+	if key, ok := r.Context().Value(apiKeyContextKey{}).(entity.APIKey); ok {
+		return key.UID, nil
+	}
+	return ExtractUID(r.Cookies())
+}
+
+// setRequestUIDCookie сохраняет uid пользователя в cookie, если запрос авторизован не по API ключу.
+// Клиент с ключом не должен получать cookie, дающую больше прав, чем ключ
+func setRequestUIDCookie(w http.ResponseWriter, r *http.Request, uid string) {
+	if _, ok := r.Context().Value(apiKeyContextKey{}).(entity.APIKey); ok {
+		return
+	}
+	SetUIDCookie(w, uid)
+}
+
+// bearerToken извлекает API ключ из заголовка Authorization
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(bearerPrefix):]), true
+}
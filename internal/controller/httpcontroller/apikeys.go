@@ -0,0 +1,109 @@
+package httpcontroller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// CreateAPIKey возвращает http.HandlerFunc для обработки запроса на создание API ключа.
+// Параметры передаются в формате JSON в виде CreateAPIKeyRequest, в ответ возвращается APIKeyResponse.
+// Сам ключ показывается только в этом ответе
+func (s ShortenerController) CreateAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := ExtractUID(r.Cookies())
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request CreateAPIKeyRequest
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+		token, key, err := s.linksService.CreateAPIKey(r.Context(), uid, request.Name, request.Scopes)
+		if err != nil {
+			s.writeAPIKeyError(w, uid, err)
+			return
+		}
+		resp := newAPIKeyResponse(key)
+		resp.Key = token
+		writeJSON(w, http.StatusCreated, resp)
+	}
+}
+
+// GetAPIKeys возвращает http.HandlerFunc для обработки запроса на получение API ключей пользователя,
+// в том числе отозванных. Ответ возвращается в формате JSON в виде списка APIKeyResponse без самих ключей
+func (s ShortenerController) GetAPIKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := ExtractUID(r.Cookies())
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		keys, err := s.linksService.UserAPIKeys(r.Context(), uid)
+		if err != nil {
+			s.writeAPIKeyError(w, uid, err)
+			return
+		}
+		result := make([]APIKeyResponse, 0, len(keys))
+		for _, key := range keys {
+			result = append(result, newAPIKeyResponse(key))
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// RevokeAPIKey возвращает http.HandlerFunc для обработки запроса на отзыв API ключа.
+// Отозванный ключ сразу перестает приниматься, но остается в списке ключей
+func (s ShortenerController) RevokeAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := ExtractUID(r.Cookies())
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err = s.linksService.RevokeAPIKey(r.Context(), uid, chi.URLParam(r, "keyID")); err != nil {
+			s.writeAPIKeyError(w, uid, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeAPIKeyError отвечает на ошибку работы с API ключами
+func (s ShortenerController) writeAPIKeyError(w http.ResponseWriter, uid string, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrInvalidAPIKeySettings):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrAPIKeyNotFound):
+		http.Error(w, "api key not found", http.StatusNotFound)
+	default:
+		log.Warn().Err(err).Str("uid", uid).Msg("")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// newAPIKeyResponse API ключ для ответов API, без самого ключа
+func newAPIKeyResponse(key entity.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
@@ -1,10 +1,58 @@
 package httpcontroller
 
+import (
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
 type (
 	// ShortenRequest запрос на сокращение ссылки
 	ShortenRequest struct {
 		// URL ссылка, которую требуется сократить
 		URL string `json:"url"`
+		LinkSettings
+	}
+
+	// LinkSettings необязательные настройки сокращаемой ссылки
+	LinkSettings struct {
+		// Password пароль для перехода по ссылке
+		Password string `json:"password,omitempty"`
+		// MaxClicks после скольких переходов ссылка перестанет работать
+		MaxClicks int `json:"max_clicks,omitempty"`
+		// Title название ссылки для страницы предпросмотра
+		Title string `json:"title,omitempty"`
+		// Notes заметки владельца о ссылке
+		Notes string `json:"notes,omitempty"`
+		// Tags теги ссылки для поиска
+		Tags []string `json:"tags,omitempty"`
+		// GroupID группа пользователя, в которую добавить ссылку
+		GroupID string `json:"group_id,omitempty"`
+		// WorkspaceID рабочее пространство, в котором создать общую ссылку. Пустой - ссылка личная
+		WorkspaceID string `json:"workspace_id,omitempty"`
+		// Interstitial перед переходом всегда показывать страницу с адресом назначения
+		Interstitial bool `json:"interstitial,omitempty"`
+		// RedirectCode код ответа при переходе: 301, 302, 307 или 308. По умолчанию - из настроек сервиса
+		RedirectCode int `json:"redirect_code,omitempty"`
+		// PassQuery добавлять к адресу назначения параметры запроса на короткую ссылку
+		PassQuery bool `json:"pass_query,omitempty"`
+		// PassPath добавлять к адресу назначения путь после короткой ссылки
+		PassPath bool `json:"pass_path,omitempty"`
+		// QueryMerge правило объединения одноименных параметров: link, request или append
+		QueryMerge string `json:"query_merge,omitempty"`
+		// UTM разметка, которая добавляется к адресу назначения при переходе
+		UTM *entity.UTMParams `json:"utm,omitempty"`
+		// Targeting правила выбора адреса назначения по устройству, языку и стране посетителя
+		Targeting []entity.TargetRule `json:"targeting,omitempty"`
+		// Variants варианты адреса назначения для A/B эксперимента
+		Variants []entity.Variant `json:"variants,omitempty"`
+		// NotBefore с какого момента ссылка работает
+		NotBefore *time.Time `json:"not_before,omitempty"`
+		// NotAfter с какого момента ссылка перестает работать
+		NotAfter *time.Time `json:"not_after,omitempty"`
+		// InactiveURL куда вести посетителей вне окна работы ссылки
+		InactiveURL string `json:"inactive_url,omitempty"`
 	}
 
 	// ShortenResponse ответ на запрос на сокращение ссылки
@@ -13,6 +61,11 @@ type (
 		Result string `json:"result"`
 		// Error ошибка, если возникла, при сокращении ссылки
 		Error string `json:"error,omitempty"`
+		// Reason машиночитаемая причина, по которой ссылка не прошла проверку
+		Reason string `json:"reason,omitempty"`
+		// OwnedByUser заполняется, если ссылка уже была сокращена ранее.
+		// true - ссылку сокращал этот же пользователь, false - другой
+		OwnedByUser *bool `json:"owned_by_user,omitempty"`
 	}
 )
 
@@ -26,6 +79,60 @@ type (
 		ShortURL string `json:"short_url"`
 		// OriginalURL длинная ссылка
 		OriginalURL string `json:"original_url"`
+		// Protected для перехода по ссылке нужен пароль
+		Protected bool `json:"protected,omitempty"`
+		// MaxClicks ограничение количества переходов по ссылке
+		MaxClicks int `json:"max_clicks,omitempty"`
+		// Clicks сколько переходов по ссылке уже было
+		Clicks int `json:"clicks,omitempty"`
+		// Status состояние ссылки: active, removed или expired
+		Status repository.LinkStatus `json:"status"`
+		// Title название ссылки
+		Title string `json:"title,omitempty"`
+		// Notes заметки владельца о ссылке
+		Notes string `json:"notes,omitempty"`
+		// Tags теги ссылки
+		Tags []string `json:"tags,omitempty"`
+		// GroupID группа, в которую входит ссылка
+		GroupID string `json:"group_id,omitempty"`
+		// WorkspaceID рабочее пространство, которому принадлежит ссылка. Пустой - ссылка личная
+		WorkspaceID string `json:"workspace_id,omitempty"`
+		// Interstitial перед переходом показывается страница с адресом назначения
+		Interstitial bool `json:"interstitial,omitempty"`
+		// RedirectCode код ответа при переходе, если он отличается от кода по умолчанию
+		RedirectCode int `json:"redirect_code,omitempty"`
+		// PassQuery к адресу назначения добавляются параметры запроса
+		PassQuery bool `json:"pass_query,omitempty"`
+		// PassPath к адресу назначения добавляется путь после короткой ссылки
+		PassPath bool `json:"pass_path,omitempty"`
+		// QueryMerge правило объединения параметров, если оно отличается от правила по умолчанию
+		QueryMerge string `json:"query_merge,omitempty"`
+		// UTM разметка ссылки отдельно от адреса назначения
+		UTM *entity.UTMParams `json:"utm,omitempty"`
+		// Targeting правила выбора адреса назначения
+		Targeting []entity.TargetRule `json:"targeting,omitempty"`
+		// Variants варианты адреса назначения со статистикой переходов
+		Variants []VariantStats `json:"variants,omitempty"`
+		// NotBefore с какого момента ссылка работает
+		NotBefore *time.Time `json:"not_before,omitempty"`
+		// NotAfter с какого момента ссылка перестает работать
+		NotAfter *time.Time `json:"not_after,omitempty"`
+		// InactiveURL куда ведет ссылка вне окна работы
+		InactiveURL string `json:"inactive_url,omitempty"`
+		// CreatedAt когда ссылка создана. Нет у ссылок, сохраненных до появления времени создания
+		CreatedAt *time.Time `json:"created_at,omitempty"`
+		// UpdatedAt когда владелец последний раз менял ссылку
+		UpdatedAt *time.Time `json:"updated_at,omitempty"`
+		// RemovedAt когда ссылка удалена
+		RemovedAt *time.Time `json:"removed_at,omitempty"`
+	}
+
+	// VariantStats вариант адреса назначения и сколько переходов ему засчитано
+	VariantStats struct {
+		Name   string `json:"name"`
+		URL    string `json:"url"`
+		Weight int    `json:"weight"`
+		Clicks int    `json:"clicks"`
 	}
 )
 
@@ -39,6 +146,7 @@ type (
 		URL string `json:"original_url"`
 		// CorrelationID идентификатор ссылки во внешней системе
 		CorrelationID string `json:"correlation_id"`
+		LinkSettings
 	}
 
 	// ShortenBatchResponse ответ на запрос сокращения пачки ссылок
@@ -51,4 +159,221 @@ type (
 		// ShortURL сокращенная ссылка
 		ShortURL string `json:"short_url"`
 	}
+
+	// ShortenBatchErrorResponse ответ на запрос сокращения пачки ссылок, если одна из ссылок не прошла проверку
+	ShortenBatchErrorResponse struct {
+		// CorrelationID идентификатор ссылки во внешней системе, которая не прошла проверку
+		CorrelationID string `json:"correlation_id"`
+		// Error описание ошибки
+		Error string `json:"error"`
+		// Reason машиночитаемая причина, по которой ссылка не прошла проверку
+		Reason string `json:"reason,omitempty"`
+	}
+)
+
+// QuotaResponse ограничения пользователя и их использование. 0 означает отсутствие ограничения
+type QuotaResponse struct {
+	// MaxLinks максимальное количество активных ссылок
+	MaxLinks int `json:"max_links"`
+	// UsedLinks количество активных ссылок пользователя
+	UsedLinks int `json:"used_links"`
+	// MaxBatchSize максимальное количество ссылок в одном пакетном запросе
+	MaxBatchSize int `json:"max_batch_size"`
+}
+
+type (
+	// UpdateLinkRequest запрос на изменение ссылки. Незаданные поля не меняются
+	UpdateLinkRequest struct {
+		// URL новый адрес ссылки
+		URL *string `json:"url,omitempty"`
+		// Password новый пароль ссылки. Пустая строка снимает пароль
+		Password *string `json:"password,omitempty"`
+		// MaxClicks новое ограничение количества переходов. 0 снимает ограничение
+		MaxClicks *int `json:"max_clicks,omitempty"`
+		// Title новое название ссылки. Пустая строка снимает название
+		Title *string `json:"title,omitempty"`
+		// Notes новые заметки к ссылке. Пустая строка снимает заметки
+		Notes *string `json:"notes,omitempty"`
+		// Tags новые теги ссылки целиком. Пустой список снимает теги
+		Tags *[]string `json:"tags,omitempty"`
+		// GroupID новая группа ссылки. Пустая строка убирает ссылку из группы
+		GroupID *string `json:"group_id,omitempty"`
+		// Interstitial показывать ли перед переходом страницу с адресом назначения
+		Interstitial *bool `json:"interstitial,omitempty"`
+		// RedirectCode новый код ответа при переходе. 0 - код по умолчанию
+		RedirectCode *int `json:"redirect_code,omitempty"`
+		// PassQuery добавлять ли к адресу назначения параметры запроса
+		PassQuery *bool `json:"pass_query,omitempty"`
+		// PassPath добавлять ли к адресу назначения путь после короткой ссылки
+		PassPath *bool `json:"pass_path,omitempty"`
+		// QueryMerge новое правило объединения параметров. Пустая строка - правило по умолчанию
+		QueryMerge *string `json:"query_merge,omitempty"`
+		// UTM новая разметка целиком. Пустой объект снимает разметку
+		UTM *entity.UTMParams `json:"utm,omitempty"`
+		// Targeting новые правила выбора адреса назначения целиком. Пустой список снимает правила
+		Targeting *[]entity.TargetRule `json:"targeting,omitempty"`
+		// Variants новые варианты адреса назначения целиком. Пустой список снимает эксперимент
+		Variants *[]entity.Variant `json:"variants,omitempty"`
+	}
+
+	// LinkRevisionsResponse история адресов ссылки, от старых к новым
+	LinkRevisionsResponse []LinkRevisionsResponseEntry
+
+	// LinkRevisionsResponseEntry прежний адрес ссылки
+	LinkRevisionsResponseEntry struct {
+		// OriginalURL адрес, на который ссылка вела до изменения
+		OriginalURL string `json:"original_url"`
+		// ChangedAt когда адрес был заменен
+		ChangedAt time.Time `json:"changed_at"`
+	}
+
+	// LinkTargeting правила выбора адреса назначения ссылки, проверяются по порядку.
+	// Если ни одно правило не подошло, переход ведет на адрес ссылки
+	LinkTargeting struct {
+		Rules []entity.TargetRule `json:"rules"`
+	}
+
+	// LinkSchedule окно работы ссылки. Пустые границы не ограничивают ссылку
+	LinkSchedule struct {
+		// NotBefore с какого момента ссылка работает
+		NotBefore *time.Time `json:"not_before"`
+		// NotAfter с какого момента ссылка перестает работать
+		NotAfter *time.Time `json:"not_after"`
+		// InactiveURL куда вести посетителей вне окна. Пустой - показать страницу о том, что ссылка не работает
+		InactiveURL string `json:"inactive_url,omitempty"`
+	}
+)
+
+type (
+	// CreateGroupRequest запрос на создание группы ссылок
+	CreateGroupRequest struct {
+		// Name название группы
+		Name string `json:"name"`
+	}
+
+	// GroupResponse группа ссылок пользователя
+	GroupResponse struct {
+		// ID идентификатор группы, по нему ссылки добавляются в группу
+		ID string `json:"id"`
+		// Name название группы
+		Name string `json:"name"`
+		// CreatedAt когда группа создана
+		CreatedAt time.Time `json:"created_at"`
+		// Stats статистика по ссылкам группы. Есть только в ответе на запрос одной группы
+		Stats *GroupStatsResponse `json:"stats,omitempty"`
+	}
+
+	// GroupStatsResponse сводная статистика по ссылкам группы
+	GroupStatsResponse struct {
+		// Links сколько не удаленных ссылок в группе
+		Links int `json:"links"`
+		// Active сколько ссылок группы работают
+		Active int `json:"active"`
+		// Expired сколько ссылок группы истекло
+		Expired int `json:"expired"`
+		// Removed сколько ссылок группы удалено
+		Removed int `json:"removed"`
+		// Clicks сколько переходов по всем ссылкам группы
+		Clicks int `json:"clicks"`
+	}
+
+	// DeleteGroupLinksResponse ответ на запрос удаления ссылок группы
+	DeleteGroupLinksResponse struct {
+		// Removed сколько ссылок поставлено на удаление
+		Removed int `json:"removed"`
+	}
+)
+
+type (
+	// CreateWorkspaceRequest запрос на создание рабочего пространства
+	CreateWorkspaceRequest struct {
+		// Name название пространства
+		Name string `json:"name"`
+	}
+
+	// WorkspaceResponse рабочее пространство
+	WorkspaceResponse struct {
+		// ID идентификатор пространства, по нему в пространстве создаются ссылки
+		ID string `json:"id"`
+		// Name название пространства
+		Name string `json:"name"`
+		// Role роль пользователя в пространстве
+		Role entity.Role `json:"role"`
+		// CreatedAt когда пространство создано
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	// SetWorkspaceMemberRequest запрос на добавление участника пространства или изменение его роли
+	SetWorkspaceMemberRequest struct {
+		// Role роль участника: owner, editor или viewer
+		Role entity.Role `json:"role"`
+	}
+
+	// WorkspaceMemberResponse участник рабочего пространства
+	WorkspaceMemberResponse struct {
+		// UID пользователь
+		UID string `json:"uid"`
+		// Role роль пользователя в пространстве
+		Role entity.Role `json:"role"`
+		// AddedAt когда пользователь получил текущую роль
+		AddedAt time.Time `json:"added_at"`
+	}
+)
+
+type (
+	// CreateTransferRequest запрос на создание токена передачи ссылок
+	CreateTransferRequest struct {
+		// Links идентификаторы передаваемых ссылок. Пустой - все личные ссылки пользователя
+		Links []string `json:"links,omitempty"`
+	}
+
+	// TransferResponse токен передачи ссылок. Токен возвращается только при создании
+	TransferResponse struct {
+		// Token одноразовый токен, который нужно передать получателю ссылок
+		Token string `json:"token"`
+		// Links идентификаторы передаваемых ссылок. Пустой - все личные ссылки
+		Links []string `json:"links,omitempty"`
+		// ExpiresAt до какого момента действует токен
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	// RedeemTransferRequest запрос на получение ссылок по токену передачи
+	RedeemTransferRequest struct {
+		// Token токен передачи
+		Token string `json:"token"`
+	}
+
+	// RedeemTransferResponse ссылки, полученные по токену передачи
+	RedeemTransferResponse struct {
+		// Links короткие ссылки, которые перешли к пользователю
+		Links []string `json:"links"`
+	}
+)
+
+type (
+	// CreateAPIKeyRequest запрос на создание API ключа
+	CreateAPIKeyRequest struct {
+		// Name название ключа
+		Name string `json:"name,omitempty"`
+		// Scopes разрешенные ключу действия: shorten, read, write, delete
+		Scopes []entity.Scope `json:"scopes"`
+	}
+
+	// APIKeyResponse API ключ пользователя
+	APIKeyResponse struct {
+		// ID идентификатор ключа, по нему ключ отзывается
+		ID string `json:"id"`
+		// Key ключ для заголовка Authorization: Bearer. Возвращается только при создании
+		Key string `json:"key,omitempty"`
+		// Name название ключа
+		Name string `json:"name,omitempty"`
+		// Prefix начало ключа
+		Prefix string `json:"prefix"`
+		// Scopes разрешенные ключу действия
+		Scopes []entity.Scope `json:"scopes"`
+		// CreatedAt когда ключ создан
+		CreatedAt time.Time `json:"created_at"`
+		// RevokedAt когда ключ отозван
+		RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	}
 )
@@ -0,0 +1,137 @@
+package httpcontroller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// CreateUserGroup возвращает http.HandlerFunc для обработки запроса на создание группы ссылок.
+// Название передается в формате JSON в виде CreateGroupRequest, в ответ возвращается GroupResponse.
+// Ссылки добавляются в группу по ее идентификатору при сокращении или изменении ссылки
+func (s ShortenerController) CreateUserGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request CreateGroupRequest
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+		group, err := s.linksService.CreateGroup(r.Context(), uid, request.Name)
+		if err != nil {
+			s.writeUserGroupError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, newGroupResponse(group))
+	}
+}
+
+// GetUserGroups возвращает http.HandlerFunc для обработки запроса на получение групп ссылок пользователя.
+// Ответ возвращается в формате JSON в виде списка GroupResponse, от старых групп к новым
+func (s ShortenerController) GetUserGroups() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		groups, err := s.linksService.UserGroups(r.Context(), uid)
+		if err != nil {
+			s.writeUserGroupError(w, uid, err)
+			return
+		}
+		result := make([]GroupResponse, 0, len(groups))
+		for _, group := range groups {
+			result = append(result, newGroupResponse(group))
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// GetUserGroup возвращает http.HandlerFunc для обработки запроса на получение группы ссылок
+// со статистикой. Ответ возвращается в формате JSON в виде GroupResponse. Группу видит только ее владелец.
+// Ссылки группы возвращает GetUserLinks с параметром group
+func (s ShortenerController) GetUserGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		group, stats, err := s.linksService.UserGroup(r.Context(), uid, chi.URLParam(r, "groupID"))
+		if err != nil {
+			s.writeUserGroupError(w, uid, err)
+			return
+		}
+		resp := newGroupResponse(group)
+		resp.Stats = &GroupStatsResponse{
+			Links:   stats.Links,
+			Active:  stats.Active,
+			Expired: stats.Expired,
+			Removed: stats.Removed,
+			Clicks:  stats.Clicks,
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// DeleteUserGroupLinks возвращает http.HandlerFunc для обработки запроса на удаление всех ссылок группы.
+// Удаление происходит асинхронно, как в DeleteUserLinks. Сама группа остается.
+// В ответ возвращается DeleteGroupLinksResponse с количеством ссылок, поставленных на удаление
+func (s ShortenerController) DeleteUserGroupLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		removed, err := s.linksService.RemoveGroupLinks(r.Context(), uid, chi.URLParam(r, "groupID"))
+		if err != nil {
+			s.writeUserGroupError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, DeleteGroupLinksResponse{Removed: removed})
+	}
+}
+
+// writeUserGroupError отвечает на ошибку работы с группой ссылок пользователя
+func (s ShortenerController) writeUserGroupError(w http.ResponseWriter, uid string, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrInvalidGroup):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrGroupNotFound):
+		http.Error(w, "group not found", http.StatusNotFound)
+	case errors.Is(err, shortener.ErrNotGroupOwner):
+		http.Error(w, "group is owned by another user", http.StatusForbidden)
+	default:
+		log.Warn().Err(err).Str("uid", uid).Msg("")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// newGroupResponse группа ссылок для ответов API
+func newGroupResponse(group entity.Group) GroupResponse {
+	return GroupResponse{
+		ID:        group.ID,
+		Name:      group.Name,
+		CreatedAt: group.CreatedAt,
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,18 +19,89 @@ import (
 	"github.com/zaz600/go-musthave-shortener/internal/entity"
 	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
 	"github.com/zaz600/go-musthave-shortener/internal/pkg/random"
+	"github.com/zaz600/go-musthave-shortener/internal/service/quota"
 	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
 )
 
+// linkOwnerHeader заголовок ответа на повторное сокращение ссылки.
+// Содержит self, если существующая ссылка принадлежит пользователю, и other, если нет
+const linkOwnerHeader = "X-Link-Owner"
+
+// invalidURLReasonHeader заголовок ответа 400 с машиночитаемой причиной, по которой ссылка не прошла проверку
+const invalidURLReasonHeader = "X-Invalid-URL-Reason"
+
+// linkMaxClicksHeader заголовок запроса на сокращение ссылки с ограничением количества переходов
+const linkMaxClicksHeader = "X-Link-Max-Clicks"
+
+// nextCursorHeader заголовок ответа со страницей ссылок пользователя. Содержит курсор следующей страницы,
+// отсутствует на последней странице
+const nextCursorHeader = "X-Next-Cursor"
+
+const (
+	// quotaExceededReason причина отказа: у пользователя закончилась квота на ссылки
+	quotaExceededReason = "quota_exceeded"
+	// batchTooLargeReason причина отказа: в пачке больше ссылок, чем разрешено пользователю
+	batchTooLargeReason = "batch_too_large"
+)
+
+// defaultRedirectMaxAge сколько браузеры и прокси могут хранить постоянные переходы по умолчанию
+const defaultRedirectMaxAge = 24 * time.Hour
+
 type ShortenerController struct {
 	*chi.Mux
 	linksService *shortener.Service
+	// rateLimiter ограничение частоты запросов. Опционально
+	rateLimiter *RateLimiter
+	// redirectMaxAge сколько браузеры и прокси могут хранить постоянные переходы (301, 308)
+	redirectMaxAge time.Duration
+	// inactivePage страница для браузеров, которые перешли по ссылке вне окна ее работы
+	inactivePage *template.Template
+	// trustedProxies сети прокси, которым можно доверить адрес клиента в X-Forwarded-For и X-Real-IP
+	trustedProxies []*net.IPNet
 }
 
-func New(linksService *shortener.Service) *ShortenerController {
+// Option настройка контроллера
+type Option func(*ShortenerController)
+
+// WithRateLimiter включает ограничение частоты запросов
+func WithRateLimiter(rateLimiter *RateLimiter) Option {
+	return func(c *ShortenerController) {
+		c.rateLimiter = rateLimiter
+	}
+}
+
+// WithRedirectMaxAge задает, сколько браузеры и прокси могут хранить постоянные переходы (301, 308)
+func WithRedirectMaxAge(maxAge time.Duration) Option {
+	return func(c *ShortenerController) {
+		c.redirectMaxAge = maxAge
+	}
+}
+
+// WithInactivePage задает страницу для браузеров, которые перешли по ссылке вне окна ее работы.
+// Шаблону передаются поля ShortURL, Title, NotBefore, NotAfter и Expired
+func WithInactivePage(page *template.Template) Option {
+	return func(c *ShortenerController) {
+		c.inactivePage = page
+	}
+}
+
+// WithTrustedProxies задает сети прокси, от которых принимается адрес клиента в заголовках X-Forwarded-For и X-Real-IP.
+// Без них адресом клиента считается адрес соединения
+func WithTrustedProxies(proxies []*net.IPNet) Option {
+	return func(c *ShortenerController) {
+		c.trustedProxies = proxies
+	}
+}
+
+func New(linksService *shortener.Service, opts ...Option) *ShortenerController {
 	c := &ShortenerController{
-		Mux:          chi.NewRouter(),
-		linksService: linksService,
+		Mux:            chi.NewRouter(),
+		linksService:   linksService,
+		redirectMaxAge: defaultRedirectMaxAge,
+		inactivePage:   defaultInactivePage,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
 	c.setupHandlers()
 	return c
@@ -36,28 +110,59 @@ func New(linksService *shortener.Service) *ShortenerController {
 // setupHandlers настройка роутинга и middleware
 func (s ShortenerController) setupHandlers() {
 	s.Use(middleware.RequestID)
-	s.Use(middleware.RealIP)
+	s.Use(trustedRealIP(s.trustedProxies))
 	s.Use(middleware.Logger)
 	s.Use(middleware.Recoverer)
 	s.Use(middleware.Timeout(10 * time.Second))
 	s.Use(middleware.Compress(5))
 	s.Use(GzDecompressor)
 
-	s.Get("/{linkID}", s.GetOriginalURL())
-	s.Post("/", s.ShortenURL())
-	s.Post("/api/shorten", s.ShortenJSON())
-	s.Post("/api/shorten/batch", s.ShortenBatch())
-	s.Get("/api/user/urls", s.GetUserLinks())
-	s.Delete("/api/user/urls", s.DeleteUserLinks())
+	s.With(s.rateLimiter.Redirect()).Get("/{linkID}", s.GetOriginalURL())
+	s.With(s.rateLimiter.Redirect()).Post("/{linkID}", s.GetOriginalURL())
+	s.With(s.rateLimiter.Redirect()).Get("/{linkID}/qr", s.GetLinkQRCode())
+	s.With(s.rateLimiter.Redirect()).Get("/{linkID}/*", s.GetOriginalURL())
+	s.With(s.rateLimiter.Redirect()).Post("/{linkID}/*", s.GetOriginalURL())
+	// API ключ проверяется до ограничения частоты, чтобы лимит считался по владельцу ключа
+	shorten, read := s.RequireScope(entity.ScopeShorten), s.RequireScope(entity.ScopeRead)
+	write, remove := s.RequireScope(entity.ScopeWrite), s.RequireScope(entity.ScopeDelete)
+	s.With(shorten, s.rateLimiter.Shorten()).Post("/", s.ShortenURL())
+	s.With(shorten, s.rateLimiter.Shorten()).Post("/api/shorten", s.ShortenJSON())
+	s.With(shorten, s.rateLimiter.Batch()).Post("/api/shorten/batch", s.ShortenBatch())
+	s.With(read).Get("/api/user/urls", s.GetUserLinks())
+	s.With(read).Get("/api/user/urls/search", s.SearchUserLinks())
+	s.With(write).Post("/api/user/groups", s.CreateUserGroup())
+	s.With(read).Get("/api/user/groups", s.GetUserGroups())
+	s.With(read).Get("/api/user/groups/{groupID}", s.GetUserGroup())
+	s.With(remove).Delete("/api/user/groups/{groupID}/urls", s.DeleteUserGroupLinks())
+	s.With(write).Post("/api/user/workspaces", s.CreateWorkspace())
+	s.With(read).Get("/api/user/workspaces", s.GetUserWorkspaces())
+	s.With(read).Get("/api/user/workspaces/{workspaceID}/members", s.GetWorkspaceMembers())
+	s.With(CookieOnly).Put("/api/user/workspaces/{workspaceID}/members/{memberUID}", s.PutWorkspaceMember())
+	s.With(CookieOnly).Delete("/api/user/workspaces/{workspaceID}/members/{memberUID}", s.DeleteWorkspaceMember())
+	s.With(CookieOnly).Post("/api/user/transfers", s.CreateTransfer())
+	s.With(CookieOnly).Post("/api/user/transfers/redeem", s.RedeemTransfer())
+	s.With(CookieOnly).Post("/api/user/keys", s.CreateAPIKey())
+	s.With(CookieOnly).Get("/api/user/keys", s.GetAPIKeys())
+	s.With(CookieOnly).Delete("/api/user/keys/{keyID}", s.RevokeAPIKey())
+	s.With(read).Get("/api/user/quota", s.GetUserQuota())
+	s.With(remove).Delete("/api/user/urls", s.DeleteUserLinks())
+	s.With(write).Patch("/api/user/urls/{linkID}", s.UpdateUserLink())
+	s.With(read).Get("/api/user/urls/{linkID}/revisions", s.GetUserLinkRevisions())
+	s.With(read).Get("/api/user/urls/{linkID}/targeting", s.GetLinkTargeting())
+	s.With(write).Put("/api/user/urls/{linkID}/targeting", s.PutLinkTargeting())
+	s.With(write).Put("/api/user/urls/{linkID}/schedule", s.PutLinkSchedule())
 	s.Get("/ping", s.Ping())
 	s.Mount("/debug", middleware.Profiler())
 }
 
 // GetOriginalURL возвращает http.HandlerFunc для обработки запроса на получение длинной ссылки
-// по короткому идентификатору
+// по короткому идентификатору. Для защищенных ссылок пароль передается в заголовке X-Link-Password
+// или отправкой формы, которую получает браузер. С суффиксом + или параметром preview, а также для ссылок
+// с промежуточной страницей вместо перехода отдается страница с адресом назначения.
+// Если ссылка это разрешает, к адресу назначения добавляются путь после короткой ссылки и параметры запроса
 func (s ShortenerController) GetOriginalURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		linkID := chi.URLParam(r, "linkID")
+		linkID, preview := previewLinkID(r)
 
 		linkEntity, err := s.linksService.Get(r.Context(), linkID)
 		if err != nil {
@@ -68,8 +173,64 @@ func (s ShortenerController) GetOriginalURL() http.HandlerFunc {
 			http.Error(w, "url was removed", http.StatusGone)
 			return
 		}
+		query := r.URL.Query()
+		query.Del(previewQueryParam)
+		visitor := s.visitor(r, linkEntity.ID)
+		destination, err := s.linksService.Destination(*linkEntity, visitor, chi.URLParam(r, "*"), query)
+		if err != nil {
+			if errors.Is(err, shortener.ErrPathNotAllowed) {
+				http.Error(w, "url not found", http.StatusNotFound)
+				return
+			}
+			log.Warn().Err(err).Str("linkID", linkID).Msg("can't build link destination")
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if linkEntity.ClicksExhausted() {
+			http.Error(w, "url clicks exhausted", http.StatusGone)
+			return
+		}
+		if err = s.linksService.CheckDestination(*linkEntity); err != nil {
+			http.Error(w, "url is blocked", http.StatusForbidden)
+			return
+		}
+		if err = s.linksService.CheckSchedule(*linkEntity); err != nil {
+			s.writeInactiveLink(w, r, *linkEntity, err)
+			return
+		}
+		if !s.unlockLink(w, r, *linkEntity) {
+			return
+		}
+		// переход засчитывается только после проверки пароля, чтобы неудачные попытки не тратили лимит.
+		// Страница предпросмотра тоже показывает адрес назначения, поэтому засчитывается как переход
+		if err = s.linksService.ConsumeClick(r.Context(), *linkEntity); err != nil {
+			if errors.Is(err, repository.ErrClicksExhausted) {
+				http.Error(w, "url clicks exhausted", http.StatusGone)
+				return
+			}
+			if errors.Is(err, repository.ErrLinkNotFound) {
+				http.Error(w, "url not found", http.StatusNotFound)
+				return
+			}
+			log.Warn().Err(err).Str("linkID", linkID).Msg("can't consume link click")
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if variant, ok := s.linksService.Variant(*linkEntity, visitor); ok {
+			s.rememberVariant(r.Context(), w, *linkEntity, variant)
+		}
+		if preview || linkEntity.Interstitial {
+			s.writeLinkPreview(w, *linkEntity, destination)
+			return
+		}
 
-		http.Redirect(w, r, linkEntity.OriginalURL, http.StatusTemporaryRedirect)
+		code := s.linksService.RedirectCode(*linkEntity)
+		w.Header().Set("Cache-Control", s.redirectCacheControl(*linkEntity, code))
+		if r.Method == http.MethodPost {
+			// после отправки формы с паролем браузер должен перейти по ссылке GET запросом
+			code = http.StatusSeeOther
+		}
+		http.Redirect(w, r, destination, code)
 	}
 }
 
@@ -84,36 +245,59 @@ func (s ShortenerController) ShortenURL() http.HandlerFunc {
 			return
 		}
 
-		bytes, err := io.ReadAll(r.Body)
+		body := io.Reader(r.Body)
+		if maxLength := s.linksService.URLPolicy().MaxLength; maxLength > 0 {
+			// ссылки длиннее допустимого все равно будут отклонены, незачем читать их целиком
+			body = io.LimitReader(r.Body, int64(maxLength)+1)
+		}
+		bytes, err := io.ReadAll(body)
 		if err != nil {
 			http.Error(w, "invalid request params", http.StatusBadRequest)
 			return
 		}
 		originalURL := string(bytes)
-		if !shortener.IsValidURL(originalURL) {
-			http.Error(w, "invalid url "+originalURL, http.StatusBadRequest)
+		if err = s.linksService.ValidateURL(originalURL); err != nil {
+			w.Header().Set(invalidURLReasonHeader, invalidURLReason(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		uid, err := ExtractUID(r.Cookies())
+		uid, err := requestUID(r)
 		if err != nil {
 			s.logCookieError(r, err)
 			uid = random.UserID()
 		}
 
-		linkEntity := entity.NewLinkEntity(originalURL, uid)
-		_, err = s.linksService.ShortenURL(r.Context(), linkEntity)
+		linkEntity := s.linksService.NewLinkEntity(originalURL, uid)
+		if err = s.linksService.ProtectLink(&linkEntity, r.Header.Get(linkPasswordHeader)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		maxClicks, err := linkMaxClicks(r)
+		if err == nil {
+			err = s.linksService.LimitClicks(&linkEntity, maxClicks)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		saved, err := s.linksService.ShortenURL(r.Context(), linkEntity)
 		if err != nil {
 			var linkExistsErr *repository.LinkExistsError
+			if errors.Is(err, repository.ErrQuotaExceeded) {
+				http.Error(w, "links quota exceeded", http.StatusForbidden)
+				return
+			}
 			if !errors.As(err, &linkExistsErr) {
 				log.Warn().Err(err).Fields(linkEntity).Msg("")
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 				return
 			}
-			linkEntity.ID = linkExistsErr.LinkID
+			saved.ID = linkExistsErr.LinkID
 			statusHeader = http.StatusConflict
+			setLinkOwnerHeader(w, linkExistsErr.IsOwnedByUser(uid))
 		}
-		SetUIDCookie(w, uid)
-		writeAnswer(w, "text/html", statusHeader, s.linksService.ShortURL(linkEntity.ID))
+		setRequestUIDCookie(w, r, uid)
+		writeAnswer(w, "text/html", statusHeader, s.linksService.ShortURL(saved.ID))
 	}
 }
 
@@ -132,38 +316,52 @@ func (s ShortenerController) ShortenJSON() http.HandlerFunc {
 		}
 
 		originalURL := request.URL
-		if !shortener.IsValidURL(originalURL) {
-			http.Error(w, "invalid url", http.StatusBadRequest)
+		if err = s.linksService.ValidateURL(originalURL); err != nil {
+			w.Header().Set(invalidURLReasonHeader, invalidURLReason(err))
+			writeJSON(w, http.StatusBadRequest, ShortenResponse{
+				Error:  err.Error(),
+				Reason: invalidURLReason(err),
+			})
 			return
 		}
-		uid, err := ExtractUID(r.Cookies())
+		uid, err := requestUID(r)
 		if err != nil {
 			s.logCookieError(r, err)
 			uid = random.UserID()
 		}
 
-		linkEntity := entity.NewLinkEntity(originalURL, uid)
-		_, err = s.linksService.ShortenURL(r.Context(), linkEntity)
+		var resp ShortenResponse
+		linkEntity := s.linksService.NewLinkEntity(originalURL, uid)
+		if err = s.applyLinkSettings(r.Context(), &linkEntity, request.LinkSettings); err != nil {
+			writeJSON(w, linkSettingsErrorStatus(err), ShortenResponse{Error: err.Error()})
+			return
+		}
+		saved, err := s.linksService.ShortenURL(r.Context(), linkEntity)
 		if err != nil {
 			var linkExistsErr *repository.LinkExistsError
+			if errors.Is(err, repository.ErrQuotaExceeded) {
+				writeJSON(w, http.StatusForbidden, ShortenResponse{Error: err.Error(), Reason: quotaExceededReason})
+				return
+			}
 			if !errors.As(err, &linkExistsErr) {
 				log.Warn().Err(err).Fields(linkEntity).Msg("")
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 				return
 			}
-			linkEntity.ID = linkExistsErr.LinkID
+			saved.ID = linkExistsErr.LinkID
 			statusHeader = http.StatusConflict
+			ownedByUser := linkExistsErr.IsOwnedByUser(uid)
+			resp.OwnedByUser = &ownedByUser
+			setLinkOwnerHeader(w, ownedByUser)
 		}
-		resp := ShortenResponse{
-			Result: s.linksService.ShortURL(linkEntity.ID),
-		}
+		resp.Result = s.linksService.ShortURL(saved.ID)
 
 		data, err := json.Marshal(resp)
 		if err != nil {
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
-		SetUIDCookie(w, uid)
+		setRequestUIDCookie(w, r, uid)
 		writeAnswer(w, "application/json", statusHeader, string(data))
 	}
 }
@@ -183,7 +381,7 @@ func (s ShortenerController) ShortenBatch() http.HandlerFunc {
 			return
 		}
 
-		uid, err := ExtractUID(r.Cookies())
+		uid, err := requestUID(r)
 		if err != nil {
 			s.logCookieError(r, err)
 			uid = random.UserID()
@@ -191,33 +389,51 @@ func (s ShortenerController) ShortenBatch() http.HandlerFunc {
 
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
 		defer cancel()
-		batchService := s.linksService.NewBatchService(10)
+		if err = s.linksService.CheckBatchQuota(ctx, uid, len(request)); err != nil {
+			s.writeBatchQuotaError(w, uid, err)
+			return
+		}
+		// все ссылки проверяются до записи, чтобы из-за невалидной ссылки не сохранилась часть пачки
 		linkEntities := make([]entity.LinkEntity, 0, len(request))
 		for _, item := range request {
-			if !shortener.IsValidURL(item.URL) {
-				http.Error(w, "invalid url "+item.URL, http.StatusBadRequest)
+			if err = s.linksService.ValidateURL(item.URL); err != nil {
+				w.Header().Set(invalidURLReasonHeader, invalidURLReason(err))
+				writeJSON(w, http.StatusBadRequest, ShortenBatchErrorResponse{
+					CorrelationID: item.CorrelationID,
+					Error:         err.Error(),
+					Reason:        invalidURLReason(err),
+				})
 				return
 			}
-
-			e := entity.NewLinkEntity(item.URL, uid)
+			e := s.linksService.NewLinkEntity(item.URL, uid)
 			e.CorrelationID = item.CorrelationID
+			if err = s.applyLinkSettings(ctx, &e, item.LinkSettings); err != nil {
+				writeJSON(w, linkSettingsErrorStatus(err), ShortenBatchErrorResponse{
+					CorrelationID: item.CorrelationID,
+					Error:         err.Error(),
+				})
+				return
+			}
+			linkEntities = append(linkEntities, e)
+		}
+
+		batchService := s.linksService.NewBatchService(10)
+		for _, e := range linkEntities {
 			err = batchService.Add(ctx, e)
 			if err != nil {
-				log.Warn().Err(err).Str("uid", uid).Msg("")
-				http.Error(w, "internal server error", http.StatusInternalServerError)
+				s.writeBatchQuotaError(w, uid, err)
 				return
 			}
-			linkEntities = append(linkEntities, e)
 		}
 		err = batchService.Flush(ctx)
 		if err != nil {
-			log.Warn().Err(err).Str("uid", uid).Msg("")
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			s.writeBatchQuotaError(w, uid, err)
 			return
 		}
 
 		var resp ShortenBatchResponse
-		for _, e := range linkEntities {
+		// хранилище могло заменить занятые идентификаторы, поэтому ответ строится по сохраненным ссылкам
+		for _, e := range batchService.Saved() {
 			resp = append(resp, ShortenBatchResponseItem{
 				CorrelationID: e.CorrelationID,
 				ShortURL:      s.linksService.ShortURL(e.ID),
@@ -230,24 +446,375 @@ func (s ShortenerController) ShortenBatch() http.HandlerFunc {
 			return
 		}
 
-		SetUIDCookie(w, uid)
+		setRequestUIDCookie(w, r, uid)
 		writeAnswer(w, "application/json", http.StatusCreated, string(data))
 	}
 }
 
+// UpdateUserLink возвращает http.HandlerFunc для обработки запроса на изменение ссылки пользователя.
+// Запрос передается в формате JSON в виде UpdateLinkRequest, в ответ возвращается измененная ссылка
+// в виде UserLinksResponseEntry. Изменять ссылку может только ее владелец
+func (s ShortenerController) UpdateUserLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request UpdateLinkRequest
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+
+		linkEntity, err := s.linksService.UpdateLink(r.Context(), uid, chi.URLParam(r, "linkID"), shortener.LinkUpdate{
+			OriginalURL:  request.URL,
+			Password:     request.Password,
+			MaxClicks:    request.MaxClicks,
+			Title:        request.Title,
+			Notes:        request.Notes,
+			Tags:         request.Tags,
+			GroupID:      request.GroupID,
+			Interstitial: request.Interstitial,
+			RedirectCode: request.RedirectCode,
+			PassQuery:    request.PassQuery,
+			PassPath:     request.PassPath,
+			QueryMerge:   request.QueryMerge,
+			UTM:          request.UTM,
+			Targeting:    request.Targeting,
+			Variants:     request.Variants,
+		})
+		if err != nil {
+			s.writeUserLinkError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.userLinkEntry(linkEntity))
+	}
+}
+
+// GetUserLinkRevisions возвращает http.HandlerFunc для обработки запроса на получение истории адресов ссылки.
+// Ответ возвращается в формате JSON в виде LinkRevisionsResponse. Историю видит только владелец ссылки
+func (s ShortenerController) GetUserLinkRevisions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		revisions, err := s.linksService.LinkRevisions(r.Context(), uid, chi.URLParam(r, "linkID"))
+		if err != nil {
+			s.writeUserLinkError(w, uid, err)
+			return
+		}
+		result := make(LinkRevisionsResponse, 0, len(revisions))
+		for _, revision := range revisions {
+			result = append(result, LinkRevisionsResponseEntry{
+				OriginalURL: revision.OriginalURL,
+				ChangedAt:   revision.ChangedAt,
+			})
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// writeUserLinkError отвечает на ошибку работы с отдельной ссылкой пользователя
+func (s ShortenerController) writeUserLinkError(w http.ResponseWriter, uid string, err error) {
+	var invalidURLErr *shortener.InvalidURLError
+	var linkExistsErr *repository.LinkExistsError
+	switch {
+	case errors.As(err, &invalidURLErr):
+		w.Header().Set(invalidURLReasonHeader, string(invalidURLErr.Reason))
+		writeJSON(w, http.StatusBadRequest, ShortenResponse{Error: err.Error(), Reason: string(invalidURLErr.Reason)})
+	case isInvalidSettingsError(err):
+		writeJSON(w, http.StatusBadRequest, ShortenResponse{Error: err.Error()})
+	case errors.Is(err, repository.ErrLinkNotFound):
+		http.Error(w, "url not found", http.StatusNotFound)
+	case errors.Is(err, shortener.ErrNotLinkOwner):
+		http.Error(w, "url is owned by another user", http.StatusForbidden)
+	case errors.Is(err, shortener.ErrInsufficientRole):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.As(err, &linkExistsErr):
+		ownedByUser := linkExistsErr.IsOwnedByUser(uid)
+		setLinkOwnerHeader(w, ownedByUser)
+		writeJSON(w, http.StatusConflict, ShortenResponse{
+			Result:      s.linksService.ShortURL(linkExistsErr.LinkID),
+			Error:       err.Error(),
+			OwnedByUser: &ownedByUser,
+		})
+	default:
+		log.Warn().Err(err).Str("uid", uid).Msg("")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// isInvalidSettingsError возвращает true, если ошибка вызвана недопустимыми настройками ссылки из запроса
+func isInvalidSettingsError(err error) bool {
+	for _, target := range []error{
+		shortener.ErrPasswordTooLong,
+		shortener.ErrInvalidMaxClicks,
+		shortener.ErrTitleTooLong,
+		shortener.ErrNotesTooLong,
+		shortener.ErrInvalidTags,
+		shortener.ErrInvalidGroup,
+		shortener.ErrInvalidWorkspace,
+		shortener.ErrInvalidRedirectCode,
+		shortener.ErrInvalidQueryMerge,
+		shortener.ErrInvalidUTM,
+		shortener.ErrInvalidTargeting,
+		shortener.ErrInvalidVariants,
+		shortener.ErrInvalidSchedule,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// userLinkEntry информация о ссылке пользователя для ответов API
+func (s ShortenerController) userLinkEntry(e entity.LinkEntity) UserLinksResponseEntry {
+	return UserLinksResponseEntry{
+		ShortURL:     s.linksService.ShortURL(e.ID),
+		OriginalURL:  e.OriginalURL,
+		Protected:    e.IsProtected(),
+		MaxClicks:    e.MaxClicks,
+		Clicks:       e.Clicks,
+		Status:       linkStatus(e, time.Now()),
+		Title:        e.Title,
+		Notes:        e.Notes,
+		Tags:         e.Tags,
+		GroupID:      e.GroupID,
+		WorkspaceID:  e.WorkspaceID,
+		Interstitial: e.Interstitial,
+		RedirectCode: e.RedirectCode,
+		PassQuery:    e.PassQuery,
+		PassPath:     e.PassPath,
+		QueryMerge:   e.QueryMerge,
+		UTM:          e.UTM,
+		Targeting:    e.Targeting,
+		Variants:     variantStats(e),
+		NotBefore:    e.NotBefore,
+		NotAfter:     e.NotAfter,
+		InactiveURL:  e.InactiveURL,
+		CreatedAt:    optionalTime(e.CreatedAt),
+		UpdatedAt:    optionalTime(e.UpdatedAt),
+		RemovedAt:    e.RemovedAt,
+	}
+}
+
+// optionalTime время для ответов API: nil вместо нулевого времени
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// linkStatus состояние ссылки к моменту now
+func linkStatus(e entity.LinkEntity, now time.Time) repository.LinkStatus {
+	switch {
+	case e.Removed:
+		return repository.StatusRemoved
+	case e.IsExpired(now):
+		return repository.StatusExpired
+	default:
+		return repository.StatusActive
+	}
+}
+
+// variantStats варианты ссылки со статистикой переходов
+func variantStats(e entity.LinkEntity) []VariantStats {
+	if len(e.Variants) == 0 {
+		return nil
+	}
+	result := make([]VariantStats, 0, len(e.Variants))
+	for _, variant := range e.Variants {
+		result = append(result, VariantStats{
+			Name:   variant.Name,
+			URL:    variant.URL,
+			Weight: variant.Weight,
+			Clicks: e.VariantClicks[variant.Name],
+		})
+	}
+	return result
+}
+
+// redirectCacheControl значение заголовка Cache-Control для перехода по ссылке с кодом code
+func (s ShortenerController) redirectCacheControl(linkEntity entity.LinkEntity, code int) string {
+	switch {
+	case linkEntity.IsProtected() || linkEntity.IsClickLimited():
+		// переход зависит от пароля, а каждый переход по ссылке с лимитом должен доходить до сервиса
+		return "no-store"
+	case linkEntity.IsTargeted():
+		// адрес зависит от устройства, языка и страны посетителя, общие кеши не должны отдавать его другим
+		return "private, no-cache"
+	case shortener.IsPermanentRedirect(code):
+		return fmt.Sprintf("public, max-age=%d", int(s.redirectMaxAge.Seconds()))
+	default:
+		// временные переходы каждый раз проходят через сервис, чтобы изменения ссылки применялись сразу
+		return "no-cache"
+	}
+}
+
+// applyLinkSettings применяет к новой ссылке необязательные настройки из запроса на сокращение
+func (s ShortenerController) applyLinkSettings(ctx context.Context, linkEntity *entity.LinkEntity, settings LinkSettings) error {
+	if err := s.linksService.ProtectLink(linkEntity, settings.Password); err != nil {
+		return err
+	}
+	if err := s.linksService.LimitClicks(linkEntity, settings.MaxClicks); err != nil {
+		return err
+	}
+	if err := s.linksService.SetTitle(linkEntity, settings.Title); err != nil {
+		return err
+	}
+	if err := s.linksService.SetNotes(linkEntity, settings.Notes); err != nil {
+		return err
+	}
+	if err := s.linksService.SetTags(linkEntity, settings.Tags); err != nil {
+		return err
+	}
+	if err := s.linksService.SetWorkspace(ctx, linkEntity, settings.WorkspaceID); err != nil {
+		return err
+	}
+	if err := s.linksService.SetGroup(ctx, linkEntity, settings.GroupID); err != nil {
+		return err
+	}
+	if err := s.linksService.SetRedirectCode(linkEntity, settings.RedirectCode); err != nil {
+		return err
+	}
+	if err := s.linksService.SetQueryMerge(linkEntity, settings.QueryMerge); err != nil {
+		return err
+	}
+	if settings.UTM != nil {
+		if err := s.linksService.SetUTM(linkEntity, *settings.UTM); err != nil {
+			return err
+		}
+	}
+	if err := s.linksService.SetTargeting(linkEntity, settings.Targeting); err != nil {
+		return err
+	}
+	if err := s.linksService.SetVariants(linkEntity, settings.Variants); err != nil {
+		return err
+	}
+	if err := s.linksService.SetSchedule(linkEntity, shortener.Schedule{
+		NotBefore:   settings.NotBefore,
+		NotAfter:    settings.NotAfter,
+		InactiveURL: settings.InactiveURL,
+	}); err != nil {
+		return err
+	}
+	linkEntity.Interstitial = settings.Interstitial
+	linkEntity.PassQuery = settings.PassQuery
+	linkEntity.PassPath = settings.PassPath
+	return nil
+}
+
+// linkSettingsErrorStatus код ответа на ошибку применения настроек новой ссылки
+func linkSettingsErrorStatus(err error) int {
+	if errors.Is(err, shortener.ErrInsufficientRole) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// linkMaxClicks извлекает из заголовка ограничение количества переходов по сокращаемой ссылке
+func linkMaxClicks(r *http.Request) (int, error) {
+	value := r.Header.Get(linkMaxClicksHeader)
+	if value == "" {
+		return 0, nil
+	}
+	maxClicks, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s header: %w", linkMaxClicksHeader, err)
+	}
+	return maxClicks, nil
+}
+
+// writeBatchQuotaError отвечает на ошибку сохранения пачки ссылок.
+// Превышение квот возвращается клиенту, остальные ошибки считаются внутренними
+func (s ShortenerController) writeBatchQuotaError(w http.ResponseWriter, uid string, err error) {
+	switch {
+	case errors.Is(err, quota.ErrBatchTooLarge):
+		writeJSON(w, http.StatusRequestEntityTooLarge, ShortenResponse{Error: err.Error(), Reason: batchTooLargeReason})
+	case errors.Is(err, quota.ErrLinksExceeded):
+		writeJSON(w, http.StatusForbidden, ShortenResponse{Error: err.Error(), Reason: quotaExceededReason})
+	default:
+		log.Warn().Err(err).Str("uid", uid).Msg("")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// GetUserQuota возвращает http.HandlerFunc для обработки запроса на получение квот пользователя
+// и их текущего использования. Ответ возвращается в формате JSON в виде QuotaResponse.
+func (s ShortenerController) GetUserQuota() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			// у нового пользователя еще нет ссылок, но ограничения по умолчанию на него действуют
+			uid = random.UserID()
+		}
+
+		usage, err := s.linksService.GetQuota(r.Context(), uid)
+		if err != nil {
+			log.Warn().Err(err).Str("uid", uid).Msg("")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, QuotaResponse{
+			MaxLinks:     usage.MaxLinks,
+			UsedLinks:    usage.UsedLinks,
+			MaxBatchSize: usage.MaxBatchSize,
+		})
+	}
+}
+
 // GetUserLinks возвращает http.HandlerFunc для обработки запроса на получение ссылок пользователя.
-// Пользователь извлекается из cookie.
+// Пользователь извлекается из cookie или API ключа.
+// Параметры запроса: sort - порядок (created или clicks), status - фильтр (active, removed или expired),
+// group - только ссылки группы, workspace - ссылки рабочего пространства вместо личных, limit - размер страницы, cursor - курсор из заголовка X-Next-Cursor предыдущей страницы.
 // Ответ возвращается в формате JSON в виде UserLinksResponse.
 func (s ShortenerController) GetUserLinks() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		uid, err := ExtractUID(r.Cookies())
+		uid, err := requestUID(r)
 		if err != nil {
 			s.logCookieError(r, err)
 			http.Error(w, "no links", http.StatusNoContent)
 			return
 		}
 
-		links, err := s.linksService.GetUserLinks(r.Context(), uid)
+		query := r.URL.Query()
+		opts := shortener.ListOptions{
+			Sort:        repository.LinkSort(query.Get("sort")),
+			Status:      repository.LinkStatus(query.Get("status")),
+			GroupID:     query.Get("group"),
+			WorkspaceID: query.Get("workspace"),
+			Cursor:      query.Get("cursor"),
+		}
+		if limit := query.Get("limit"); limit != "" {
+			if opts.Limit, err = strconv.Atoi(limit); err != nil || opts.Limit <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		links, next, err := s.linksService.GetUserLinks(r.Context(), uid, opts)
+		if errors.Is(err, shortener.ErrInvalidListOptions) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repository.ErrWorkspaceNotFound) {
+			http.Error(w, "workspace not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, shortener.ErrInsufficientRole) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if err != nil {
 			log.Warn().Err(err).Str("uid", uid).Msg("")
 			http.Error(w, "internal error", http.StatusInternalServerError)
@@ -260,16 +827,16 @@ func (s ShortenerController) GetUserLinks() http.HandlerFunc {
 		var result UserLinksResponse
 
 		for _, e := range links {
-			result = append(result, UserLinksResponseEntry{
-				ShortURL:    s.linksService.ShortURL(e.ID),
-				OriginalURL: e.OriginalURL,
-			})
+			result = append(result, s.userLinkEntry(e))
 		}
 		data, err := json.Marshal(result)
 		if err != nil {
 			http.Error(w, "no links", http.StatusNoContent)
 			return
 		}
+		if next != "" {
+			w.Header().Set(nextCursorHeader, next)
+		}
 		writeAnswer(w, "application/json", http.StatusOK, string(data))
 	}
 }
@@ -279,7 +846,7 @@ func (s ShortenerController) GetUserLinks() http.HandlerFunc {
 // Список идентификаторов ссылок передается в http Body в виде строк. На каждую ссылку одна строка.
 func (s ShortenerController) DeleteUserLinks() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		uid, err := ExtractUID(r.Cookies())
+		uid, err := requestUID(r)
 		if err != nil {
 			s.logCookieError(r, err)
 			http.Error(w, "not authorized", http.StatusUnauthorized)
@@ -320,6 +887,34 @@ func writeAnswer(w http.ResponseWriter, contentType string, statusCode int, data
 	_, _ = fmt.Fprint(w, data)
 }
 
+// writeJSON сериализует ответ в JSON и записывает его с указанным кодом
+func writeJSON(w http.ResponseWriter, statusCode int, resp interface{}) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeAnswer(w, "application/json", statusCode, string(data))
+}
+
+// invalidURLReason возвращает причину, по которой ссылка не прошла проверку
+func invalidURLReason(err error) string {
+	var invalidURLErr *shortener.InvalidURLError
+	if errors.As(err, &invalidURLErr) {
+		return string(invalidURLErr.Reason)
+	}
+	return string(shortener.ReasonMalformed)
+}
+
+// setLinkOwnerHeader сообщает в заголовке, чья ссылка вернулась в ответ на повторное сокращение
+func setLinkOwnerHeader(w http.ResponseWriter, ownedByUser bool) {
+	owner := "other"
+	if ownedByUser {
+		owner = "self"
+	}
+	w.Header().Set(linkOwnerHeader, owner)
+}
+
 // logCookieError логирует ошибку ErrInvalidCookieDigest, если она возникла
 func (s ShortenerController) logCookieError(r *http.Request, err error) {
 	if errors.Is(err, ErrInvalidCookieDigest) {
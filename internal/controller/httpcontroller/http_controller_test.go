@@ -11,14 +11,21 @@ import (
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/app/config"
 	"github.com/zaz600/go-musthave-shortener/internal/entity"
 	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/service/policy"
+	"github.com/zaz600/go-musthave-shortener/internal/service/quota"
 	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
 )
 
@@ -170,6 +177,100 @@ func TestShortenerController_ShortenURL(t *testing.T) {
 	}
 }
 
+func TestShortenerController_ShortenURLInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		wantReason string
+	}{
+		{name: "javascript", url: "javascript:alert(1)", wantReason: "scheme_not_allowed"},
+		{name: "bare word", url: "foobar", wantReason: "scheme_not_allowed"},
+		{name: "no host", url: "http:///path", wantReason: "host_required"},
+		{name: "too long", url: "http://ya.ru/?q=" + strings.Repeat("a", 5000), wantReason: "too_long"},
+		{name: "loopback", url: "http://127.0.0.1/admin", wantReason: "private_address"},
+		{name: "private", url: "http://192.168.1.1/", wantReason: "private_address"},
+		{name: "self link", url: baseURL + "/abc", wantReason: "private_address"},
+		{name: "self link public", url: "http://short.example/abc", wantReason: "redirect_loop"},
+	}
+	linksService := shortener.NewService("http://short.example", shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	controller := New(linksService)
+	ts := httptest.NewServer(controller.Mux)
+	defer ts.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := testRequest(t, ts, "POST", "/", strings.NewReader(tt.url), nil) //nolint:bodyclose
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+			assert.Equal(t, tt.wantReason, res.Header.Get("X-Invalid-URL-Reason"))
+			assert.True(t, strings.HasPrefix(body, "invalid url"))
+
+			request, err := json.Marshal(ShortenRequest{URL: tt.url})
+			require.NoError(t, err)
+			res, body = testRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), nil) //nolint:bodyclose
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+			var actual ShortenResponse
+			require.NoError(t, json.Unmarshal([]byte(body), &actual))
+			assert.Equal(t, tt.wantReason, actual.Reason)
+			assert.NotEmpty(t, actual.Error)
+		})
+	}
+}
+
+func TestShortenerController_DestinationPolicy(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(blocklist, []byte(".phish.example\n"), 0600))
+	destinationPolicy, err := policy.NewEngine(blocklist, "")
+	require.NoError(t, err)
+
+	expired := time.Now().Add(-time.Hour)
+	db := map[string]entity.LinkEntity{
+		"100": {
+			ID:          "100",
+			OriginalURL: "http://login.phish.example/",
+		},
+		"101": {
+			ID:          "101",
+			OriginalURL: "http://ya.ru/",
+			NotAfter:    &expired,
+			InactiveURL: "http://login.phish.example/",
+		},
+	}
+	for _, disableBlockedLinks := range []bool{false, true} {
+		linksService := shortener.NewService(baseURL,
+			shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), db)),
+			shortener.WithDestinationPolicy(destinationPolicy, disableBlockedLinks),
+		)
+		controller := New(linksService)
+		ts := httptest.NewServer(controller.Mux)
+
+		res, _ := testRequest(t, ts, "POST", "/", strings.NewReader("https://www.phish.example/login"), nil) //nolint:bodyclose
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+		assert.Equal(t, "host_blocked", res.Header.Get("X-Invalid-URL-Reason"))
+
+		// ссылка сохранена до того, как хост попал в список
+		res, _ = testRequest(t, ts, "GET", "/100", nil, nil) //nolint:bodyclose
+		res.Body.Close()
+		if disableBlockedLinks {
+			assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		} else {
+			assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+		}
+
+		// вне окна работы ссылка ведет на заблокированный хост
+		res, _ = testRequest(t, ts, "GET", "/101", nil, nil) //nolint:bodyclose
+		res.Body.Close()
+		if disableBlockedLinks {
+			assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		} else {
+			assert.Equal(t, http.StatusFound, res.StatusCode)
+		}
+		ts.Close()
+	}
+}
+
 func TestShortenerController_ShortenURLMultiple(t *testing.T) {
 	db := map[string]entity.LinkEntity{
 		"100": {
@@ -210,6 +311,111 @@ func TestShortenerController_ShortenURLExists(t *testing.T) {
 
 	assert.Equal(t, http.StatusConflict, res.StatusCode)
 	assert.Equal(t, body, "http://localhost:8080/100")
+	assert.Equal(t, "other", res.Header.Get("X-Link-Owner"))
+}
+
+func TestShortenerController_ShortenURLExistsCanonical(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	controller := New(linksService)
+	ts := httptest.NewServer(controller.Mux)
+	defer ts.Close()
+
+	res, shortURL := testRequest(t, ts, "POST", "/", bytes.NewReader([]byte("HTTP://Ya.ru/")), nil) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	uidCookie := extractUIDCookie(t, res)
+
+	for _, longURL := range []string{"http://ya.ru", "http://ya.ru/?", "http://ya.ru:80"} {
+		res, body := testRequest(t, ts, "POST", "/", bytes.NewReader([]byte(longURL)), uidCookie) //nolint:bodyclose
+		res.Body.Close()
+		assert.Equal(t, http.StatusConflict, res.StatusCode, longURL)
+		assert.Equal(t, shortURL, body, longURL)
+	}
+
+	// пользователю показывается ссылка в том виде, в каком он ее сокращал
+	res, respBody := testRequest(t, ts, "GET", "/api/user/urls", nil, uidCookie)
+	res.Body.Close()
+	var actual []UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &actual))
+	require.Len(t, actual, 1)
+	assert.Equal(t, "HTTP://Ya.ru/", actual[0].OriginalURL)
+}
+
+func TestShortenerController_ShortenURLExistsDedupScope(t *testing.T) {
+	longURL := "http://ya.ru/123"
+	tests := []struct {
+		name             string
+		scope            config.DedupScope
+		wantOtherCode    int
+		wantSameUserCode int
+		wantOtherLinks   int
+	}{
+		{
+			name:             "global",
+			scope:            config.DedupGlobal,
+			wantOtherCode:    http.StatusConflict,
+			wantSameUserCode: http.StatusConflict,
+			wantOtherLinks:   0,
+		},
+		{
+			name:             "per user",
+			scope:            config.DedupPerUser,
+			wantOtherCode:    http.StatusCreated,
+			wantSameUserCode: http.StatusConflict,
+			wantOtherLinks:   1,
+		},
+		{
+			name:             "none",
+			scope:            config.DedupNone,
+			wantOtherCode:    http.StatusCreated,
+			wantSameUserCode: http.StatusCreated,
+			wantOtherLinks:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewInMemoryLinksRepository(context.TODO(), nil, repository.WithDedupScope(tt.scope))
+			linksService := shortener.NewService(baseURL, shortener.WithRepository(repo))
+			controller := New(linksService)
+			ts := httptest.NewServer(controller.Mux)
+			defer ts.Close()
+
+			// пользователь A сокращает ссылку
+			resA, _ := testRequest(t, ts, "POST", "/", bytes.NewReader([]byte(longURL)), nil) //nolint:bodyclose
+			defer resA.Body.Close()
+			require.Equal(t, http.StatusCreated, resA.StatusCode)
+			cookieA := extractUIDCookie(t, resA)
+
+			// пользователь A сокращает ту же ссылку повторно
+			resA2, _ := testRequest(t, ts, "POST", "/", bytes.NewReader([]byte(longURL)), cookieA) //nolint:bodyclose
+			defer resA2.Body.Close()
+			assert.Equal(t, tt.wantSameUserCode, resA2.StatusCode)
+			if tt.wantSameUserCode == http.StatusConflict {
+				assert.Equal(t, "self", resA2.Header.Get("X-Link-Owner"))
+			}
+
+			// пользователь B сокращает ту же ссылку
+			request := []byte(fmt.Sprintf(`{"url":"%s"}`, longURL))
+			resB, bodyB := testRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), nil) //nolint:bodyclose
+			defer resB.Body.Close()
+			assert.Equal(t, tt.wantOtherCode, resB.StatusCode)
+			if tt.wantOtherCode == http.StatusConflict {
+				var actual ShortenResponse
+				require.NoError(t, json.Unmarshal([]byte(bodyB), &actual))
+				require.NotNil(t, actual.OwnedByUser)
+				assert.False(t, *actual.OwnedByUser)
+			}
+
+			cookieB := extractUIDCookie(t, resB)
+			res, respBody := testRequest(t, ts, "GET", "/api/user/urls", nil, cookieB)
+			res.Body.Close()
+			var links []UserLinksResponseEntry
+			if tt.wantOtherLinks > 0 {
+				require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+			}
+			assert.Len(t, links, tt.wantOtherLinks)
+		})
+	}
 }
 
 func TestShortenerController_ShortenSuccessPath(t *testing.T) {
@@ -332,7 +538,7 @@ func TestShortenerController_ShortenJSON(t *testing.T) {
 			body:        []byte(`{"foo":"http://ya.ru"}`),
 			want: want{
 				code:        http.StatusBadRequest,
-				contentType: "text/plain; charset=utf-8",
+				contentType: "application/json",
 				body:        "invalid url",
 			},
 			correctURL: false,
@@ -384,7 +590,7 @@ func TestShortenerController_ShortenJSONExists(t *testing.T) {
 	defer res.Body.Close()
 
 	assert.Equal(t, http.StatusConflict, res.StatusCode)
-	assert.JSONEq(t, body, `{"result":"http://localhost:8080/100"}`)
+	assert.JSONEq(t, body, `{"result":"http://localhost:8080/100","owned_by_user":false}`)
 }
 
 func TestShortenerController_GetUserLinks(t *testing.T) {
@@ -419,6 +625,57 @@ func TestShortenerController_GetUserLinks(t *testing.T) {
 	assert.Equal(t, longURL, actual[0].OriginalURL)
 }
 
+func TestShortenerController_GetUserLinksPages(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	first, cookie := shortenWithSettings(t, ts, "https://ya.ru/1", LinkSettings{})
+	for _, longURL := range []string{"https://ya.ru/2", "https://ya.ru/3"} {
+		res, _ := testRequest(t, ts, "POST", "/", strings.NewReader(longURL), cookie) //nolint:bodyclose
+		res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+	// переходы засчитываются и ссылкам без ограничения
+	for i := 0; i < 2; i++ {
+		res, _ := testRequest(t, ts, "GET", "/"+first, nil, nil) //nolint:bodyclose
+		res.Body.Close()
+		require.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	}
+
+	list := func(query string) ([]UserLinksResponseEntry, string) {
+		res, respBody := testRequest(t, ts, "GET", "/api/user/urls?"+query, nil, cookie) //nolint:bodyclose
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode, respBody)
+		var links []UserLinksResponseEntry
+		require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+		return links, res.Header.Get(nextCursorHeader)
+	}
+
+	links, next := list("sort=clicks&limit=2")
+	require.Len(t, links, 2)
+	assert.Equal(t, baseURL+"/"+first, links[0].ShortURL)
+	assert.Equal(t, 2, links[0].Clicks)
+	assert.Equal(t, repository.StatusActive, links[0].Status)
+	require.NotEmpty(t, next)
+
+	links, next = list("sort=clicks&limit=2&cursor=" + next)
+	assert.Len(t, links, 1)
+	assert.Empty(t, next)
+
+	links, _ = list("")
+	assert.Len(t, links, 3)
+
+	for _, query := range []string{"limit=abc", "limit=0", "sort=title", "status=deleted", "cursor=abc"} {
+		res, _ := testRequest(t, ts, "GET", "/api/user/urls?"+query, nil, cookie) //nolint:bodyclose
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+	}
+	res, _ := testRequest(t, ts, "GET", "/api/user/urls?status=removed", nil, cookie) //nolint:bodyclose
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+}
+
 //nolint:funlen
 func TestShortenerController_ShortenBatch(t *testing.T) {
 	type want struct {
@@ -477,6 +734,216 @@ func TestShortenerController_ShortenBatch(t *testing.T) {
 	}
 }
 
+func TestShortenerController_ShortenBatchInvalidURL(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	controller := New(linksService)
+	ts := httptest.NewServer(controller.Mux)
+	defer ts.Close()
+
+	body := []byte(`[{"original_url": "https://ya.ru/?1", "correlation_id": "1"}, {"original_url": "javascript:alert(1)", "correlation_id": "2"}]`)
+	res, respBody := testRequest(t, ts, "POST", "/api/shorten/batch", bytes.NewReader(body), nil) //nolint:bodyclose
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	var actual ShortenBatchErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &actual))
+	assert.Equal(t, "2", actual.CorrelationID)
+	assert.Equal(t, "scheme_not_allowed", actual.Reason)
+}
+
+func TestShortenerController_Quota(t *testing.T) {
+	quotas := quota.New(quota.Limits{MaxLinks: 2, MaxBatchSize: 3}, nil)
+	repo := repository.NewInMemoryLinksRepository(context.TODO(), nil, repository.WithLinksQuota(quotas))
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repo), shortener.WithQuotas(quotas))
+	controller := New(linksService)
+	ts := httptest.NewServer(controller.Mux)
+	defer ts.Close()
+
+	getQuota := func(cookie *http.Cookie) QuotaResponse {
+		res, respBody := testRequest(t, ts, "GET", "/api/user/quota", nil, cookie)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var actual QuotaResponse
+		require.NoError(t, json.Unmarshal([]byte(respBody), &actual))
+		return actual
+	}
+
+	// новый пользователь получает ограничения по умолчанию
+	assert.Equal(t, QuotaResponse{MaxLinks: 2, UsedLinks: 0, MaxBatchSize: 3}, getQuota(nil))
+
+	res, _ := testRequest(t, ts, "POST", "/", bytes.NewReader([]byte("https://ya.ru/1")), nil) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	cookie := extractUIDCookie(t, res)
+	assert.Equal(t, 1, getQuota(cookie).UsedLinks)
+
+	// пачка больше разрешенной
+	batch := []byte(`[{"original_url": "https://ya.ru/a", "correlation_id": "1"}, {"original_url": "https://ya.ru/b", "correlation_id": "2"}, {"original_url": "https://ya.ru/c", "correlation_id": "3"}, {"original_url": "https://ya.ru/d", "correlation_id": "4"}]`)
+	resBatch, respBody := testRequest(t, ts, "POST", "/api/shorten/batch", bytes.NewReader(batch), cookie) //nolint:bodyclose
+	defer resBatch.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resBatch.StatusCode)
+	assert.Contains(t, respBody, "batch_too_large")
+
+	// пачка не влезает в оставшуюся квоту
+	batch = []byte(`[{"original_url": "https://ya.ru/a", "correlation_id": "1"}, {"original_url": "https://ya.ru/b", "correlation_id": "2"}]`)
+	resBatch2, respBody := testRequest(t, ts, "POST", "/api/shorten/batch", bytes.NewReader(batch), cookie) //nolint:bodyclose
+	defer resBatch2.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resBatch2.StatusCode)
+	assert.Contains(t, respBody, "quota_exceeded")
+
+	res2, _ := testRequest(t, ts, "POST", "/", bytes.NewReader([]byte("https://ya.ru/2")), cookie) //nolint:bodyclose
+	defer res2.Body.Close()
+	require.Equal(t, http.StatusCreated, res2.StatusCode)
+
+	// квота исчерпана
+	res3, _ := testRequest(t, ts, "POST", "/", bytes.NewReader([]byte("https://ya.ru/3")), cookie) //nolint:bodyclose
+	defer res3.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res3.StatusCode)
+
+	request := []byte(`{"url":"https://ya.ru/3"}`)
+	res4, respBody := testRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), cookie) //nolint:bodyclose
+	defer res4.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res4.StatusCode)
+	assert.Contains(t, respBody, "quota_exceeded")
+	assert.Equal(t, QuotaResponse{MaxLinks: 2, UsedLinks: 2, MaxBatchSize: 3}, getQuota(cookie))
+}
+
+func TestShortenerController_ClickLimitedLink(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	controller := New(linksService)
+	ts := httptest.NewServer(controller.Mux)
+	defer ts.Close()
+
+	shorten := func(maxClicks int) string {
+		request := []byte(fmt.Sprintf(`{"url":"https://ya.ru/download","max_clicks":%d}`, maxClicks))
+		res, respBody := testRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), nil) //nolint:bodyclose
+		defer res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		var actual ShortenResponse
+		require.NoError(t, json.Unmarshal([]byte(respBody), &actual))
+		return strings.TrimPrefix(actual.Result, baseURL)
+	}
+
+	// одноразовая ссылка
+	oneTime := shorten(1)
+	res, _ := testRequest(t, ts, "GET", oneTime, nil, nil) //nolint:bodyclose
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+	res2, _ := testRequest(t, ts, "GET", oneTime, nil, nil) //nolint:bodyclose
+	defer res2.Body.Close()
+	assert.Equal(t, http.StatusGone, res2.StatusCode)
+
+	// параллельные переходы не превышают лимит
+	limited := shorten(5)
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, _ := testRequest(t, ts, "GET", limited, nil, nil) //nolint:bodyclose
+			res.Body.Close()
+			codes <- res.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	redirects := 0
+	for code := range codes {
+		if code == http.StatusTemporaryRedirect {
+			redirects++
+		} else {
+			assert.Equal(t, http.StatusGone, code)
+		}
+	}
+	assert.Equal(t, 5, redirects)
+
+	// отрицательный лимит
+	request := []byte(`{"url":"https://ya.ru/download","max_clicks":-1}`)
+	resInvalid, _ := testRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), nil) //nolint:bodyclose
+	defer resInvalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode)
+}
+
+//nolint:funlen
+func TestShortenerController_UpdateUserLink(t *testing.T) {
+	linksService := shortener.NewService(baseURL,
+		shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)),
+		shortener.WithLinkCache(time.Hour, 100),
+	)
+	controller := New(linksService)
+	ts := httptest.NewServer(controller.Mux)
+	defer ts.Close()
+
+	links := shortenLinks(t, ts, 2)
+	var link, other LinkInfo
+	for _, linkInfo := range links {
+		if link.ShortID == "" {
+			link = linkInfo
+		} else {
+			other = linkInfo
+		}
+	}
+	path := "/api/user/urls/" + link.ShortID
+
+	// переход кладет ссылку в кеш
+	res, _ := testRequest(t, ts, "GET", "/"+link.ShortID, nil, nil) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, link.LongURL, res.Header.Get("Location"))
+
+	// владелец меняет адрес, переход сразу ведет на новый
+	newURL := "https://ya.ru/new"
+	resPatch, respBody := testRequest(t, ts, "PATCH", path, strings.NewReader(`{"url":"`+newURL+`"}`), link.Cookie) //nolint:bodyclose
+	defer resPatch.Body.Close()
+	require.Equal(t, http.StatusOK, resPatch.StatusCode)
+	var updated UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &updated))
+	assert.Equal(t, newURL, updated.OriginalURL)
+	assert.Equal(t, link.ShortURL, updated.ShortURL)
+
+	res2, _ := testRequest(t, ts, "GET", "/"+link.ShortID, nil, nil) //nolint:bodyclose
+	defer res2.Body.Close()
+	assert.Equal(t, newURL, res2.Header.Get("Location"))
+
+	// история хранит прежний адрес
+	resRevisions, respBody := testRequest(t, ts, "GET", path+"/revisions", nil, link.Cookie) //nolint:bodyclose
+	defer resRevisions.Body.Close()
+	require.Equal(t, http.StatusOK, resRevisions.StatusCode)
+	var revisions LinkRevisionsResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &revisions))
+	require.Len(t, revisions, 1)
+	assert.Equal(t, link.LongURL, revisions[0].OriginalURL)
+	assert.False(t, revisions[0].ChangedAt.IsZero())
+	assert.Regexp(t, `"changed_at":"[^"]+Z"`, respBody, "revision time is serialized in UTC")
+
+	// адрес другой ссылки пользователя
+	resConflict, _ := testRequest(t, ts, "PATCH", path, strings.NewReader(`{"url":"`+other.LongURL+`"}`), link.Cookie) //nolint:bodyclose
+	defer resConflict.Body.Close()
+	assert.Equal(t, http.StatusConflict, resConflict.StatusCode)
+
+	// невалидный адрес
+	resInvalid, _ := testRequest(t, ts, "PATCH", path, strings.NewReader(`{"url":"ftp://ya.ru"}`), link.Cookie) //nolint:bodyclose
+	defer resInvalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode)
+
+	// чужая ссылка
+	resStranger, _ := testRequest(t, ts, "POST", "/", strings.NewReader("https://ya.ru/stranger"), nil) //nolint:bodyclose
+	defer resStranger.Body.Close()
+	strangerCookie := extractUIDCookie(t, resStranger)
+	resForbidden, _ := testRequest(t, ts, "PATCH", path, strings.NewReader(`{"url":"https://ya.ru/evil"}`), strangerCookie) //nolint:bodyclose
+	defer resForbidden.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resForbidden.StatusCode)
+	resForbidden2, _ := testRequest(t, ts, "GET", path+"/revisions", nil, strangerCookie) //nolint:bodyclose
+	defer resForbidden2.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resForbidden2.StatusCode)
+
+	// несуществующая ссылка
+	resNotFound, _ := testRequest(t, ts, "PATCH", "/api/user/urls/unknown", strings.NewReader(`{"url":"https://ya.ru/x"}`), link.Cookie) //nolint:bodyclose
+	defer resNotFound.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resNotFound.StatusCode)
+}
+
 func TestShortenerController_DeleteUserLinks(t *testing.T) {
 	db := map[string]entity.LinkEntity{
 		"100": {
@@ -621,3 +1088,629 @@ type LinkInfo struct {
 	ShortID  string
 	Cookie   *http.Cookie
 }
+
+func TestShortenerController_RedirectCode(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService, WithRedirectMaxAge(time.Hour)).Mux)
+	defer ts.Close()
+
+	// код по умолчанию
+	res, shortURL := testRequest(t, ts, "POST", "/", strings.NewReader("https://ya.ru/campaign"), nil) //nolint:bodyclose
+	defer res.Body.Close()
+	resGet, _ := testRequest(t, ts, "GET", strings.TrimPrefix(shortURL, baseURL), nil, nil) //nolint:bodyclose
+	defer resGet.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resGet.StatusCode)
+	assert.Equal(t, "no-cache", resGet.Header.Get("Cache-Control"))
+
+	// постоянный переход кешируется
+	linkID, cookie := shortenWithSettings(t, ts, "https://ya.ru/permanent", LinkSettings{RedirectCode: http.StatusMovedPermanently})
+	resPermanent, _ := testRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	defer resPermanent.Body.Close()
+	assert.Equal(t, http.StatusMovedPermanently, resPermanent.StatusCode)
+	assert.Equal(t, "public, max-age=3600", resPermanent.Header.Get("Cache-Control"))
+
+	// владелец меняет код
+	resPatch, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"redirect_code":302}`), cookie) //nolint:bodyclose
+	defer resPatch.Body.Close()
+	require.Equal(t, http.StatusOK, resPatch.StatusCode)
+	resTemporary, _ := testRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	defer resTemporary.Body.Close()
+	assert.Equal(t, http.StatusFound, resTemporary.StatusCode)
+
+	for _, body := range []string{`{"redirect_code":200}`, `{"redirect_code":-1}`} {
+		resInvalid, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(body), cookie) //nolint:bodyclose
+		resInvalid.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode, body)
+	}
+	request := []byte(`{"url":"https://ya.ru/other","redirect_code":303}`)
+	resShorten, _ := testRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), nil) //nolint:bodyclose
+	defer resShorten.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resShorten.StatusCode)
+}
+
+func TestShortenerController_Passthrough(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	linkID, cookie := shortenWithSettings(t, ts, "https://ya.ru/docs?lang=ru", LinkSettings{PassQuery: true, PassPath: true})
+
+	res, _ := testRequest(t, ts, "GET", "/"+linkID+"/guide/intro?utm_source=mail&lang=en", nil, nil) //nolint:bodyclose
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, "https://ya.ru/docs/guide/intro?lang=ru&utm_source=mail", res.Header.Get("Location"))
+
+	// предпросмотр показывает итоговый адрес, а параметр preview не передается дальше
+	res2, body := testRequest(t, ts, "GET", "/"+linkID+"/guide?preview&utm_source=mail", nil, nil) //nolint:bodyclose
+	defer res2.Body.Close()
+	assert.Equal(t, http.StatusOK, res2.StatusCode)
+	assert.Contains(t, body, "https://ya.ru/docs/guide?lang=ru&amp;utm_source=mail")
+
+	// параметры из запроса заменяют параметры ссылки
+	resPatch, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"query_merge":"request","pass_path":false}`), cookie) //nolint:bodyclose
+	defer resPatch.Body.Close()
+	require.Equal(t, http.StatusOK, resPatch.StatusCode)
+	res3, _ := testRequest(t, ts, "GET", "/"+linkID+"?lang=en", nil, nil) //nolint:bodyclose
+	defer res3.Body.Close()
+	assert.Equal(t, "https://ya.ru/docs?lang=en", res3.Header.Get("Location"))
+	res4, _ := testRequest(t, ts, "GET", "/"+linkID+"/guide", nil, nil) //nolint:bodyclose
+	defer res4.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res4.StatusCode)
+
+	resInvalid, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"query_merge":"replace"}`), cookie) //nolint:bodyclose
+	defer resInvalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode)
+
+	// ссылка без настроек не принимает путь и параметры
+	res5, shortURL := testRequest(t, ts, "POST", "/", strings.NewReader("https://ya.ru/plain"), nil) //nolint:bodyclose
+	defer res5.Body.Close()
+	res6, _ := testRequest(t, ts, "GET", strings.TrimPrefix(shortURL, baseURL)+"?utm_source=mail", nil, nil) //nolint:bodyclose
+	defer res6.Body.Close()
+	assert.Equal(t, "https://ya.ru/plain", res6.Header.Get("Location"))
+}
+
+func TestShortenerController_UTM(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	longURL := "https://ya.ru/docs?lang=ru"
+	linkID, cookie := shortenWithSettings(t, ts, longURL, LinkSettings{UTM: &entity.UTMParams{Source: "mail", Campaign: "spring"}})
+
+	res, _ := testRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, "https://ya.ru/docs?lang=ru&utm_campaign=spring&utm_source=mail", res.Header.Get("Location"))
+
+	// разметка возвращается отдельно от адреса назначения
+	res2, respBody := testRequest(t, ts, "GET", "/api/user/urls", nil, cookie) //nolint:bodyclose
+	defer res2.Body.Close()
+	var links []UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+	require.Len(t, links, 1)
+	assert.Equal(t, longURL, links[0].OriginalURL)
+	require.NotNil(t, links[0].UTM)
+	assert.Equal(t, "mail", links[0].UTM.Source)
+	assert.Equal(t, "spring", links[0].UTM.Campaign)
+
+	resInvalid, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"utm":{"extra":{"":"x"}}}`), cookie) //nolint:bodyclose
+	defer resInvalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode)
+
+	// пустая разметка снимает ее
+	resPatch, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"utm":{}}`), cookie) //nolint:bodyclose
+	defer resPatch.Body.Close()
+	require.Equal(t, http.StatusOK, resPatch.StatusCode)
+	res3, _ := testRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	defer res3.Body.Close()
+	assert.Equal(t, longURL, res3.Header.Get("Location"))
+}
+
+func TestShortenerController_Targeting(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	const (
+		website   = "https://example.com/app"
+		appStore  = "https://apps.apple.com/app/id1"
+		playStore = "https://play.google.com/store/apps/details?id=app"
+	)
+	linkID, cookie := shortenWithSettings(t, ts, website, LinkSettings{Targeting: []entity.TargetRule{
+		{Platforms: []string{"ios"}, URL: appStore},
+		{Platforms: []string{"android"}, URL: playStore},
+	}})
+
+	for userAgent, want := range map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148": appStore,
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile Safari/537.36":        playStore,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64)":                            website,
+	} {
+		res, _ := passwordRequest(t, ts, "GET", "/"+linkID, nil, map[string]string{"User-Agent": userAgent}) //nolint:bodyclose
+		assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+		assert.Equal(t, want, res.Header.Get("Location"))
+		assert.Equal(t, "private, no-cache", res.Header.Get("Cache-Control"))
+	}
+
+	res, body := testRequest(t, ts, "GET", "/api/user/urls/"+linkID+"/targeting", nil, cookie) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var targeting LinkTargeting
+	require.NoError(t, json.Unmarshal([]byte(body), &targeting))
+	require.Len(t, targeting.Rules, 2)
+	assert.Equal(t, appStore, targeting.Rules[0].URL)
+
+	// правила заменяются целиком
+	resPut, body := testRequest(t, ts, "PUT", "/api/user/urls/"+linkID+"/targeting", strings.NewReader(`{"rules":[{"languages":["ru"],"url":"https://example.ru"}]}`), cookie) //nolint:bodyclose
+	defer resPut.Body.Close()
+	require.Equal(t, http.StatusOK, resPut.StatusCode)
+	require.NoError(t, json.Unmarshal([]byte(body), &targeting))
+	require.Len(t, targeting.Rules, 1)
+	res2, _ := passwordRequest(t, ts, "GET", "/"+linkID, nil, map[string]string{"Accept-Language": "ru-RU,en;q=0.8"}) //nolint:bodyclose
+	assert.Equal(t, "https://example.ru", res2.Header.Get("Location"))
+
+	resInvalid, _ := testRequest(t, ts, "PUT", "/api/user/urls/"+linkID+"/targeting", strings.NewReader(`{"rules":[{"platforms":["symbian"],"url":"https://example.org"}]}`), cookie) //nolint:bodyclose
+	defer resInvalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode)
+
+	resOther, _ := testRequest(t, ts, "GET", "/api/user/urls/"+linkID+"/targeting", nil, nil) //nolint:bodyclose
+	defer resOther.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resOther.StatusCode)
+
+	// без правил переход ведет на адрес ссылки
+	resClear, body := testRequest(t, ts, "PUT", "/api/user/urls/"+linkID+"/targeting", strings.NewReader(`{"rules":[]}`), cookie) //nolint:bodyclose
+	defer resClear.Body.Close()
+	require.Equal(t, http.StatusOK, resClear.StatusCode)
+	assert.JSONEq(t, `{"rules":[]}`, body)
+	res3, _ := passwordRequest(t, ts, "GET", "/"+linkID, nil, map[string]string{"Accept-Language": "ru"}) //nolint:bodyclose
+	assert.Equal(t, website, res3.Header.Get("Location"))
+	assert.Equal(t, "no-cache", res3.Header.Get("Cache-Control"))
+}
+
+func TestShortenerController_Variants(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	linkID, cookie := shortenWithSettings(t, ts, "https://example.com", LinkSettings{Variants: []entity.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 1},
+		{Name: "b", URL: "https://example.com/b", Weight: 1},
+	}})
+
+	res, _ := passwordRequest(t, ts, "GET", "/"+linkID, nil, map[string]string{"User-Agent": "first"}) //nolint:bodyclose
+	require.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, "private, no-cache", res.Header.Get("Cache-Control"))
+	var variantCookie *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == variantCookiePrefix+linkID {
+			variantCookie = c
+		}
+	}
+	require.NotNil(t, variantCookie)
+	assert.Equal(t, "https://example.com/"+variantCookie.Value, res.Header.Get("Location"))
+
+	// посетитель с кукой всегда получает свой вариант
+	other := map[string]string{"a": "b", "b": "a"}[variantCookie.Value]
+	for i := 0; i < 3; i++ {
+		res, _ = passwordRequest(t, ts, "GET", "/"+linkID, nil, map[string]string{ //nolint:bodyclose
+			"User-Agent": "visitor" + strconv.Itoa(i),
+			"Cookie":     variantCookiePrefix + linkID + "=" + other,
+		})
+		assert.Equal(t, "https://example.com/"+other, res.Header.Get("Location"))
+	}
+
+	res2, respBody := testRequest(t, ts, "GET", "/api/user/urls", nil, cookie) //nolint:bodyclose
+	defer res2.Body.Close()
+	var links []UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+	require.Len(t, links, 1)
+	clicks := make(map[string]int)
+	for _, variant := range links[0].Variants {
+		clicks[variant.Name] = variant.Clicks
+	}
+	assert.Equal(t, map[string]int{variantCookie.Value: 1, other: 3}, clicks)
+
+	resInvalid, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"variants":[{"name":"a","url":"https://example.com/a","weight":1}]}`), cookie) //nolint:bodyclose
+	defer resInvalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode)
+
+	// без вариантов переход ведет на адрес ссылки
+	resPatch, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"variants":[]}`), cookie) //nolint:bodyclose
+	defer resPatch.Body.Close()
+	require.Equal(t, http.StatusOK, resPatch.StatusCode)
+	res3, _ := passwordRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	assert.Equal(t, "https://example.com", res3.Header.Get("Location"))
+	assert.Empty(t, res3.Cookies())
+}
+
+func TestShortenerController_Schedule(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	launch := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	linkID, cookie := shortenWithSettings(t, ts, "https://example.com/campaign", LinkSettings{NotBefore: &launch, Title: "Spring sale"})
+
+	res, body := passwordRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Contains(t, body, shortener.ErrLinkNotYetActive.Error())
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+
+	res, body = passwordRequest(t, ts, "GET", "/"+linkID, nil, map[string]string{"Accept": "text/html"}) //nolint:bodyclose
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Contains(t, body, "Spring sale")
+	assert.Contains(t, body, launch.Format("2006-01-02 15:04 MST"))
+
+	// владелец переносит запуск на прошлое, ссылка начинает работать
+	resPut, body := testRequest(t, ts, "PUT", "/api/user/urls/"+linkID+"/schedule", strings.NewReader(`{"not_before":"2020-01-01T00:00:00Z","not_after":null}`), cookie) //nolint:bodyclose
+	defer resPut.Body.Close()
+	require.Equal(t, http.StatusOK, resPut.StatusCode)
+	assert.JSONEq(t, `{"not_before":"2020-01-01T00:00:00Z","not_after":null}`, body)
+	res, _ = passwordRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	// после окончания посетители уходят на запасной адрес
+	resPut2, _ := testRequest(t, ts, "PUT", "/api/user/urls/"+linkID+"/schedule", strings.NewReader(`{"not_after":"2021-01-01T00:00:00Z","inactive_url":"https://example.com/over"}`), cookie) //nolint:bodyclose
+	defer resPut2.Body.Close()
+	require.Equal(t, http.StatusOK, resPut2.StatusCode)
+	res, _ = passwordRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+	assert.Equal(t, "https://example.com/over", res.Header.Get("Location"))
+
+	resPut3, _ := testRequest(t, ts, "PUT", "/api/user/urls/"+linkID+"/schedule", strings.NewReader(`{"not_after":"2021-01-01T00:00:00Z"}`), cookie) //nolint:bodyclose
+	defer resPut3.Body.Close()
+	res, _ = passwordRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+
+	resInvalid, _ := testRequest(t, ts, "PUT", "/api/user/urls/"+linkID+"/schedule", strings.NewReader(`{"not_before":"2021-01-01T00:00:00Z","not_after":"2020-01-01T00:00:00Z"}`), cookie) //nolint:bodyclose
+	defer resInvalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode)
+}
+
+func TestShortenerController_SearchUserLinks(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	linkID, cookie := shortenWithSettings(t, ts, "https://ya.ru/news", LinkSettings{
+		Title: "Новости",
+		Notes: "для рассылки",
+		Tags:  []string{"News", "promo"},
+	})
+	res, _ := testRequest(t, ts, "POST", "/api/shorten", strings.NewReader(`{"url":"https://go.dev","tags":["go"]}`), cookie) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	search := func(query string) []UserLinksResponseEntry {
+		res, respBody := testRequest(t, ts, "GET", "/api/user/urls/search?"+query, nil, cookie) //nolint:bodyclose
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode, respBody)
+		var links []UserLinksResponseEntry
+		require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+		return links
+	}
+
+	links := search("tag=news")
+	require.Len(t, links, 1)
+	assert.Equal(t, baseURL+"/"+linkID, links[0].ShortURL)
+	assert.Equal(t, "для рассылки", links[0].Notes)
+	assert.Equal(t, []string{"news", "promo"}, links[0].Tags)
+
+	assert.Len(t, search("q=GO.DEV"), 1)
+	assert.Len(t, search("q=новости"), 1)
+	assert.Len(t, search("from=2000-01-01&to="+time.Now().UTC().Format("2006-01-02")), 2)
+	assert.Empty(t, search("to=2000-01-01"))
+
+	// теги меняются целиком
+	resPatch, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"tags":["archive"]}`), cookie) //nolint:bodyclose
+	defer resPatch.Body.Close()
+	require.Equal(t, http.StatusOK, resPatch.StatusCode)
+	assert.Empty(t, search("tag=news"))
+	assert.Len(t, search("tag=archive"), 1)
+
+	for _, query := range []string{"from=yesterday", "from=2022-01-02&to=2022-01-01"} {
+		resBad, _ := testRequest(t, ts, "GET", "/api/user/urls/search?"+query, nil, cookie) //nolint:bodyclose
+		resBad.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resBad.StatusCode, query)
+	}
+	resInvalid, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"tags":["two words"]}`), cookie) //nolint:bodyclose
+	defer resInvalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resInvalid.StatusCode)
+
+	resAnon, _ := testRequest(t, ts, "GET", "/api/user/urls/search", nil, nil) //nolint:bodyclose
+	defer resAnon.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resAnon.StatusCode)
+}
+
+func TestShortenerController_LinkTimestamps(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	before := time.Now()
+	linkID, cookie := shortenWithSettings(t, ts, "https://ya.ru/1", LinkSettings{})
+
+	list := func(query string) []UserLinksResponseEntry {
+		res, respBody := testRequest(t, ts, "GET", "/api/user/urls"+query, nil, cookie) //nolint:bodyclose
+		defer res.Body.Close()
+		if res.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		require.Equal(t, http.StatusOK, res.StatusCode, respBody)
+		var links []UserLinksResponseEntry
+		require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+		return links
+	}
+
+	links := list("")
+	require.Len(t, links, 1)
+	require.NotNil(t, links[0].CreatedAt)
+	assert.False(t, links[0].CreatedAt.Before(before.Truncate(time.Second)))
+	require.NotNil(t, links[0].UpdatedAt)
+	assert.True(t, links[0].CreatedAt.Equal(*links[0].UpdatedAt), "new link was not updated yet")
+	assert.Nil(t, links[0].RemovedAt)
+	created := *links[0].CreatedAt
+
+	resPatch, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"title":"Docs"}`), cookie) //nolint:bodyclose
+	defer resPatch.Body.Close()
+	require.Equal(t, http.StatusOK, resPatch.StatusCode)
+	links = list("")
+	require.Len(t, links, 1)
+	assert.True(t, created.Equal(*links[0].CreatedAt))
+	assert.True(t, links[0].UpdatedAt.After(created))
+
+	resDel, _ := testRequest(t, ts, "DELETE", "/api/user/urls", strings.NewReader(`["`+linkID+`"]`), cookie) //nolint:bodyclose
+	defer resDel.Body.Close()
+	require.Equal(t, http.StatusAccepted, resDel.StatusCode)
+	require.Eventually(t, func() bool {
+		return len(list("?status=removed")) == 1
+	}, time.Second, 50*time.Millisecond)
+	links = list("?status=removed")
+	require.NotNil(t, links[0].RemovedAt)
+	assert.False(t, links[0].RemovedAt.Before(*links[0].UpdatedAt))
+	assert.Equal(t, repository.StatusRemoved, links[0].Status)
+}
+
+func TestShortenerController_Groups(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	_, cookie := shortenWithSettings(t, ts, "https://ya.ru/outside", LinkSettings{})
+	res, respBody := testRequest(t, ts, "POST", "/api/user/groups", strings.NewReader(`{"name":"Spring sale"}`), cookie) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode, respBody)
+	var group GroupResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &group))
+	assert.Equal(t, "Spring sale", group.Name)
+
+	batch := fmt.Sprintf(`[{"original_url":"https://ya.ru/1","correlation_id":"1","group_id":"%s"},
+		{"original_url":"https://ya.ru/2","correlation_id":"2","group_id":"%s"}]`, group.ID, group.ID)
+	resBatch, respBody := testRequest(t, ts, "POST", "/api/shorten/batch", strings.NewReader(batch), cookie) //nolint:bodyclose
+	defer resBatch.Body.Close()
+	require.Equal(t, http.StatusCreated, resBatch.StatusCode, respBody)
+
+	// в чужую или несуществующую группу ссылку не добавить
+	resForeign, _ := testRequest(t, ts, "POST", "/api/shorten", strings.NewReader(`{"url":"https://ya.ru/3","group_id":"missing"}`), cookie) //nolint:bodyclose
+	defer resForeign.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resForeign.StatusCode)
+
+	resList, respBody := testRequest(t, ts, "GET", "/api/user/urls?group="+group.ID, nil, cookie) //nolint:bodyclose
+	defer resList.Body.Close()
+	var links []UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+	require.Len(t, links, 2)
+	assert.Equal(t, group.ID, links[0].GroupID)
+
+	resGroups, respBody := testRequest(t, ts, "GET", "/api/user/groups", nil, cookie) //nolint:bodyclose
+	defer resGroups.Body.Close()
+	var groups []GroupResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &groups))
+	require.Len(t, groups, 1)
+	assert.Nil(t, groups[0].Stats)
+
+	resDel, respBody := testRequest(t, ts, "DELETE", "/api/user/groups/"+group.ID+"/urls", nil, cookie) //nolint:bodyclose
+	defer resDel.Body.Close()
+	require.Equal(t, http.StatusAccepted, resDel.StatusCode)
+	assert.JSONEq(t, `{"removed":2}`, respBody)
+	require.Eventually(t, func() bool {
+		res, respBody := testRequest(t, ts, "GET", "/api/user/groups/"+group.ID, nil, cookie) //nolint:bodyclose
+		res.Body.Close()
+		var resp GroupResponse
+		return json.Unmarshal([]byte(respBody), &resp) == nil && resp.Stats != nil && resp.Stats.Removed == 2
+	}, time.Second, 50*time.Millisecond)
+
+	resAll, respBody := testRequest(t, ts, "GET", "/api/user/urls", nil, cookie) //nolint:bodyclose
+	defer resAll.Body.Close()
+	require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+	assert.Len(t, links, 1, "links outside the group are kept")
+
+	_, otherCookie := shortenWithSettings(t, ts, "https://ya.ru/other", LinkSettings{})
+	resOther, _ := testRequest(t, ts, "GET", "/api/user/groups/"+group.ID, nil, otherCookie) //nolint:bodyclose
+	defer resOther.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resOther.StatusCode)
+	resMissing, _ := testRequest(t, ts, "GET", "/api/user/groups/missing", nil, cookie) //nolint:bodyclose
+	defer resMissing.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resMissing.StatusCode)
+}
+
+func TestShortenerController_Workspaces(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	_, ownerCookie := shortenWithSettings(t, ts, "https://ya.ru/owner", LinkSettings{})
+	_, editorCookie := shortenWithSettings(t, ts, "https://ya.ru/editor", LinkSettings{})
+	editorUID, err := ExtractUID([]*http.Cookie{editorCookie})
+	require.NoError(t, err)
+
+	res, respBody := testRequest(t, ts, "POST", "/api/user/workspaces", strings.NewReader(`{"name":"Marketing"}`), ownerCookie) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode, respBody)
+	var workspace WorkspaceResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &workspace))
+	assert.Equal(t, entity.RoleOwner, workspace.Role)
+
+	// пока пользователь не участник, ссылку в пространстве ему не создать и ссылок не увидеть
+	shared := fmt.Sprintf(`{"url":"https://ya.ru/shared","workspace_id":"%s"}`, workspace.ID)
+	resDenied, _ := testRequest(t, ts, "POST", "/api/shorten", strings.NewReader(shared), editorCookie) //nolint:bodyclose
+	defer resDenied.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resDenied.StatusCode)
+
+	membersPath := "/api/user/workspaces/" + workspace.ID + "/members/"
+	resRole, _ := testRequest(t, ts, "PUT", membersPath+editorUID, strings.NewReader(`{"role":"admin"}`), ownerCookie) //nolint:bodyclose
+	defer resRole.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resRole.StatusCode)
+	resPut, respBody := testRequest(t, ts, "PUT", membersPath+editorUID, strings.NewReader(`{"role":"editor"}`), ownerCookie) //nolint:bodyclose
+	defer resPut.Body.Close()
+	require.Equal(t, http.StatusOK, resPut.StatusCode, respBody)
+	resSelf, _ := testRequest(t, ts, "PUT", membersPath+editorUID, strings.NewReader(`{"role":"owner"}`), editorCookie) //nolint:bodyclose
+	defer resSelf.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resSelf.StatusCode, "only owners manage members")
+
+	resShorten, respBody := testRequest(t, ts, "POST", "/api/shorten", strings.NewReader(shared), editorCookie) //nolint:bodyclose
+	defer resShorten.Body.Close()
+	require.Equal(t, http.StatusCreated, resShorten.StatusCode, respBody)
+	var shortenResp ShortenResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &shortenResp))
+	linkID := strings.TrimPrefix(shortenResp.Result, baseURL+"/")
+
+	resList, respBody := testRequest(t, ts, "GET", "/api/user/urls?workspace="+workspace.ID, nil, ownerCookie) //nolint:bodyclose
+	defer resList.Body.Close()
+	require.Equal(t, http.StatusOK, resList.StatusCode, respBody)
+	var links []UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+	require.Len(t, links, 1)
+	assert.Equal(t, workspace.ID, links[0].WorkspaceID)
+
+	resUpdate, respBody := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"title":"Shared"}`), ownerCookie) //nolint:bodyclose
+	defer resUpdate.Body.Close()
+	assert.Equal(t, http.StatusOK, resUpdate.StatusCode, respBody)
+
+	_, strangerCookie := shortenWithSettings(t, ts, "https://ya.ru/stranger", LinkSettings{})
+	resStranger, _ := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"title":"Mine"}`), strangerCookie) //nolint:bodyclose
+	defer resStranger.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resStranger.StatusCode)
+	resStrangerList, _ := testRequest(t, ts, "GET", "/api/user/urls?workspace="+workspace.ID, nil, strangerCookie) //nolint:bodyclose
+	defer resStrangerList.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resStrangerList.StatusCode)
+
+	resMembers, respBody := testRequest(t, ts, "GET", "/api/user/workspaces/"+workspace.ID+"/members", nil, editorCookie) //nolint:bodyclose
+	defer resMembers.Body.Close()
+	var members []WorkspaceMemberResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &members))
+	assert.Len(t, members, 2)
+
+	resLeave, _ := testRequest(t, ts, "DELETE", membersPath+editorUID, nil, editorCookie) //nolint:bodyclose
+	defer resLeave.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resLeave.StatusCode)
+	resWorkspaces, respBody := testRequest(t, ts, "GET", "/api/user/workspaces", nil, editorCookie) //nolint:bodyclose
+	defer resWorkspaces.Body.Close()
+	assert.JSONEq(t, `[]`, respBody)
+}
+
+func TestShortenerController_Transfer(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	linkID, cookie := shortenWithSettings(t, ts, "https://ya.ru/lost", LinkSettings{})
+	resForeign, _ := testRequest(t, ts, "POST", "/api/user/transfers", strings.NewReader(`{"links":["missing"]}`), cookie) //nolint:bodyclose
+	defer resForeign.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resForeign.StatusCode)
+
+	res, respBody := testRequest(t, ts, "POST", "/api/user/transfers", nil, cookie) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode, respBody)
+	var transfer TransferResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &transfer))
+	require.NotEmpty(t, transfer.Token)
+
+	// новый пользователь без cookie получает uid вместе со ссылками
+	redeem := fmt.Sprintf(`{"token":"%s"}`, transfer.Token)
+	resRedeem, respBody := testRequest(t, ts, "POST", "/api/user/transfers/redeem", strings.NewReader(redeem), nil) //nolint:bodyclose
+	defer resRedeem.Body.Close()
+	require.Equal(t, http.StatusOK, resRedeem.StatusCode, respBody)
+	assert.JSONEq(t, fmt.Sprintf(`{"links":["%s/%s"]}`, baseURL, linkID), respBody)
+	newCookie := extractUIDCookie(t, resRedeem)
+
+	resList, respBody := testRequest(t, ts, "GET", "/api/user/urls", nil, newCookie) //nolint:bodyclose
+	defer resList.Body.Close()
+	var links []UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+	require.Len(t, links, 1)
+	resOld, _ := testRequest(t, ts, "GET", "/api/user/urls", nil, cookie) //nolint:bodyclose
+	defer resOld.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resOld.StatusCode)
+
+	resAgain, _ := testRequest(t, ts, "POST", "/api/user/transfers/redeem", strings.NewReader(redeem), cookie) //nolint:bodyclose
+	defer resAgain.Body.Close()
+	assert.Equal(t, http.StatusGone, resAgain.StatusCode)
+	resUnknown, _ := testRequest(t, ts, "POST", "/api/user/transfers/redeem", strings.NewReader(`{"token":"unknown"}`), cookie) //nolint:bodyclose
+	defer resUnknown.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resUnknown.StatusCode)
+}
+
+func TestShortenerController_APIKeys(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	apiRequest := func(method, path string, body io.Reader, key string) (*http.Response, string) {
+		req, err := http.NewRequest(method, ts.URL+path, body)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+key)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		respBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(respBody)
+	}
+
+	_, cookie := shortenWithSettings(t, ts, "https://ya.ru/cookie", LinkSettings{})
+	res, respBody := testRequest(t, ts, "POST", "/api/user/keys", strings.NewReader(`{"name":"ci","scopes":["shorten","read","write"]}`), cookie) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode, respBody)
+	var key APIKeyResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &key))
+	require.NotEmpty(t, key.Key)
+
+	resShorten, respBody := apiRequest("POST", "/api/shorten", strings.NewReader(`{"url":"https://ya.ru/key"}`), key.Key) //nolint:bodyclose
+	defer resShorten.Body.Close()
+	require.Equal(t, http.StatusCreated, resShorten.StatusCode, respBody)
+	assert.Empty(t, resShorten.Cookies(), "api key clients don't get the uid cookie")
+
+	resList, respBody := apiRequest("GET", "/api/user/urls", nil, key.Key) //nolint:bodyclose
+	defer resList.Body.Close()
+	var links []UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &links))
+	assert.Len(t, links, 2, "the key acts as its owner")
+
+	resDelete, _ := apiRequest("DELETE", "/api/user/urls", strings.NewReader(`[]`), key.Key) //nolint:bodyclose
+	defer resDelete.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resDelete.StatusCode, "the key has no delete scope")
+	resKeys, _ := apiRequest("GET", "/api/user/keys", nil, key.Key) //nolint:bodyclose
+	defer resKeys.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resKeys.StatusCode, "keys are managed with the cookie only")
+	resMember, _ := apiRequest("PUT", "/api/user/workspaces/ws/members/intruder", strings.NewReader(`{"role":"owner"}`), key.Key) //nolint:bodyclose
+	defer resMember.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resMember.StatusCode, "members are managed with the cookie only")
+	resWrong, _ := apiRequest("GET", "/api/user/urls", nil, "shk_wrong") //nolint:bodyclose
+	defer resWrong.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resWrong.StatusCode)
+
+	resRevoke, _ := testRequest(t, ts, "DELETE", "/api/user/keys/"+key.ID, nil, cookie) //nolint:bodyclose
+	defer resRevoke.Body.Close()
+	require.Equal(t, http.StatusNoContent, resRevoke.StatusCode)
+	resRevoked, _ := apiRequest("GET", "/api/user/urls", nil, key.Key) //nolint:bodyclose
+	defer resRevoked.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resRevoked.StatusCode)
+
+	resAll, respBody := testRequest(t, ts, "GET", "/api/user/keys", nil, cookie) //nolint:bodyclose
+	defer resAll.Body.Close()
+	var keys []APIKeyResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &keys))
+	require.Len(t, keys, 1)
+	assert.Empty(t, keys[0].Key)
+	assert.NotNil(t, keys[0].RevokedAt)
+}
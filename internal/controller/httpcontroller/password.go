@@ -0,0 +1,89 @@
+package httpcontroller
+
+import (
+	"errors"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// linkPasswordHeader заголовок, в котором передается пароль ссылки:
+// при сокращении - чтобы закрыть ссылку, при переходе - чтобы ее открыть
+const linkPasswordHeader = "X-Link-Password"
+
+// linkPasswordField поле формы ввода пароля ссылки
+const linkPasswordField = "password"
+
+// passwordFormTemplate форма ввода пароля для перехода по защищенной ссылке из браузера
+var passwordFormTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Protected link</title></head>
+<body>
+<form method="post">
+<p>This link is password protected.</p>
+{{if .}}<p>{{.}}</p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`))
+
+// linkPassword извлекает пароль ссылки из заголовка или из отправленной формы
+func linkPassword(r *http.Request) string {
+	if password := r.Header.Get(linkPasswordHeader); password != "" {
+		return password
+	}
+	if r.Method == http.MethodPost {
+		return r.PostFormValue(linkPasswordField)
+	}
+	return ""
+}
+
+// unlockLink проверяет пароль защищенной ссылки и при ошибке сам пишет ответ.
+// Браузерам отдается форма ввода пароля, API клиентам - текст ошибки. Возвращает true, если можно переходить
+func (s ShortenerController) unlockLink(w http.ResponseWriter, r *http.Request, linkEntity entity.LinkEntity) bool {
+	err := s.linksService.UnlockLink(r.Context(), linkEntity, linkPassword(r))
+	if err == nil {
+		return true
+	}
+
+	// ответы зависят от пароля, кешировать их нельзя
+	w.Header().Set("Cache-Control", "no-store")
+	var tooManyErr *shortener.TooManyAttemptsError
+	status := http.StatusUnauthorized
+	switch {
+	case errors.As(err, &tooManyErr):
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyErr.RetryAfter.Seconds()))))
+	case errors.Is(err, shortener.ErrPasswordRequired), errors.Is(err, shortener.ErrWrongPassword):
+	default:
+		log.Warn().Err(err).Str("linkID", linkEntity.ID).Msg("can't check link password")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if !acceptsHTML(r) {
+		http.Error(w, err.Error(), status)
+		return false
+	}
+	message := ""
+	if !errors.Is(err, shortener.ErrPasswordRequired) {
+		message = err.Error()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = passwordFormTemplate.Execute(w, message)
+	return false
+}
+
+// acceptsHTML возвращает true, если запрос пришел из браузера
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
@@ -0,0 +1,145 @@
+package httpcontroller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/ratelimit"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newPasswordServer(t *testing.T, attempts ratelimit.Limit) *httptest.Server {
+	t.Helper()
+
+	linksService := shortener.NewService(baseURL,
+		shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)),
+		shortener.WithPasswordCost(bcrypt.MinCost),
+		shortener.WithPasswordAttempts(ratelimit.NewMemoryStore(), attempts),
+	)
+	return httptest.NewServer(New(linksService).Mux)
+}
+
+// passwordRequest выполняет запрос с заголовками headers без перехода по редиректам
+func passwordRequest(t *testing.T, ts *httptest.Server, method, path string, body io.Reader, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, body)
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(respBody)
+}
+
+// shortenProtected сокращает ссылку с паролем и возвращает путь короткой ссылки
+func shortenProtected(t *testing.T, ts *httptest.Server, longURL string, password string) string {
+	t.Helper()
+
+	request, err := json.Marshal(ShortenRequest{URL: longURL, LinkSettings: LinkSettings{Password: password}})
+	require.NoError(t, err)
+	res, respBody := passwordRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), nil) //nolint:bodyclose
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var resp ShortenResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &resp))
+	shortURL, err := url.Parse(resp.Result)
+	require.NoError(t, err)
+	return shortURL.Path
+}
+
+func TestShortenerController_PasswordProtectedLink(t *testing.T) {
+	ts := newPasswordServer(t, ratelimit.Limit{})
+	defer ts.Close()
+
+	longURL := "https://ya.ru/internal"
+	path := shortenProtected(t, ts, longURL, "secret")
+
+	// API клиент без пароля
+	res, body := passwordRequest(t, ts, "GET", path, nil, nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Contains(t, body, shortener.ErrPasswordRequired.Error())
+	assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+
+	// браузер получает форму ввода пароля
+	res, body = passwordRequest(t, ts, "GET", path, nil, map[string]string{"Accept": "text/html"}) //nolint:bodyclose
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Contains(t, res.Header.Get("Content-Type"), "text/html")
+	assert.Contains(t, body, `name="password"`)
+
+	// неверный пароль в заголовке
+	res, _ = passwordRequest(t, ts, "GET", path, nil, map[string]string{linkPasswordHeader: "wrong"}) //nolint:bodyclose
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// верный пароль в заголовке
+	res, _ = passwordRequest(t, ts, "GET", path, nil, map[string]string{linkPasswordHeader: "secret"}) //nolint:bodyclose
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, longURL, res.Header.Get("Location"))
+
+	// верный пароль из формы
+	form := strings.NewReader(url.Values{"password": {"secret"}}.Encode())
+	res, _ = passwordRequest(t, ts, "POST", path, form, map[string]string{"Content-Type": "application/x-www-form-urlencoded"}) //nolint:bodyclose
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+	assert.Equal(t, longURL, res.Header.Get("Location"))
+}
+
+func TestShortenerController_PasswordProtectedLinkNotDeduplicated(t *testing.T) {
+	ts := newPasswordServer(t, ratelimit.Limit{})
+	defer ts.Close()
+
+	longURL := "https://ya.ru/doc"
+	res, _ := passwordRequest(t, ts, "POST", "/", strings.NewReader(longURL), nil) //nolint:bodyclose
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// защищенная ссылка на тот же адрес создается отдельно, публичная ссылка паролем не закрывается
+	protectedPath := shortenProtected(t, ts, longURL, "secret")
+	res, _ = passwordRequest(t, ts, "GET", protectedPath, nil, nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res, _ = passwordRequest(t, ts, "POST", "/", strings.NewReader(longURL), nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+}
+
+func TestShortenerController_PasswordAttemptsLimit(t *testing.T) {
+	ts := newPasswordServer(t, ratelimit.Limit{Burst: 2, Period: time.Hour})
+	defer ts.Close()
+
+	path := shortenProtected(t, ts, "https://ya.ru/limited", "secret")
+	for i := 0; i < 2; i++ {
+		res, _ := passwordRequest(t, ts, "GET", path, nil, map[string]string{linkPasswordHeader: "wrong"}) //nolint:bodyclose
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	// после исчерпания лимита не проходит даже верный пароль
+	res, _ := passwordRequest(t, ts, "GET", path, nil, map[string]string{linkPasswordHeader: "secret"}) //nolint:bodyclose
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.NotEmpty(t, res.Header.Get("Retry-After"))
+
+	// лимит считается для каждой ссылки отдельно
+	other := shortenProtected(t, ts, "https://ya.ru/other", "secret")
+	res, _ = passwordRequest(t, ts, "GET", other, nil, map[string]string{linkPasswordHeader: "secret"}) //nolint:bodyclose
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+}
@@ -0,0 +1,75 @@
+package httpcontroller
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+// previewSuffix суффикс короткой ссылки, по которому вместо перехода показывается страница предпросмотра
+const previewSuffix = "+"
+
+// previewQueryParam параметр запроса, по которому вместо перехода показывается страница предпросмотра
+const previewQueryParam = "preview"
+
+// previewTemplate страница с адресом назначения короткой ссылки
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title></head>
+<body>
+{{if .Title}}<h1>{{.Title}}</h1>{{end}}
+{{if .Interstitial}}<p>You are leaving {{.ShortURL}}. The owner of this link asks to check the destination before following it.</p>
+{{else}}<p>{{.ShortURL}} leads to:</p>{{end}}
+<p><code>{{.Destination}}</code></p>
+{{if not .CreatedAt.IsZero}}<p>Created {{.CreatedAt.Format "2006-01-02 15:04 MST"}}</p>{{end}}
+<p><a href="{{.Destination}}" rel="noopener noreferrer nofollow">Continue to the destination</a></p>
+</body>
+</html>
+`))
+
+// linkPreview данные страницы предпросмотра
+type linkPreview struct {
+	// ShortURL короткая ссылка
+	ShortURL string
+	// Destination адрес, на который ведет ссылка
+	Destination string
+	// Title название ссылки
+	Title string
+	// CreatedAt время создания ссылки
+	CreatedAt time.Time
+	// Interstitial страница показана по настройке ссылки, а не по запросу предпросмотра
+	Interstitial bool
+}
+
+// previewLinkID возвращает идентификатор ссылки из запроса и признак того, что запрошен предпросмотр
+func previewLinkID(r *http.Request) (string, bool) {
+	linkID := chi.URLParam(r, "linkID")
+	if strings.HasSuffix(linkID, previewSuffix) {
+		return strings.TrimSuffix(linkID, previewSuffix), true
+	}
+	_, preview := r.URL.Query()[previewQueryParam]
+	return linkID, preview
+}
+
+// writeLinkPreview отдает страницу предпросмотра ссылки с адресом назначения destination вместо перехода
+func (s ShortenerController) writeLinkPreview(w http.ResponseWriter, linkEntity entity.LinkEntity, destination string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// страница показывает адрес назначения, который владелец может поменять или закрыть паролем
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err := previewTemplate.Execute(w, linkPreview{
+		ShortURL:     s.linksService.ShortURL(linkEntity.ID),
+		Destination:  destination,
+		Title:        linkEntity.Title,
+		CreatedAt:    linkEntity.CreatedAt,
+		Interstitial: linkEntity.Interstitial,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("linkID", linkEntity.ID).Msg("can't render link preview")
+	}
+}
@@ -0,0 +1,98 @@
+package httpcontroller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// shortenWithSettings сокращает ссылку с настройками и возвращает идентификатор короткой ссылки и куку владельца
+func shortenWithSettings(t *testing.T, ts *httptest.Server, longURL string, settings LinkSettings) (string, *http.Cookie) {
+	t.Helper()
+
+	request, err := json.Marshal(ShortenRequest{URL: longURL, LinkSettings: settings})
+	require.NoError(t, err)
+	res, respBody := testRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), nil) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode, respBody)
+
+	var resp ShortenResponse
+	require.NoError(t, json.Unmarshal([]byte(respBody), &resp))
+	return strings.TrimPrefix(resp.Result, baseURL+"/"), extractUIDCookie(t, res)
+}
+
+func TestShortenerController_LinkPreview(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	longURL := "https://ya.ru/docs?a=1&b=2"
+	linkID, _ := shortenWithSettings(t, ts, longURL, LinkSettings{Title: "  Docs <b>  "})
+
+	for _, path := range []string{"/" + linkID + "+", "/" + linkID + "?preview"} {
+		res, body := testRequest(t, ts, "GET", path, nil, nil) //nolint:bodyclose
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode, path)
+		assert.Contains(t, res.Header.Get("Content-Type"), "text/html")
+		assert.Equal(t, "no-store", res.Header.Get("Cache-Control"))
+		assert.Contains(t, body, "<h1>Docs &lt;b&gt;</h1>")
+		assert.Contains(t, body, `href="https://ya.ru/docs?a=1&amp;b=2"`)
+		assert.Contains(t, body, "Created ")
+	}
+
+	// без суффикса обычный переход
+	res, _ := testRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	res2, _ := testRequest(t, ts, "GET", "/unknown+", nil, nil) //nolint:bodyclose
+	defer res2.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res2.StatusCode)
+
+	request := []byte(`{"url":"https://ya.ru","title":"` + strings.Repeat("a", 201) + `"}`)
+	res3, _ := testRequest(t, ts, "POST", "/api/shorten", bytes.NewReader(request), nil) //nolint:bodyclose
+	defer res3.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res3.StatusCode)
+}
+
+func TestShortenerController_Interstitial(t *testing.T) {
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), nil)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	longURL := "https://ya.ru/untrusted"
+	res, _ := testRequest(t, ts, "POST", "/", strings.NewReader(longURL), nil) //nolint:bodyclose
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// ссылка с промежуточной страницей не совпадает с публичной ссылкой на тот же адрес
+	linkID, cookie := shortenWithSettings(t, ts, longURL, LinkSettings{Interstitial: true})
+	res2, body := testRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	defer res2.Body.Close()
+	require.Equal(t, http.StatusOK, res2.StatusCode)
+	assert.Contains(t, body, "You are leaving")
+	assert.Contains(t, body, longURL)
+
+	// владелец отключает промежуточную страницу
+	resPatch, respBody := testRequest(t, ts, "PATCH", "/api/user/urls/"+linkID, strings.NewReader(`{"interstitial":false,"title":"Site"}`), cookie) //nolint:bodyclose
+	defer resPatch.Body.Close()
+	require.Equal(t, http.StatusOK, resPatch.StatusCode)
+	var updated UserLinksResponseEntry
+	require.NoError(t, json.Unmarshal([]byte(respBody), &updated))
+	assert.False(t, updated.Interstitial)
+	assert.Equal(t, "Site", updated.Title)
+
+	res3, _ := testRequest(t, ts, "GET", "/"+linkID, nil, nil) //nolint:bodyclose
+	defer res3.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res3.StatusCode)
+	assert.Equal(t, longURL, res3.Header.Get("Location"))
+}
@@ -0,0 +1,86 @@
+package httpcontroller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/qr"
+)
+
+// GetLinkQRCode возвращает http.HandlerFunc для обработки запроса на получение QR кода короткой ссылки.
+// Формат выбирается параметром format (png, svg) или заголовком Accept, по умолчанию PNG.
+// Параметры size, level и margin задают размер в пикселях, уровень коррекции ошибок (L, M, Q, H) и ширину поля в модулях
+func (s ShortenerController) GetLinkQRCode() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		linkID := chi.URLParam(r, "linkID")
+
+		opts, err := qrOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		linkEntity, err := s.linksService.Get(r.Context(), linkID)
+		if err != nil {
+			http.Error(w, "url not found", http.StatusNotFound)
+			return
+		}
+		if linkEntity.Removed {
+			http.Error(w, "url was removed", http.StatusGone)
+			return
+		}
+
+		image, err := s.linksService.LinkQRCode(linkID, opts)
+		if err != nil {
+			if errors.Is(err, qr.ErrTooSmall) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Warn().Err(err).Str("linkID", linkID).Msg("can't generate qr code")
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", opts.Format.ContentType())
+		w.Header().Set("Vary", "Accept")
+		// изображение зависит только от короткой ссылки и не меняется
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(image)
+	}
+}
+
+// qrOptions извлекает параметры QR кода из запроса. Незаданные параметры берутся по умолчанию
+func qrOptions(r *http.Request) (qr.Options, error) {
+	opts := qr.DefaultOptions()
+	query := r.URL.Query()
+
+	var err error
+	switch {
+	case query.Get("format") != "":
+		if opts.Format, err = qr.ParseFormat(query.Get("format")); err != nil {
+			return qr.Options{}, err
+		}
+	case strings.Contains(r.Header.Get("Accept"), qr.FormatSVG.ContentType()):
+		opts.Format = qr.FormatSVG
+	}
+	if value := query.Get("size"); value != "" {
+		if opts.Size, err = strconv.Atoi(value); err != nil {
+			return qr.Options{}, errors.New("qr size must be a number")
+		}
+	}
+	if value := query.Get("level"); value != "" {
+		if opts.Level, err = qr.ParseLevel(value); err != nil {
+			return qr.Options{}, err
+		}
+	}
+	if value := query.Get("margin"); value != "" {
+		if opts.Margin, err = strconv.Atoi(value); err != nil {
+			return qr.Options{}, errors.New("qr margin must be a number")
+		}
+	}
+	return opts, opts.Validate()
+}
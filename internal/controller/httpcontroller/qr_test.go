@@ -0,0 +1,57 @@
+package httpcontroller
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+func TestShortenerController_GetLinkQRCode(t *testing.T) {
+	db := map[string]entity.LinkEntity{
+		"100":     {ID: "100", OriginalURL: "http://ya.ru/123", UID: "100500"},
+		"removed": {ID: "removed", OriginalURL: "http://ya.ru/456", UID: "100500", Removed: true},
+	}
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), db)))
+	ts := httptest.NewServer(New(linksService).Mux)
+	defer ts.Close()
+
+	// по умолчанию PNG
+	res, body := passwordRequest(t, ts, "GET", "/100/qr?size=200", nil, nil) //nolint:bodyclose
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "image/png", res.Header.Get("Content-Type"))
+	img, err := png.Decode(bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	assert.Equal(t, 200, img.Bounds().Dx())
+
+	// повторный запрос отдает то же изображение из кеша
+	_, cached := passwordRequest(t, ts, "GET", "/100/qr?size=200", nil, nil) //nolint:bodyclose
+	assert.Equal(t, body, cached)
+
+	// SVG по заголовку Accept и по параметру
+	res, body = passwordRequest(t, ts, "GET", "/100/qr", nil, map[string]string{"Accept": "image/svg+xml"}) //nolint:bodyclose
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "image/svg+xml", res.Header.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(body, "<svg"))
+	res, _ = passwordRequest(t, ts, "GET", "/100/qr?format=svg&level=H&margin=0", nil, nil) //nolint:bodyclose
+	assert.Equal(t, "image/svg+xml", res.Header.Get("Content-Type"))
+
+	for _, query := range []string{"format=gif", "size=abc", "size=1", "level=Z", "margin=-1"} {
+		res, _ = passwordRequest(t, ts, "GET", "/100/qr?"+query, nil, nil) //nolint:bodyclose
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+	}
+
+	res, _ = passwordRequest(t, ts, "GET", "/unknown/qr", nil, nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, _ = passwordRequest(t, ts, "GET", "/removed/qr", nil, nil) //nolint:bodyclose
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+}
@@ -0,0 +1,235 @@
+package httpcontroller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/ratelimit"
+)
+
+// RateLimits ограничения частоты запросов. Нулевое ограничение отключает проверку
+type RateLimits struct {
+	// Shorten сокращение одной ссылки
+	Shorten ratelimit.Limit
+	// Batch сокращение пачки ссылок. Каждая ссылка в пачке расходует один токен,
+	// пачка больше Burst ссылок отклоняется сразу
+	Batch ratelimit.Limit
+	// Redirect переход по короткой ссылке
+	Redirect ratelimit.Limit
+}
+
+// RateLimiter ограничивает частоту запросов отдельно для каждого uid пользователя и каждого IP-адреса.
+// Запрос пропускается, только если лимита хватает и пользователю, и адресу.
+type RateLimiter struct {
+	store  ratelimit.Store
+	limits RateLimits
+}
+
+func NewRateLimiter(store ratelimit.Store, limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		store:  store,
+		limits: limits,
+	}
+}
+
+// maxBatchBodySize сколько байт тела пакетного запроса читается, чтобы посчитать ссылки в нем
+const maxBatchBodySize = 8 << 20
+
+// requestWeight возвращает, сколько токенов расходует запрос. Ошибка - тело запроса не удалось прочитать
+type requestWeight func(w http.ResponseWriter, r *http.Request) (int, error)
+
+// Shorten middleware ограничения запросов на сокращение одной ссылки
+func (l *RateLimiter) Shorten() func(http.Handler) http.Handler {
+	if l == nil {
+		return passThrough
+	}
+	return l.middleware("shorten", l.limits.Shorten, singleRequest)
+}
+
+// Batch middleware ограничения запросов на сокращение пачки ссылок
+func (l *RateLimiter) Batch() func(http.Handler) http.Handler {
+	if l == nil {
+		return passThrough
+	}
+	return l.middleware("batch", l.limits.Batch, batchItemsCount)
+}
+
+// Redirect middleware ограничения переходов по коротким ссылкам
+func (l *RateLimiter) Redirect() func(http.Handler) http.Handler {
+	if l == nil {
+		return passThrough
+	}
+	return l.middleware("redirect", l.limits.Redirect, singleRequest)
+}
+
+func (l *RateLimiter) middleware(class string, limit ratelimit.Limit, weight requestWeight) func(http.Handler) http.Handler {
+	if !limit.Enabled() {
+		return passThrough
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, err := weight(w, r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if n > limit.Burst {
+				// такой запрос не пройдет никогда, поэтому время повтора не предлагается
+				http.Error(w, fmt.Sprintf("request needs %d rate limit tokens, at most %d are allowed", n, limit.Burst),
+					http.StatusRequestEntityTooLarge)
+				return
+			}
+			var result ratelimit.Result
+			var taken []string
+			for _, key := range rateLimitKeys(class, r) {
+				res, err := l.store.Take(r.Context(), key, limit, n)
+				if err != nil {
+					// недоступность хранилища лимитов не должна останавливать сервис
+					log.Warn().Err(err).Str("key", key).Msg("rate limit store error")
+					continue
+				}
+				result = mostRestrictive(result, res)
+				if !res.Allowed {
+					break
+				}
+				taken = append(taken, key)
+			}
+			if result.Limit == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !result.Allowed {
+				// запрос не выполняется, поэтому токены, уже списанные из других корзин, возвращаются:
+				// иначе один пользователь, упершийся в свой лимит, расходовал бы лимит всех клиентов за его адресом
+				l.refund(r, taken, limit, n)
+			}
+
+			setRateLimitHeaders(w, result)
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// refund возвращает n токенов в корзины keys
+func (l *RateLimiter) refund(r *http.Request, keys []string, limit ratelimit.Limit, n int) {
+	for _, key := range keys {
+		if err := l.store.Refund(r.Context(), key, limit, n); err != nil {
+			log.Warn().Err(err).Str("key", key).Msg("rate limit store error")
+		}
+	}
+}
+
+// rateLimitKeys ключи корзин для запроса: по IP-адресу и, если кука валидна, по uid
+func rateLimitKeys(class string, r *http.Request) []string {
+	keys := []string{class + ":ip:" + remoteHost(r)}
+	if uid, err := requestUID(r); err == nil {
+		keys = append(keys, class+":uid:"+uid)
+	}
+	return keys
+}
+
+// remoteHost возвращает IP-адрес клиента без порта. Адрес из заголовков X-Forwarded-For и X-Real-IP
+// попадает в RemoteAddr, только если запрос пришел от доверенного прокси (trustedRealIP)
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// mostRestrictive выбирает результат, который надо показать клиенту: отказ или меньший остаток
+func mostRestrictive(current ratelimit.Result, next ratelimit.Result) ratelimit.Result {
+	if current.Limit == 0 {
+		return next
+	}
+	if current.Allowed != next.Allowed {
+		if next.Allowed {
+			return current
+		}
+		return next
+	}
+	if next.Remaining < current.Remaining {
+		return next
+	}
+	return current
+}
+
+// setRateLimitHeaders выставляет заголовки RateLimit-* (draft-ietf-httpapi-ratelimit-headers)
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func singleRequest(http.ResponseWriter, *http.Request) (int, error) {
+	return 1, nil
+}
+
+// batchItemsCount возвращает количество ссылок в запросе ShortenBatchRequest.
+// Тело запроса вычитывается, но не больше maxBatchBodySize, и подменяется копией для следующего обработчика
+func batchItemsCount(w http.ResponseWriter, r *http.Request) (int, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBodySize))
+	_ = r.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var items []json.RawMessage
+	if err = json.Unmarshal(body, &items); err != nil || len(items) == 0 {
+		// с невалидным запросом разберется обработчик
+		return 1, nil
+	}
+	return len(items), nil
+}
+
+// trustedRealIP подставляет в RemoteAddr адрес клиента из заголовков X-Forwarded-For и X-Real-IP
+// (middleware.RealIP), только если запрос пришел с адреса доверенного прокси.
+// Остальные клиенты могли бы подделать эти заголовки и обойти ограничения по IP
+func trustedRealIP(proxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withRealIP := middleware.RealIP(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isTrustedProxy(remoteHost(r), proxies) {
+				withRealIP.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isTrustedProxy возвращает true, если адрес host входит в одну из сетей proxies
+func isTrustedProxy(host string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func passThrough(next http.Handler) http.Handler {
+	return next
+}
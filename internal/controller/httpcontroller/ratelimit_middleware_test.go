@@ -0,0 +1,169 @@
+package httpcontroller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/ratelimit"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+func newRateLimitedServer(t *testing.T, limits RateLimits) *httptest.Server {
+	t.Helper()
+	db := map[string]entity.LinkEntity{
+		"100": {
+			ID:          "100",
+			OriginalURL: "http://ya.ru/123",
+		},
+	}
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), db)))
+	// тестовый клиент ходит через loopback, его адрес в X-Real-IP принимается как от прокси
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	controller := New(linksService,
+		WithRateLimiter(NewRateLimiter(ratelimit.NewMemoryStore(), limits)),
+		WithTrustedProxies([]*net.IPNet{loopback}),
+	)
+	return httptest.NewServer(controller.Mux)
+}
+
+// shortenFrom сокращает ссылку url от имени клиента с адресом ip и возвращает код ответа
+func shortenFrom(t *testing.T, ts *httptest.Server, ip string, url string, cookie *http.Cookie) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/", strings.NewReader(url))
+	require.NoError(t, err)
+	req.Header.Set("X-Real-IP", ip)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestRateLimiter_Shorten(t *testing.T) {
+	ts := newRateLimitedServer(t, RateLimits{Shorten: ratelimit.Limit{Burst: 2, Period: time.Minute}})
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		res, _ := testRequest(t, ts, "POST", "/", strings.NewReader(fmt.Sprintf("http://ya.ru/?%d", i)), nil) //nolint:bodyclose
+		res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		assert.Equal(t, "2", res.Header.Get("RateLimit-Limit"))
+		assert.Equal(t, fmt.Sprint(1-i), res.Header.Get("RateLimit-Remaining"))
+	}
+
+	res, _ := testRequest(t, ts, "POST", "/api/shorten", strings.NewReader(`{"url":"http://ya.ru/?3"}`), nil) //nolint:bodyclose
+	res.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "30", res.Header.Get("Retry-After"))
+	assert.Equal(t, "0", res.Header.Get("RateLimit-Remaining"))
+
+	// с другого адреса лимит свой
+	assert.Equal(t, http.StatusCreated, shortenFrom(t, ts, "10.1.1.1", "http://ya.ru/?4", nil))
+
+	// редиректы не ограничены
+	res, _ = testRequest(t, ts, "GET", "/100", nil, nil) //nolint:bodyclose
+	res.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+}
+
+func TestRateLimiter_ShortenPerUser(t *testing.T) {
+	ts := newRateLimitedServer(t, RateLimits{Shorten: ratelimit.Limit{Burst: 1, Period: time.Minute}})
+	defer ts.Close()
+
+	res, _ := testRequest(t, ts, "POST", "/", strings.NewReader("http://ya.ru/?1"), nil) //nolint:bodyclose
+	res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	uidCookie := extractUIDCookie(t, res)
+
+	assert.Equal(t, http.StatusCreated, shortenFrom(t, ts, "10.1.1.1", "http://ya.ru/?2", uidCookie))
+	// пользователь исчерпал лимит, смена адреса не помогает
+	assert.Equal(t, http.StatusTooManyRequests, shortenFrom(t, ts, "10.2.2.2", "http://ya.ru/?3", uidCookie))
+	// отказ пользователю не расходует лимит адреса: другой клиент за тем же адресом проходит
+	assert.Equal(t, http.StatusCreated, shortenFrom(t, ts, "10.2.2.2", "http://ya.ru/?4", nil))
+	assert.Equal(t, http.StatusTooManyRequests, shortenFrom(t, ts, "10.2.2.2", "http://ya.ru/?5", nil))
+}
+
+func TestRateLimiter_UntrustedRealIP(t *testing.T) {
+	db := map[string]entity.LinkEntity{}
+	linksService := shortener.NewService(baseURL, shortener.WithRepository(repository.NewInMemoryLinksRepository(context.TODO(), db)))
+	limits := RateLimits{Shorten: ratelimit.Limit{Burst: 1, Period: time.Minute}}
+	controller := New(linksService, WithRateLimiter(NewRateLimiter(ratelimit.NewMemoryStore(), limits)))
+	ts := httptest.NewServer(controller.Mux)
+	defer ts.Close()
+
+	assert.Equal(t, http.StatusCreated, shortenFrom(t, ts, "10.1.1.1", "http://ya.ru/?1", nil))
+	// без доверенных прокси заголовок X-Real-IP игнорируется, лимит считается по адресу соединения
+	assert.Equal(t, http.StatusTooManyRequests, shortenFrom(t, ts, "10.2.2.2", "http://ya.ru/?2", nil))
+}
+
+func TestRateLimiter_BatchWeighted(t *testing.T) {
+	ts := newRateLimitedServer(t, RateLimits{Batch: ratelimit.Limit{Burst: 5, Period: time.Minute}})
+	defer ts.Close()
+
+	batch := func(from int) []byte {
+		return []byte(fmt.Sprintf(`[{"original_url": "https://ya.ru/?%d", "correlation_id": "1"},
+			{"original_url": "https://ya.ru/?%d", "correlation_id": "2"},
+			{"original_url": "https://ya.ru/?%d", "correlation_id": "3"}]`, from, from+1, from+2))
+	}
+
+	res, _ := testRequest(t, ts, "POST", "/api/shorten/batch", bytes.NewReader(batch(0)), nil) //nolint:bodyclose
+	res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("RateLimit-Remaining"))
+
+	res, _ = testRequest(t, ts, "POST", "/api/shorten/batch", bytes.NewReader(batch(3)), nil) //nolint:bodyclose
+	res.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "12", res.Header.Get("Retry-After"))
+}
+
+func TestRateLimiter_BatchOverBurst(t *testing.T) {
+	ts := newRateLimitedServer(t, RateLimits{Batch: ratelimit.Limit{Burst: 2, Period: time.Minute}})
+	defer ts.Close()
+
+	batch := `[{"original_url": "https://ya.ru/?1", "correlation_id": "1"},
+		{"original_url": "https://ya.ru/?2", "correlation_id": "2"},
+		{"original_url": "https://ya.ru/?3", "correlation_id": "3"}]`
+	res, respBody := testRequest(t, ts, "POST", "/api/shorten/batch", strings.NewReader(batch), nil) //nolint:bodyclose
+	res.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Retry-After"), "the batch will never fit, retrying is pointless")
+	assert.Contains(t, respBody, "at most 2")
+}
+
+func TestRateLimiter_BatchTooLarge(t *testing.T) {
+	ts := newRateLimitedServer(t, RateLimits{Batch: ratelimit.Limit{Burst: 5, Period: time.Minute}})
+	defer ts.Close()
+
+	body := bytes.Repeat([]byte(" "), maxBatchBodySize+1)
+	res, _ := testRequest(t, ts, "POST", "/api/shorten/batch", bytes.NewReader(body), nil) //nolint:bodyclose
+	res.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+}
+
+func TestRateLimiter_Redirect(t *testing.T) {
+	ts := newRateLimitedServer(t, RateLimits{Redirect: ratelimit.Limit{Burst: 1, Period: time.Second}})
+	defer ts.Close()
+
+	res, _ := testRequest(t, ts, "GET", "/100", nil, nil) //nolint:bodyclose
+	res.Body.Close()
+	require.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+
+	res, _ = testRequest(t, ts, "GET", "/100", nil, nil) //nolint:bodyclose
+	res.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal(t, "1", res.Header.Get("Retry-After"))
+}
@@ -0,0 +1,110 @@
+package httpcontroller
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// defaultInactivePage страница для браузеров, которые перешли по ссылке вне окна ее работы
+var defaultInactivePage = template.Must(template.New("inactive").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{if .Title}}{{.Title}}{{else}}Link is not active{{end}}</title></head>
+<body>
+{{if .Title}}<h1>{{.Title}}</h1>{{end}}
+{{if .Expired}}<p>{{.ShortURL}} is no longer active.</p>
+{{else}}<p>{{.ShortURL}} is not active yet.{{if .NotBefore}} It opens {{.NotBefore.Format "2006-01-02 15:04 MST"}}.{{end}}</p>{{end}}
+</body>
+</html>
+`))
+
+// inactiveLink данные страницы ссылки вне окна работы
+type inactiveLink struct {
+	// ShortURL короткая ссылка
+	ShortURL string
+	// Title название ссылки
+	Title string
+	// NotBefore с какого момента ссылка работает
+	NotBefore *time.Time
+	// NotAfter с какого момента ссылка перестает работать
+	NotAfter *time.Time
+	// Expired ссылка уже перестала работать, а не еще не начала
+	Expired bool
+}
+
+// writeInactiveLink отвечает на переход по ссылке вне окна ее работы: переводит на InactiveURL ссылки,
+// а без него отдает браузерам страницу, API клиентам - текст ошибки
+func (s ShortenerController) writeInactiveLink(w http.ResponseWriter, r *http.Request, linkEntity entity.LinkEntity, err error) {
+	// ответ изменится, когда окно откроется или закроется
+	w.Header().Set("Cache-Control", "no-cache")
+	if linkEntity.InactiveURL != "" {
+		http.Redirect(w, r, linkEntity.InactiveURL, http.StatusFound)
+		return
+	}
+
+	expired := errors.Is(err, shortener.ErrLinkExpired)
+	status := http.StatusNotFound
+	if expired {
+		status = http.StatusGone
+	}
+	if !acceptsHTML(r) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	err = s.inactivePage.Execute(w, inactiveLink{
+		ShortURL:  s.linksService.ShortURL(linkEntity.ID),
+		Title:     linkEntity.Title,
+		NotBefore: linkEntity.NotBefore,
+		NotAfter:  linkEntity.NotAfter,
+		Expired:   expired,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("linkID", linkEntity.ID).Msg("can't render inactive link page")
+	}
+}
+
+// PutLinkSchedule возвращает http.HandlerFunc для обработки запроса на изменение окна работы ссылки.
+// Окно передается в формате JSON в виде LinkSchedule и заменяется целиком: null снимает границу.
+// В ответ возвращается сохраненное окно. Менять окно может только владелец ссылки
+func (s ShortenerController) PutLinkSchedule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request LinkSchedule
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+
+		linkEntity, err := s.linksService.UpdateLink(r.Context(), uid, chi.URLParam(r, "linkID"), shortener.LinkUpdate{
+			Schedule: &shortener.Schedule{
+				NotBefore:   request.NotBefore,
+				NotAfter:    request.NotAfter,
+				InactiveURL: request.InactiveURL,
+			},
+		})
+		if err != nil {
+			s.writeUserLinkError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, LinkSchedule{
+			NotBefore:   linkEntity.NotBefore,
+			NotAfter:    linkEntity.NotAfter,
+			InactiveURL: linkEntity.InactiveURL,
+		})
+	}
+}
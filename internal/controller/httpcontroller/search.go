@@ -0,0 +1,79 @@
+package httpcontroller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// searchDateLayout формат даты без времени в параметрах from и to поиска ссылок
+const searchDateLayout = "2006-01-02"
+
+// SearchUserLinks возвращает http.HandlerFunc для обработки запроса на поиск ссылок пользователя.
+// Условия передаются параметрами запроса: tag - тег, q - подстрока адреса или названия,
+// from и to - интервал времени создания в RFC 3339 или датой ГГГГ-ММ-ДД (UTC), дата to входит в интервал.
+// Ответ возвращается в формате JSON в виде UserLinksResponse, от новых ссылок к старым
+func (s ShortenerController) SearchUserLinks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := repository.LinkFilter{
+			Tag:   query.Get("tag"),
+			Query: query.Get("q"),
+		}
+		if filter.CreatedFrom, err = parseSearchTime(query.Get("from"), false); err != nil {
+			http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if filter.CreatedTo, err = parseSearchTime(query.Get("to"), true); err != nil {
+			http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		links, err := s.linksService.SearchUserLinks(r.Context(), uid, filter)
+		if errors.Is(err, shortener.ErrInvalidSearch) {
+			http.Error(w, "from must be before to", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("uid", uid).Msg("")
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		result := make(UserLinksResponse, 0, len(links))
+		for _, e := range links {
+			result = append(result, s.userLinkEntry(e))
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// parseSearchTime разбирает границу интервала поиска. Пустое значение - граница не задана.
+// Дата без времени означает начало суток, а для конца интервала (endOfDay) - начало следующих суток
+func parseSearchTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(searchDateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 time or %s date", searchDateLayout)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
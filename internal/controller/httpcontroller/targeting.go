@@ -0,0 +1,76 @@
+package httpcontroller
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// visitor описывает посетителя ссылки linkID для правил выбора адреса назначения и вариантов
+func (s ShortenerController) visitor(r *http.Request, linkID string) shortener.Visitor {
+	visitor := s.linksService.NewVisitor(r.UserAgent(), r.Header.Get("Accept-Language"), net.ParseIP(remoteHost(r)))
+	visitor.ID = visitorID(r)
+	visitor.Variant = assignedVariant(r, linkID)
+	return visitor
+}
+
+// GetLinkTargeting возвращает http.HandlerFunc для обработки запроса на получение правил выбора адреса назначения.
+// Ответ возвращается в формате JSON в виде LinkTargeting. Правила видит только владелец ссылки
+func (s ShortenerController) GetLinkTargeting() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		rules, err := s.linksService.LinkTargeting(r.Context(), uid, chi.URLParam(r, "linkID"))
+		if err != nil {
+			s.writeUserLinkError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newLinkTargeting(rules))
+	}
+}
+
+// PutLinkTargeting возвращает http.HandlerFunc для обработки запроса на замену правил выбора адреса назначения.
+// Правила передаются в формате JSON в виде LinkTargeting, пустой список снимает правила.
+// В ответ возвращаются сохраненные правила. Менять правила может только владелец ссылки
+func (s ShortenerController) PutLinkTargeting() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request LinkTargeting
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+
+		linkEntity, err := s.linksService.UpdateLink(r.Context(), uid, chi.URLParam(r, "linkID"), shortener.LinkUpdate{
+			Targeting: &request.Rules,
+		})
+		if err != nil {
+			s.writeUserLinkError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newLinkTargeting(linkEntity.Targeting))
+	}
+}
+
+// newLinkTargeting ответ с правилами ссылки. У ссылки без правил - пустой список, а не null
+func newLinkTargeting(rules []entity.TargetRule) LinkTargeting {
+	if rules == nil {
+		rules = []entity.TargetRule{}
+	}
+	return LinkTargeting{Rules: rules}
+}
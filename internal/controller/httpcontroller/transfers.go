@@ -0,0 +1,90 @@
+package httpcontroller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/random"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// CreateTransfer возвращает http.HandlerFunc для обработки запроса на создание токена передачи ссылок.
+// Идентификаторы ссылок передаются в формате JSON в виде CreateTransferRequest, пустое тело передает все
+// личные ссылки на момент создания токена. В ответ возвращается TransferResponse, токен в нем показывается только один раз
+func (s ShortenerController) CreateTransfer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := ExtractUID(r.Cookies())
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request CreateTransferRequest
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+		token, transfer, err := s.linksService.CreateTransfer(r.Context(), uid, request.Links)
+		if err != nil {
+			s.writeTransferError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, TransferResponse{
+			Token:     token,
+			Links:     transfer.LinkIDs,
+			ExpiresAt: transfer.ExpiresAt,
+		})
+	}
+}
+
+// RedeemTransfer возвращает http.HandlerFunc для обработки запроса на получение ссылок по токену передачи.
+// Токен передается в формате JSON в виде RedeemTransferRequest. Пользователю без cookie выдается новый uid,
+// который становится владельцем ссылок. В ответ возвращается RedeemTransferResponse
+func (s ShortenerController) RedeemTransfer() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request RedeemTransferRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+		uid, err := ExtractUID(r.Cookies())
+		if err != nil {
+			s.logCookieError(r, err)
+			uid = random.UserID()
+		}
+
+		transfer, err := s.linksService.RedeemTransfer(r.Context(), uid, request.Token)
+		if err != nil {
+			s.writeTransferError(w, uid, err)
+			return
+		}
+		result := RedeemTransferResponse{Links: make([]string, 0, len(transfer.TransferredIDs))}
+		for _, linkID := range transfer.TransferredIDs {
+			result.Links = append(result.Links, s.linksService.ShortURL(linkID))
+		}
+		SetUIDCookie(w, uid)
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// writeTransferError отвечает на ошибку передачи ссылок
+func (s ShortenerController) writeTransferError(w http.ResponseWriter, uid string, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrInvalidTransfer), errors.Is(err, repository.ErrTransferToSelf):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrTransferNotFound):
+		http.Error(w, "transfer not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrTransferUnavailable):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, repository.ErrQuotaExceeded):
+		writeJSON(w, http.StatusForbidden, ShortenResponse{Error: err.Error(), Reason: quotaExceededReason})
+	default:
+		log.Warn().Err(err).Str("uid", uid).Msg("")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
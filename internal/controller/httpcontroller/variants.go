@@ -0,0 +1,49 @@
+package httpcontroller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+// variantCookiePrefix префикс куки, в которой запоминается вариант адреса назначения посетителя
+const variantCookiePrefix = "SHORTENER_VARIANT_"
+
+// variantCookieMaxAge сколько посетитель получает один и тот же вариант
+const variantCookieMaxAge = 30 * 24 * time.Hour
+
+// visitorID постоянный идентификатор посетителя: uid из куки, а без нее - IP-адрес и User-Agent
+func visitorID(r *http.Request) string {
+	if uid, err := ExtractUID(r.Cookies()); err == nil {
+		return uid
+	}
+	return remoteHost(r) + " " + r.UserAgent()
+}
+
+// assignedVariant возвращает вариант ссылки linkID, выбранный посетителю раньше
+func assignedVariant(r *http.Request, linkID string) string {
+	cookie, err := r.Cookie(variantCookiePrefix + linkID)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// rememberVariant запоминает вариант посетителя и засчитывает по нему переход.
+// Ошибка статистики не мешает переходу
+func (s ShortenerController) rememberVariant(ctx context.Context, w http.ResponseWriter, linkEntity entity.LinkEntity, variant entity.Variant) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookiePrefix + linkEntity.ID,
+		Value:    variant.Name,
+		Path:     "/" + linkEntity.ID,
+		MaxAge:   int(variantCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if err := s.linksService.CountVariantClick(ctx, linkEntity.ID, variant.Name); err != nil {
+		log.Warn().Err(err).Str("linkID", linkEntity.ID).Str("variant", variant.Name).Msg("can't count variant click")
+	}
+}
@@ -0,0 +1,173 @@
+package httpcontroller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/service/shortener"
+)
+
+// CreateWorkspace возвращает http.HandlerFunc для обработки запроса на создание рабочего пространства.
+// Название передается в формате JSON в виде CreateWorkspaceRequest, в ответ возвращается WorkspaceResponse.
+// Создатель становится владельцем пространства
+func (s ShortenerController) CreateWorkspace() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request CreateWorkspaceRequest
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+		workspace, err := s.linksService.CreateWorkspace(r.Context(), uid, request.Name)
+		if err != nil {
+			s.writeWorkspaceError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, newWorkspaceResponse(entity.WorkspaceMembership{Workspace: workspace, Role: entity.RoleOwner}))
+	}
+}
+
+// GetUserWorkspaces возвращает http.HandlerFunc для обработки запроса на получение рабочих пространств,
+// в которых состоит пользователь. Ответ возвращается в формате JSON в виде списка WorkspaceResponse
+// с ролью пользователя, от старых пространств к новым
+func (s ShortenerController) GetUserWorkspaces() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		memberships, err := s.linksService.UserWorkspaces(r.Context(), uid)
+		if err != nil {
+			s.writeWorkspaceError(w, uid, err)
+			return
+		}
+		result := make([]WorkspaceResponse, 0, len(memberships))
+		for _, membership := range memberships {
+			result = append(result, newWorkspaceResponse(membership))
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// GetWorkspaceMembers возвращает http.HandlerFunc для обработки запроса на получение участников пространства.
+// Список виден любому участнику. Ответ возвращается в формате JSON в виде списка WorkspaceMemberResponse
+func (s ShortenerController) GetWorkspaceMembers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		members, err := s.linksService.WorkspaceMembers(r.Context(), uid, chi.URLParam(r, "workspaceID"))
+		if err != nil {
+			s.writeWorkspaceError(w, uid, err)
+			return
+		}
+		result := make([]WorkspaceMemberResponse, 0, len(members))
+		for _, member := range members {
+			result = append(result, newWorkspaceMemberResponse(member))
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// PutWorkspaceMember возвращает http.HandlerFunc для обработки запроса на добавление участника пространства
+// или изменение его роли. Роль передается в формате JSON в виде SetWorkspaceMemberRequest,
+// в ответ возвращается WorkspaceMemberResponse. Участниками управляет только владелец пространства
+func (s ShortenerController) PutWorkspaceMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request SetWorkspaceMemberRequest
+		if err = json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request params", http.StatusBadRequest)
+			return
+		}
+		member, err := s.linksService.SetWorkspaceMember(r.Context(), uid, chi.URLParam(r, "workspaceID"),
+			chi.URLParam(r, "memberUID"), request.Role)
+		if err != nil {
+			s.writeWorkspaceError(w, uid, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newWorkspaceMemberResponse(member))
+	}
+}
+
+// DeleteWorkspaceMember возвращает http.HandlerFunc для обработки запроса на исключение участника пространства.
+// Исключать участников может владелец, уйти из пространства сам - любой участник, кроме последнего владельца
+func (s ShortenerController) DeleteWorkspaceMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid, err := requestUID(r)
+		if err != nil {
+			s.logCookieError(r, err)
+			http.Error(w, "not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		err = s.linksService.RemoveWorkspaceMember(r.Context(), uid, chi.URLParam(r, "workspaceID"), chi.URLParam(r, "memberUID"))
+		if err != nil {
+			s.writeWorkspaceError(w, uid, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeWorkspaceError отвечает на ошибку работы с рабочим пространством
+func (s ShortenerController) writeWorkspaceError(w http.ResponseWriter, uid string, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrInvalidWorkspace):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrWorkspaceNotFound):
+		http.Error(w, "workspace not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrMemberNotFound):
+		http.Error(w, "member not found", http.StatusNotFound)
+	case errors.Is(err, shortener.ErrInsufficientRole):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, shortener.ErrLastOwner):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Warn().Err(err).Str("uid", uid).Msg("")
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+// newWorkspaceResponse рабочее пространство с ролью пользователя для ответов API
+func newWorkspaceResponse(membership entity.WorkspaceMembership) WorkspaceResponse {
+	return WorkspaceResponse{
+		ID:        membership.ID,
+		Name:      membership.Name,
+		Role:      membership.Role,
+		CreatedAt: membership.CreatedAt,
+	}
+}
+
+// newWorkspaceMemberResponse участник рабочего пространства для ответов API
+func newWorkspaceMemberResponse(member entity.WorkspaceMember) WorkspaceMemberResponse {
+	return WorkspaceMemberResponse{
+		UID:     member.UID,
+		Role:    member.Role,
+		AddedAt: member.AddedAt,
+	}
+}
@@ -0,0 +1,59 @@
+package entity
+
+import "time"
+
+// Scope действие, которое разрешено выполнять по API ключу
+type Scope string
+
+const (
+	// ScopeShorten сокращение ссылок
+	ScopeShorten Scope = "shorten"
+	// ScopeRead чтение ссылок, групп, пространств и квот пользователя
+	ScopeRead Scope = "read"
+	// ScopeWrite изменение ссылок и их настроек, групп и создание пространств. Участниками пространств по ключу
+	// управлять нельзя
+	ScopeWrite Scope = "write"
+	// ScopeDelete удаление ссылок
+	ScopeDelete Scope = "delete"
+)
+
+// IsValid возвращает true, если область действия известна
+func (s Scope) IsValid() bool {
+	return s == ScopeShorten || s == ScopeRead || s == ScopeWrite || s == ScopeDelete
+}
+
+// APIKey ключ, по которому программы-клиенты работают с API от имени пользователя.
+// Сам ключ не хранится: запись ищется по его хешу
+type APIKey struct {
+	// ID идентификатор ключа, по нему ключ отзывается
+	ID string `json:"id"`
+	// UID пользователь, от имени которого действует ключ
+	UID string `json:"uid"`
+	// Name название ключа для владельца
+	Name string `json:"name,omitempty"`
+	// Prefix начало ключа, по которому владелец узнает ключ в списке
+	Prefix string `json:"prefix"`
+	// KeyHash хеш ключа
+	KeyHash string `json:"key_hash"`
+	// Scopes разрешенные ключу действия
+	Scopes []Scope `json:"scopes"`
+	// CreatedAt время создания ключа
+	CreatedAt time.Time `json:"created_at"`
+	// RevokedAt время отзыва ключа. nil - ключ действует
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope возвращает true, если ключу разрешено действие scope
+func (k APIKey) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRevoked возвращает true, если ключ отозван
+func (k APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
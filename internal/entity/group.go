@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+// Group группа ссылок пользователя, например рекламная кампания.
+// Ссылки группы можно просматривать, удалять и считать вместе
+type Group struct {
+	// ID идентификатор группы
+	ID string `json:"id"`
+	// UID пользователь, которому принадлежит группа
+	UID string `json:"uid"`
+	// Name название группы
+	Name string `json:"name"`
+	// CreatedAt время создания группы
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupStats сводная статистика по ссылкам группы
+type GroupStats struct {
+	// Links сколько не удаленных ссылок в группе
+	Links int
+	// Active сколько ссылок группы работают: не удалены и не истекли
+	Active int
+	// Expired сколько не удаленных ссылок группы истекло
+	Expired int
+	// Removed сколько ссылок группы удалено
+	Removed int
+	// Clicks сколько переходов засчитано всем ссылкам группы, включая удаленные
+	Clicks int
+}
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"time"
+
 	"github.com/zaz600/go-musthave-shortener/internal/pkg/random"
 )
 
@@ -8,23 +10,157 @@ import (
 type LinkEntity struct {
 	// ID идентификатор в БД
 	ID string `json:"id"`
-	// OriginalURL оригинальная сокращаемая ссылка
+	// OriginalURL оригинальная сокращаемая ссылка в том виде, в каком ее передал пользователь
 	OriginalURL string `json:"original_url"`
+	// CanonicalURL ссылка, приведенная к каноническому виду. По ней ищутся дубликаты
+	CanonicalURL string `json:"canonical_url,omitempty"`
 	// UID пользователь, который сократил ссылку
 	UID string `json:"uid,omitempty"`
+	// WorkspaceID рабочее пространство, которому принадлежит ссылка. Пустой - ссылка личная,
+	// ей управляет только UID, иначе - участники пространства по своим ролям
+	WorkspaceID string `json:"workspace_id,omitempty"`
 	// CorrelationID внешний идентификатор ссылки, передаваемый через API
 	CorrelationID string `json:"correlation_id,omitempty"`
-	// Removed признак удаления ссылки. Нет ручек, которым нужен был бы этот признак
-	Removed bool `json:"-"`
+	// PasswordHash bcrypt хеш пароля, без которого по ссылке не перейти. Пустой - ссылка не защищена
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks после скольких переходов ссылка перестает работать. 0 - без ограничений
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// Clicks сколько переходов засчитано ссылке
+	Clicks int `json:"clicks,omitempty"`
+	// Title название ссылки, которое владелец показывает на странице предпросмотра
+	Title string `json:"title,omitempty"`
+	// Notes заметки владельца о ссылке. Посетителям не показываются
+	Notes string `json:"notes,omitempty"`
+	// GroupID группа пользователя, в которую входит ссылка. Пустой - ссылка не входит в группу
+	GroupID string `json:"group_id,omitempty"`
+	// Tags теги, которыми владелец помечает ссылку для поиска. Хранятся в нижнем регистре без повторов
+	Tags []string `json:"tags,omitempty"`
+	// Interstitial перед переходом всегда показывать страницу с адресом назначения
+	Interstitial bool `json:"interstitial,omitempty"`
+	// RedirectCode код ответа при переходе: 301, 302, 307 или 308. 0 - код по умолчанию из настроек сервиса
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// PassQuery добавлять к адресу назначения параметры запроса, с которыми пришли на короткую ссылку
+	PassQuery bool `json:"pass_query,omitempty"`
+	// PassPath добавлять к пути адреса назначения путь после короткой ссылки: /{ID}/extra/path
+	PassPath bool `json:"pass_path,omitempty"`
+	// QueryMerge как объединять одноименные параметры: link, request или append. Пустое - правило из настроек сервиса
+	QueryMerge string `json:"query_merge,omitempty"`
+	// UTM разметка, которая добавляется к адресу назначения при переходе. nil - без разметки
+	UTM *UTMParams `json:"utm,omitempty"`
+	// Targeting правила выбора адреса назначения, проверяются по порядку.
+	// Если ни одно правило не подошло, переход ведет на OriginalURL
+	Targeting []TargetRule `json:"targeting,omitempty"`
+	// Variants варианты адреса назначения для посетителей, которым не подошло ни одно правило Targeting
+	Variants []Variant `json:"variants,omitempty"`
+	// VariantClicks сколько переходов засчитано каждому варианту.
+	// Хранится только в памяти и файле, в БД счетчики лежат в отдельной таблице
+	VariantClicks map[string]int `json:"variant_clicks,omitempty"`
+	// NotBefore с какого момента ссылка работает. nil - с момента создания
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// NotAfter с какого момента ссылка перестает работать. nil - без срока
+	NotAfter *time.Time `json:"not_after,omitempty"`
+	// InactiveURL куда вести посетителей вне окна NotBefore-NotAfter. Пустой - показать страницу о том, что ссылка не работает
+	InactiveURL string `json:"inactive_url,omitempty"`
+	// CreatedAt время создания ссылки. Нулевое у ссылок, сохраненных до появления поля
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt время последнего изменения ссылки владельцем. У ссылок, которые не меняли, совпадает с CreatedAt
+	UpdatedAt time.Time `json:"updated_at"`
+	// RemovedAt когда ссылка удалена. nil - ссылка не удалена или удалена до появления поля
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+	// Revisions предыдущие адреса ссылки, от старых к новым.
+	// Хранится только в памяти и файле, в БД история лежит в отдельной таблице
+	Revisions []LinkRevision `json:"revisions,omitempty"`
+	// Removed признак удаления ссылки
+	Removed bool `json:"removed,omitempty"`
+}
+
+// LinkRevision предыдущий адрес ссылки, замененный при редактировании
+type LinkRevision struct {
+	// OriginalURL адрес, на который ссылка вела до изменения
+	OriginalURL string `json:"original_url"`
+	// ChangedAt когда адрес был заменен
+	ChangedAt time.Time `json:"changed_at"`
 }
 
 // NewLinkEntity -
 func NewLinkEntity(originalURL string, uid string) LinkEntity {
+	now := time.Now().UTC()
 	return LinkEntity{
 		ID:          random.String(8),
 		OriginalURL: originalURL,
 		UID:         uid,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// DedupURL возвращает ссылку, по которой ищутся дубликаты.
+// Для ссылок, сохраненных до появления канонизации, это OriginalURL
+func (e LinkEntity) DedupURL() string {
+	if e.CanonicalURL != "" {
+		return e.CanonicalURL
+	}
+	return e.OriginalURL
+}
+
+// IsProtected возвращает true, если для перехода по ссылке нужен пароль
+func (e LinkEntity) IsProtected() bool {
+	return e.PasswordHash != ""
+}
+
+// IsClickLimited возвращает true, если у ссылки ограничено количество переходов
+func (e LinkEntity) IsClickLimited() bool {
+	return e.MaxClicks > 0
+}
+
+// IsTargeted возвращает true, если адрес назначения зависит от посетителя
+func (e LinkEntity) IsTargeted() bool {
+	return len(e.Targeting) > 0 || len(e.Variants) > 0
+}
+
+// IsScheduled возвращает true, если ссылка работает только в заданное время
+func (e LinkEntity) IsScheduled() bool {
+	return e.NotBefore != nil || e.NotAfter != nil
+}
+
+// HasTag возвращает true, если ссылка помечена тегом tag
+func (e LinkEntity) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
 	}
+	return false
+}
+
+// ClicksExhausted возвращает true, если переходы по ссылке закончились
+func (e LinkEntity) ClicksExhausted() bool {
+	return e.IsClickLimited() && e.Clicks >= e.MaxClicks
+}
+
+// IsExpired возвращает true, если к моменту now у ссылки прошел NotAfter или закончились переходы
+func (e LinkEntity) IsExpired(now time.Time) bool {
+	return (e.NotAfter != nil && !now.Before(*e.NotAfter)) || e.ClicksExhausted()
+}
+
+// Deduplicable возвращает true, если ссылка участвует в поиске дубликатов.
+// Защищенные паролем, ограниченные по переходам, настроенные владельцем и общие ссылки пространств
+// всегда создаются заново:
+// иначе пароль, лимит или настройки получила бы чужая публичная ссылка, или, наоборот,
+// вместо публичной ссылки вернулась бы чужая закрытая, одноразовая или ведущая себя иначе
+func (e LinkEntity) Deduplicable() bool {
+	return !e.IsProtected() && !e.IsClickLimited() && !e.isCustomized() && e.IsPersonal()
+}
+
+// IsPersonal возвращает true, если ссылка не принадлежит рабочему пространству и ей управляет только создатель
+func (e LinkEntity) IsPersonal() bool {
+	return e.WorkspaceID == ""
+}
+
+// isCustomized возвращает true, если владелец настроил оформление ссылки, описал ее или поведение при переходе
+func (e LinkEntity) isCustomized() bool {
+	return e.Title != "" || e.Notes != "" || len(e.Tags) > 0 || e.GroupID != "" || e.Interstitial || e.RedirectCode != 0 ||
+		e.PassQuery || e.PassPath || e.QueryMerge != "" || e.UTM != nil || e.IsTargeted() || e.IsScheduled()
 }
 
 // IsOwnedByUserAndExists возвращает true,
@@ -37,3 +37,22 @@ func TestLinkEntity_IsOwnedByUserAndExists(t *testing.T) {
 	assert.False(t, entity.IsOwnedByUserAndExists("123"))
 	assert.False(t, entity.IsOwnedByUserAndExists("100500"))
 }
+
+func TestLinkEntity_DedupURL(t *testing.T) {
+	entity := LinkEntity{
+		OriginalURL: "HTTP://Ya.ru",
+	}
+	assert.Equal(t, "HTTP://Ya.ru", entity.DedupURL())
+
+	entity.CanonicalURL = "http://ya.ru/"
+	assert.Equal(t, "http://ya.ru/", entity.DedupURL())
+}
+
+func TestLinkEntity_HasTag(t *testing.T) {
+	entity := LinkEntity{
+		Tags: []string{"news", "promo"},
+	}
+	assert.True(t, entity.HasTag("promo"))
+	assert.False(t, entity.HasTag("prom"))
+	assert.False(t, LinkEntity{}.HasTag("news"))
+}
@@ -0,0 +1,16 @@
+package entity
+
+// TargetRule правило выбора адреса назначения по устройству и местоположению посетителя.
+// Правило срабатывает, если выполнены все его условия. Пустое условие подходит любому посетителю
+type TargetRule struct {
+	// Platforms операционные системы: ios, android, windows, macos, linux
+	Platforms []string `json:"platforms,omitempty"`
+	// Devices типы устройств: mobile, tablet, desktop
+	Devices []string `json:"devices,omitempty"`
+	// Languages языки из Accept-Language: en подходит и для en-US, en-us - только для en-US
+	Languages []string `json:"languages,omitempty"`
+	// Countries двухбуквенные коды стран ISO 3166-1
+	Countries []string `json:"countries,omitempty"`
+	// URL адрес назначения для посетителей, которым подошло правило
+	URL string `json:"url"`
+}
@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+// Transfer передача ссылок другому пользователю по одноразовому токену.
+// Сам токен не хранится: запись ищется по его хешу. После использования запись остается для аудита
+type Transfer struct {
+	// TokenHash хеш токена передачи
+	TokenHash string `json:"token_hash"`
+	// FromUID пользователь, который передает ссылки
+	FromUID string `json:"from_uid"`
+	// LinkIDs передаваемые ссылки
+	LinkIDs []string `json:"link_ids,omitempty"`
+	// CreatedAt время создания токена
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt после этого момента токен не действует
+	ExpiresAt time.Time `json:"expires_at"`
+	// ToUID пользователь, который использовал токен и получил ссылки. Пустой - токен не использован
+	ToUID string `json:"to_uid,omitempty"`
+	// RedeemedAt время использования токена
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty"`
+	// TransferredIDs ссылки, которые фактически перешли к ToUID
+	TransferredIDs []string `json:"transferred_ids,omitempty"`
+}
+
+// IsRedeemed возвращает true, если токен уже использован
+func (t Transfer) IsRedeemed() bool {
+	return t.RedeemedAt != nil
+}
+
+// IsExpired возвращает true, если к моменту now токен перестал действовать
+func (t Transfer) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
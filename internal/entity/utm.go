@@ -0,0 +1,45 @@
+package entity
+
+import "net/url"
+
+// UTMParams UTM разметка ссылки. Параметры добавляются к адресу назначения при переходе,
+// поэтому их можно менять, не трогая сам адрес
+type UTMParams struct {
+	// Source источник трафика, utm_source
+	Source string `json:"utm_source,omitempty"`
+	// Medium тип трафика, utm_medium
+	Medium string `json:"utm_medium,omitempty"`
+	// Campaign название кампании, utm_campaign
+	Campaign string `json:"utm_campaign,omitempty"`
+	// Term ключевое слово, utm_term
+	Term string `json:"utm_term,omitempty"`
+	// Content вариант объявления, utm_content
+	Content string `json:"utm_content,omitempty"`
+	// Extra произвольные дополнительные параметры
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// IsZero возвращает true, если не задан ни один параметр
+func (p UTMParams) IsZero() bool {
+	return len(p.Values()) == 0
+}
+
+// Values возвращает заданные параметры в виде параметров запроса
+func (p UTMParams) Values() url.Values {
+	values := make(url.Values)
+	for key, value := range map[string]string{
+		"utm_source":   p.Source,
+		"utm_medium":   p.Medium,
+		"utm_campaign": p.Campaign,
+		"utm_term":     p.Term,
+		"utm_content":  p.Content,
+	} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	for key, value := range p.Extra {
+		values.Set(key, value)
+	}
+	return values
+}
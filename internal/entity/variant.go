@@ -0,0 +1,12 @@
+package entity
+
+// Variant вариант адреса назначения в A/B эксперименте. Посетители распределяются по вариантам
+// пропорционально весам, выбранный вариант запоминается за посетителем
+type Variant struct {
+	// Name имя варианта, по нему ведется статистика переходов и запоминается выбор посетителя
+	Name string `json:"name"`
+	// URL адрес назначения варианта
+	URL string `json:"url"`
+	// Weight относительный вес варианта. Вариант с нулевым весом новым посетителям не выпадает
+	Weight int `json:"weight"`
+}
@@ -0,0 +1,64 @@
+package entity
+
+import "time"
+
+// Role роль участника рабочего пространства
+type Role string
+
+const (
+	// RoleOwner владелец: управляет участниками и ссылками пространства
+	RoleOwner Role = "owner"
+	// RoleEditor редактор: создает, изменяет и удаляет ссылки пространства
+	RoleEditor Role = "editor"
+	// RoleViewer читатель: видит ссылки пространства и их статистику
+	RoleViewer Role = "viewer"
+)
+
+// IsValid возвращает true, если роль известна
+func (r Role) IsValid() bool {
+	return r == RoleOwner || r == RoleEditor || r == RoleViewer
+}
+
+// CanView возвращает true, если участнику с ролью видны ссылки пространства
+func (r Role) CanView() bool {
+	return r.IsValid()
+}
+
+// CanEdit возвращает true, если участник с ролью может создавать, изменять и удалять ссылки пространства
+func (r Role) CanEdit() bool {
+	return r == RoleOwner || r == RoleEditor
+}
+
+// CanManage возвращает true, если участник с ролью может управлять участниками пространства
+func (r Role) CanManage() bool {
+	return r == RoleOwner
+}
+
+// Workspace рабочее пространство: общие ссылки команды пользователей
+type Workspace struct {
+	// ID идентификатор пространства
+	ID string `json:"id"`
+	// Name название пространства
+	Name string `json:"name"`
+	// CreatedAt время создания пространства
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WorkspaceMember участник рабочего пространства
+type WorkspaceMember struct {
+	// WorkspaceID пространство
+	WorkspaceID string `json:"workspace_id"`
+	// UID пользователь
+	UID string `json:"uid"`
+	// Role роль пользователя в пространстве
+	Role Role `json:"role"`
+	// AddedAt когда пользователь получил текущую роль
+	AddedAt time.Time `json:"added_at"`
+}
+
+// WorkspaceMembership рабочее пространство и роль в нем пользователя
+type WorkspaceMembership struct {
+	Workspace
+	// Role роль пользователя в пространстве
+	Role Role
+}
@@ -1,19 +1,60 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 )
 
+// ErrQuotaExceeded сохранение ссылки превысит ограничение на количество активных ссылок пользователя
+var ErrQuotaExceeded = errors.New("links quota exceeded")
+
+// ErrLinkNotFound ссылки с таким идентификатором нет в хранилище
+var ErrLinkNotFound = errors.New("link not found")
+
+// ErrGroupNotFound группы ссылок с таким идентификатором нет в хранилище
+var ErrGroupNotFound = errors.New("group not found")
+
+// ErrWorkspaceNotFound рабочего пространства с таким идентификатором нет в хранилище
+var ErrWorkspaceNotFound = errors.New("workspace not found")
+
+// ErrMemberNotFound пользователь не состоит в рабочем пространстве
+var ErrMemberNotFound = errors.New("workspace member not found")
+
+// ErrLastOwner изменение оставит рабочее пространство без владельца
+var ErrLastOwner = errors.New("workspace must have an owner")
+
+// ErrTransferNotFound передачи ссылок с таким токеном нет в хранилище
+var ErrTransferNotFound = errors.New("transfer not found")
+
+// ErrTransferUnavailable токен передачи ссылок уже использован или истек
+var ErrTransferUnavailable = errors.New("transfer token is used or expired")
+
+// ErrTransferToSelf токен передачи ссылок пытается использовать тот, кто его создал
+var ErrTransferToSelf = errors.New("transfer token can't be redeemed by its creator")
+
+// ErrAPIKeyNotFound API ключа с таким хешем или идентификатором нет в хранилище
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// ErrClicksExhausted переходы по ссылке с ограничением MaxClicks закончились
+var ErrClicksExhausted = errors.New("link clicks exhausted")
+
+// ErrIDCollision не удалось подобрать свободный идентификатор ссылки или другой записи за maxIDAttempts попыток
+var ErrIDCollision = errors.New("can't find free id")
+
+// ErrIDTaken идентификатор новой записи уже занят другой записью того же вида
+var ErrIDTaken = errors.New("id is already taken")
+
 // LinkExistsError говорит о том, что в хранилище уже есть ссылка,
 // которую пытаются сократить повторно.
-// Содержит идентификатор короткой ссылки из хранилища
+// Содержит идентификатор короткой ссылки из хранилища и ее владельца
 type LinkExistsError struct {
-	LinkID string
-	err    error
+	LinkID   string
+	OwnerUID string
+	err      error
 }
 
-func NewLinkExistsError(linkID string) *LinkExistsError {
-	return &LinkExistsError{LinkID: linkID}
+func NewLinkExistsError(linkID string, ownerUID string) *LinkExistsError {
+	return &LinkExistsError{LinkID: linkID, OwnerUID: ownerUID}
 }
 
 func (e *LinkExistsError) Error() string {
@@ -23,3 +64,8 @@ func (e *LinkExistsError) Error() string {
 func (e *LinkExistsError) Unwrap() error {
 	return e.err
 }
+
+// IsOwnedByUser возвращает true, если ранее сохраненная ссылка принадлежит указанному пользователю
+func (e *LinkExistsError) IsOwnedByUser(uid string) bool {
+	return e.OwnerUID == uid
+}
@@ -4,164 +4,165 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"os"
-	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/zaz600/go-musthave-shortener/internal/entity"
 )
 
+// clicksFlushInterval как часто FileLinksRepository сохраняет счетчики переходов ссылок без ограничения переходов.
+// При аварийной остановке теряются переходы только за этот интервал
+const clicksFlushInterval = 5 * time.Second
+
+// FileLinksRepository хранит ссылки в памяти так же, как InMemoryLinksRepository,
+// но дописывает каждое изменение ссылки в файл. При старте состояние восстанавливается из файла.
+// Ссылки записываются в файл как есть, группы, рабочие пространства, их участники, передачи ссылок,
+// API ключи и счетчики переходов - отдельными записями fileRecord с заполненным metaRecord.
 type FileLinksRepository struct {
+	InMemoryLinksRepository
 	fileStoragePath string
 	file            *os.File
 	encoder         *json.Encoder
-	mu              *sync.RWMutex
-	cache           map[string]entity.LinkEntity
+	// done закрывается при Close и останавливает периодическое сохранение счетчиков переходов
+	done chan struct{}
+	// flushed закрывается, когда периодическое сохранение счетчиков остановилось
+	flushed chan struct{}
 }
 
-func NewFileLinksRepository(ctx context.Context, path string) (*FileLinksRepository, error) {
+func NewFileLinksRepository(ctx context.Context, path string, opts ...Option) (*FileLinksRepository, error) {
 	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
 		return nil, err
 	}
 
 	repo := &FileLinksRepository{
-		fileStoragePath: path,
-		file:            file,
-		encoder:         json.NewEncoder(file),
-
-		mu:    &sync.RWMutex{},
-		cache: make(map[string]entity.LinkEntity),
+		InMemoryLinksRepository: NewInMemoryLinksRepository(ctx, nil, opts...),
+		fileStoragePath:         path,
+		file:                    file,
+		encoder:                 json.NewEncoder(file),
+		done:                    make(chan struct{}),
+		flushed:                 make(chan struct{}),
 	}
+	repo.persist = repo.dump
+	repo.persistMeta = repo.dumpMeta
+	repo.dirtyClicks = make(map[string]struct{})
 
 	if err = repo.loadCache(ctx); err != nil {
 		return nil, err
 	}
+	go repo.flushClicksLoop()
 	return repo, nil
 }
 
-// Get достает по linkID из репозитория информацию по сокращенной ссылке entity.LinkEntity
-func (f *FileLinksRepository) Get(_ context.Context, linkID string) (*entity.LinkEntity, error) {
-	f.mu.RLock()
-	defer f.mu.RUnlock()
-
-	if e, ok := f.cache[linkID]; ok {
-		return &e, nil
-	}
-	return nil, fmt.Errorf("link with id '%s' not found", linkID)
-}
-
-// PutIfAbsent сохраняет в БД длинную ссылку, если такой там еще нет.
-// Если длинная ссылка есть в БД, выбрасывает исключение LinkExistsError с идентификатором ее короткой ссылки.
-func (f *FileLinksRepository) PutIfAbsent(_ context.Context, linkEntity entity.LinkEntity) (entity.LinkEntity, error) {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	for _, e := range f.cache {
-		if e.OriginalURL == linkEntity.OriginalURL {
-			return entity.LinkEntity{}, NewLinkExistsError(e.ID)
+// flushClicksLoop каждые clicksFlushInterval сохраняет изменившиеся счетчики переходов, пока не вызван Close
+func (f *FileLinksRepository) flushClicksLoop() {
+	defer close(f.flushed)
+	ticker := time.NewTicker(clicksFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			if err := f.flushClicks(); err != nil {
+				log.Warn().Err(err).Msg("can't save link clicks")
+			}
 		}
 	}
-
-	f.cache[linkEntity.ID] = linkEntity
-	if err := f.dump(linkEntity); err != nil {
-		return entity.LinkEntity{}, err
-	}
-	return linkEntity, nil
 }
 
-// PutBatch сохраняет в хранилище список сокращенных ссылок. Все ссылки записываются в одной транзакции.
-func (f *FileLinksRepository) PutBatch(_ context.Context, linkEntities []entity.LinkEntity) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+// dump сохраняет длинную ссылку и ее идентификатор в файл
+func (f *FileLinksRepository) dump(item entity.LinkEntity) error {
+	defer func(file *os.File) {
+		_ = file.Sync()
+	}(f.file)
 
-	for _, linkEntity := range linkEntities {
-		f.cache[linkEntity.ID] = linkEntity
-		if err := f.dump(linkEntity); err != nil {
-			return err
-		}
+	if err := f.encoder.Encode(item); err != nil {
+		return err
 	}
 	return nil
 }
 
-// Count возвращает количество записей в репозитории.
-func (f *FileLinksRepository) Count(_ context.Context) (int, error) {
-	return len(f.cache), nil
-}
-
-// FindLinksByUID возвращает ссылки по идентификатору пользователя
-func (f *FileLinksRepository) FindLinksByUID(_ context.Context, uid string) ([]entity.LinkEntity, error) {
-	result := make([]entity.LinkEntity, 0, 100)
-	for _, e := range f.cache {
-		if e.IsOwnedByUserAndExists(uid) {
-			result = append(result, e)
-		}
-	}
-	return result, nil
+// fileRecord запись файла хранилища: ссылка или, если заполнено одно из полей metaRecord,
+// группа ссылок, рабочее пространство, участник пространства, передача ссылок, API ключ или счетчики переходов.
+// Файлы, записанные до появления групп, содержат только ссылки
+type fileRecord struct {
+	entity.LinkEntity
+	metaRecord
 }
 
-// DeleteLinksByUID удаляет ссылки пользователя
-func (f *FileLinksRepository) DeleteLinksByUID(_ context.Context, uid string, linkIDs ...string) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-
-	for _, id := range linkIDs {
-		linkEntity, ok := f.cache[id]
-		if !ok {
-			// такого айди не в хранилище, пока просто его пропустим
-			continue
-		}
-		if !linkEntity.IsOwnedByUser(uid) {
-			// тут возможно надо обработать, что пытаются удалить чужой линк, но пока просто его пропустим
-			continue
-		}
-		linkEntity.Removed = true
-		f.cache[id] = linkEntity
-		if err := f.dump(linkEntity); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// dump сохраняет длинную ссылку и ее идентификатор в файл
-func (f *FileLinksRepository) dump(item entity.LinkEntity) error {
+// dumpMeta сохраняет группу ссылок, рабочее пространство, участника пространства, передачу ссылок,
+// API ключ или счетчики переходов в файл
+func (f *FileLinksRepository) dumpMeta(record metaRecord) error {
 	defer func(file *os.File) {
 		_ = file.Sync()
 	}(f.file)
 
-	if err := f.encoder.Encode(item); err != nil {
-		return err
-	}
-	return nil
+	// пустые поля ссылки в такой записи не нужны
+	return f.encoder.Encode(record)
 }
 
 // loadCache загружает кеш из файла
 func (f *FileLinksRepository) loadCache(ctx context.Context) error {
 	decoder := json.NewDecoder(f.file)
 	for {
-		e := entity.LinkEntity{}
-		if err := decoder.Decode(&e); err != nil {
+		record := fileRecord{}
+		if err := decoder.Decode(&record); err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
 			return err
 		}
-		f.cache[e.ID] = e
+		switch {
+		case record.Group != nil:
+			f.groups[record.Group.ID] = *record.Group
+			continue
+		case record.Workspace != nil:
+			f.workspaces[record.Workspace.ID] = *record.Workspace
+			// новое пространство записывается вместе с владельцем
+			if record.Member != nil {
+				f.storeMember(*record.Member)
+			}
+			continue
+		case record.Member != nil:
+			f.storeMember(*record.Member)
+			continue
+		case record.Transfer != nil:
+			// использованная передача записывается повторно и заменяет исходную
+			f.transfers[record.Transfer.TokenHash] = *record.Transfer
+			continue
+		case record.APIKey != nil:
+			// отозванный ключ записывается повторно и заменяет исходный
+			f.apiKeys[record.APIKey.KeyHash] = *record.APIKey
+			continue
+		case len(record.ClickCounters) > 0:
+			f.storeClicks(record.ClickCounters)
+			continue
+		}
+		e := record.LinkEntity
+		// в файлах, записанных до появления времени изменения, его нет
+		if e.UpdatedAt.IsZero() {
+			e.UpdatedAt = e.CreatedAt
+		}
+		// ссылки, записанные до появления канонизации, приводятся к каноническому виду при загрузке
+		if e.CanonicalURL == "" {
+			e.CanonicalURL, _ = f.opts.legacyCanonicalURL(e)
+		}
+		f.store(e)
 	}
 	count, _ := f.Count(ctx)
 	log.Info().Msgf("load %d records from storage", count)
 	return nil
 }
 
-// Status статус подключения к хранилищу
-func (f *FileLinksRepository) Status(_ context.Context) error {
-	return nil
-}
-
-// Close закрывает, все, что надо закрыть
+// Close сохраняет несохраненные счетчики переходов и закрывает файл
 func (f *FileLinksRepository) Close(_ context.Context) error {
+	close(f.done)
+	<-f.flushed
+	if err := f.flushClicks(); err != nil {
+		log.Warn().Err(err).Msg("can't save link clicks")
+	}
 	return f.file.Close()
 }
@@ -3,7 +3,10 @@ package repository
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/zaz600/go-musthave-shortener/internal/entity"
 )
@@ -11,16 +14,80 @@ import (
 type InMemoryLinksRepository struct {
 	mu *sync.RWMutex
 	db map[string]entity.LinkEntity
+	// byUID идентификаторы ссылок каждого пользователя, чтобы не перебирать все ссылки хранилища
+	byUID map[string]map[string]struct{}
+	// byWorkspace идентификаторы ссылок каждого рабочего пространства
+	byWorkspace map[string]map[string]struct{}
+	// groups группы ссылок по идентификаторам
+	groups map[string]entity.Group
+	// workspaces рабочие пространства по идентификаторам
+	workspaces map[string]entity.Workspace
+	// members участники рабочих пространств: идентификатор пространства -> uid -> участник
+	members map[string]map[string]entity.WorkspaceMember
+	// transfers передачи ссылок по хешам токенов
+	transfers map[string]entity.Transfer
+	// apiKeys API ключи по хешам
+	apiKeys map[string]entity.APIKey
+	opts    options
+	// persist вызывается под блокировкой перед каждым изменением ссылки в db.
+	// FileLinksRepository через него сохраняет изменения на диск
+	persist func(e entity.LinkEntity) error
+	// persistMeta вызывается под блокировкой перед сохранением группы, пространства, участника,
+	// передачи ссылок, API ключа или счетчиков переходов
+	persistMeta func(record metaRecord) error
+	// dirtyClicks ссылки без ограничения переходов, счетчики которых изменились после последнего flushClicks.
+	// nil - счетчики сохранять не нужно
+	dirtyClicks map[string]struct{}
 }
 
-func NewInMemoryLinksRepository(_ context.Context, db map[string]entity.LinkEntity) InMemoryLinksRepository {
+// metaRecord изменение данных хранилища помимо ссылок. Заполнено одно из полей.
+// Участник с пустой ролью означает, что его исключили из пространства
+type metaRecord struct {
+	Group     *entity.Group           `json:"group,omitempty"`
+	Workspace *entity.Workspace       `json:"workspace,omitempty"`
+	Member    *entity.WorkspaceMember `json:"member,omitempty"`
+	Transfer  *entity.Transfer        `json:"transfer,omitempty"`
+	APIKey    *entity.APIKey          `json:"api_key,omitempty"`
+	// ClickCounters счетчики переходов ссылок по идентификаторам
+	ClickCounters map[string]clickCounters `json:"click_counters,omitempty"`
+}
+
+// clickCounters счетчики переходов ссылки, которые сохраняются отдельно от самой ссылки
+type clickCounters struct {
+	Clicks        int            `json:"clicks"`
+	VariantClicks map[string]int `json:"variant_clicks,omitempty"`
+}
+
+func NewInMemoryLinksRepository(_ context.Context, db map[string]entity.LinkEntity, opts ...Option) InMemoryLinksRepository {
 	if db == nil {
 		db = make(map[string]entity.LinkEntity)
 	}
-	return InMemoryLinksRepository{
-		mu: &sync.RWMutex{},
-		db: db,
+	m := InMemoryLinksRepository{
+		mu:          &sync.RWMutex{},
+		db:          db,
+		byUID:       make(map[string]map[string]struct{}),
+		byWorkspace: make(map[string]map[string]struct{}),
+		groups:      make(map[string]entity.Group),
+		workspaces:  make(map[string]entity.Workspace),
+		members:     make(map[string]map[string]entity.WorkspaceMember),
+		transfers:   make(map[string]entity.Transfer),
+		apiKeys:     make(map[string]entity.APIKey),
+		opts:        newOptions(opts),
+		persist: func(entity.LinkEntity) error {
+			return nil
+		},
+		persistMeta: func(metaRecord) error {
+			return nil
+		},
+	}
+	for id, e := range db {
+		if e.CanonicalURL == "" {
+			e.CanonicalURL, _ = m.opts.legacyCanonicalURL(e)
+			db[id] = e
+		}
+		m.index(e)
 	}
+	return m
 }
 
 // Get достает по linkID из репозитория информацию по сокращенной ссылке entity.LinkEntity
@@ -31,68 +98,799 @@ func (m InMemoryLinksRepository) Get(_ context.Context, linkID string) (*entity.
 	if e, ok := m.db[linkID]; ok {
 		return &e, nil
 	}
-	return nil, fmt.Errorf("link with id '%s' not found", linkID)
+	return nil, fmt.Errorf("link with id '%s': %w", linkID, ErrLinkNotFound)
 }
 
 // PutIfAbsent сохраняет в БД длинную ссылку, если такой там еще нет.
 // Если длинная ссылка есть в БД, выбрасывает исключение LinkExistsError с идентификатором ее короткой ссылки.
+// Если идентификатор ссылки уже занят, ссылке подбирается новый. Возвращается сохраненная ссылка.
 func (m InMemoryLinksRepository) PutIfAbsent(_ context.Context, linkEntity entity.LinkEntity) (entity.LinkEntity, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for _, e := range m.db {
-		if e.OriginalURL == linkEntity.OriginalURL {
-			return entity.LinkEntity{}, NewLinkExistsError(e.ID)
+		if m.opts.isDuplicate(e, linkEntity) {
+			return entity.LinkEntity{}, NewLinkExistsError(e.ID, e.UID)
 		}
 	}
 
-	m.db[linkEntity.ID] = linkEntity
+	if err := m.checkQuota(map[string]int{linkEntity.UID: 1}); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	if err := m.assignID(&linkEntity, nil); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	stampCreated(&linkEntity, time.Now().UTC())
+	if err := m.persist(linkEntity); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	m.store(linkEntity)
 	return linkEntity, nil
 }
 
 // PutBatch сохраняет в хранилище список сокращенных ссылок. Все ссылки записываются в одной транзакции.
-func (m InMemoryLinksRepository) PutBatch(_ context.Context, linkEntities []entity.LinkEntity) error {
+// Занятые идентификаторы заменяются новыми. Возвращаются сохраненные ссылки в исходном порядке.
+func (m InMemoryLinksRepository) PutBatch(_ context.Context, linkEntities []entity.LinkEntity) ([]entity.LinkEntity, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+
+	added := make(map[string]int)
 	for _, e := range linkEntities {
-		m.db[e.ID] = e
+		added[e.UID]++
+	}
+	if err := m.checkQuota(added); err != nil {
+		return nil, err
+	}
+	result := make([]entity.LinkEntity, len(linkEntities))
+	taken := make(map[string]bool, len(linkEntities))
+	now := time.Now().UTC()
+	for i := range linkEntities {
+		e := linkEntities[i]
+		if err := m.assignID(&e, taken); err != nil {
+			return nil, err
+		}
+		stampCreated(&e, now)
+		taken[e.ID] = true
+		result[i] = e
+	}
+	for _, e := range result {
+		if err := m.persist(e); err != nil {
+			return nil, err
+		}
+		m.store(e)
+	}
+	return result, nil
+}
+
+// UpdateLink сохраняет изменяемые поля ссылки. Если адрес изменился, прежний добавляется в историю
+func (m InMemoryLinksRepository) UpdateLink(_ context.Context, linkEntity entity.LinkEntity) (entity.LinkEntity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.db[linkEntity.ID]
+	if !ok {
+		return entity.LinkEntity{}, fmt.Errorf("link with id '%s': %w", linkEntity.ID, ErrLinkNotFound)
+	}
+	for _, e := range m.db {
+		if e.ID != linkEntity.ID && m.opts.isDuplicate(e, linkEntity) {
+			return entity.LinkEntity{}, NewLinkExistsError(e.ID, e.UID)
+		}
+	}
+
+	now := time.Now().UTC()
+	if stored.OriginalURL != linkEntity.OriginalURL {
+		stored.Revisions = append(stored.Revisions, entity.LinkRevision{
+			OriginalURL: stored.OriginalURL,
+			ChangedAt:   now,
+		})
+	}
+	stored.OriginalURL = linkEntity.OriginalURL
+	stored.CanonicalURL = linkEntity.CanonicalURL
+	stored.PasswordHash = linkEntity.PasswordHash
+	stored.MaxClicks = linkEntity.MaxClicks
+	stored.Title = linkEntity.Title
+	stored.Notes = linkEntity.Notes
+	stored.Tags = linkEntity.Tags
+	stored.GroupID = linkEntity.GroupID
+	stored.Interstitial = linkEntity.Interstitial
+	stored.RedirectCode = linkEntity.RedirectCode
+	stored.PassQuery = linkEntity.PassQuery
+	stored.PassPath = linkEntity.PassPath
+	stored.QueryMerge = linkEntity.QueryMerge
+	stored.UTM = linkEntity.UTM
+	stored.Targeting = linkEntity.Targeting
+	stored.Variants = linkEntity.Variants
+	stored.NotBefore = linkEntity.NotBefore
+	stored.NotAfter = linkEntity.NotAfter
+	stored.InactiveURL = linkEntity.InactiveURL
+	stored.UpdatedAt = now
+	if err := m.persist(stored); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	m.store(stored)
+	return stored, nil
+}
+
+// FindLinkRevisions возвращает историю адресов ссылки, от старых к новым
+func (m InMemoryLinksRepository) FindLinkRevisions(_ context.Context, linkID string) ([]entity.LinkRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.db[linkID]
+	if !ok {
+		return nil, fmt.Errorf("link with id '%s': %w", linkID, ErrLinkNotFound)
+	}
+	result := make([]entity.LinkRevision, len(e.Revisions))
+	copy(result, e.Revisions)
+	return result, nil
+}
+
+// ConsumeClick атомарно засчитывает переход по ссылке с учетом ограничения MaxClicks.
+// Если переходы закончились, возвращает ErrClicksExhausted
+func (m InMemoryLinksRepository) ConsumeClick(_ context.Context, linkID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.db[linkID]
+	if !ok {
+		return fmt.Errorf("link with id '%s': %w", linkID, ErrLinkNotFound)
+	}
+	if e.ClicksExhausted() {
+		return ErrClicksExhausted
+	}
+	e.Clicks++
+	if err := m.persistClicks(e); err != nil {
+		return err
+	}
+	m.store(e)
+	return nil
+}
+
+// persistClicks сохраняет изменившиеся счетчики переходов ссылки. Ссылка с ограничением переходов сохраняется сразу,
+// иначе после рестарта лимит можно было бы обойти. Счетчики остальных ссылок только отмечаются и сохраняются
+// пачкой в flushClicks, чтобы переходы не ждали записи на диск и не раздували хранилище копиями ссылки
+func (m InMemoryLinksRepository) persistClicks(e entity.LinkEntity) error {
+	if e.IsClickLimited() {
+		return m.persist(e)
+	}
+	if m.dirtyClicks != nil {
+		m.dirtyClicks[e.ID] = struct{}{}
+	}
+	return nil
+}
+
+// flushClicks сохраняет одной записью счетчики переходов, отмеченные persistClicks
+func (m InMemoryLinksRepository) flushClicks() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.dirtyClicks) == 0 {
+		return nil
+	}
+	counters := make(map[string]clickCounters, len(m.dirtyClicks))
+	for id := range m.dirtyClicks {
+		e := m.db[id]
+		counters[id] = clickCounters{Clicks: e.Clicks, VariantClicks: e.VariantClicks}
+	}
+	if err := m.persistMeta(metaRecord{ClickCounters: counters}); err != nil {
+		return err
+	}
+	for id := range counters {
+		delete(m.dirtyClicks, id)
 	}
 	return nil
 }
 
+// storeClicks применяет счетчики переходов, сохраненные flushClicks
+func (m InMemoryLinksRepository) storeClicks(counters map[string]clickCounters) {
+	for id, c := range counters {
+		if e, ok := m.db[id]; ok {
+			e.Clicks = c.Clicks
+			e.VariantClicks = c.VariantClicks
+			m.db[id] = e
+		}
+	}
+}
+
+// AddVariantClick засчитывает переход по варианту variant ссылки linkID
+func (m InMemoryLinksRepository) AddVariantClick(_ context.Context, linkID string, variant string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.db[linkID]
+	if !ok {
+		return fmt.Errorf("link with id '%s': %w", linkID, ErrLinkNotFound)
+	}
+	// счетчики копируются: прежнюю карту могут читать копии ссылки, выданные раньше
+	clicks := make(map[string]int, len(e.VariantClicks)+1)
+	for name, count := range e.VariantClicks {
+		clicks[name] = count
+	}
+	clicks[variant]++
+	e.VariantClicks = clicks
+	if err := m.persistClicks(e); err != nil {
+		return err
+	}
+	m.store(e)
+	return nil
+}
+
 // Count возвращает количество записей в репозитории.
 func (m InMemoryLinksRepository) Count(_ context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	return len(m.db), nil
 }
 
-// FindLinksByUID возвращает ссылки по идентификатору пользователя
-func (m InMemoryLinksRepository) FindLinksByUID(_ context.Context, uid string) ([]entity.LinkEntity, error) {
-	result := make([]entity.LinkEntity, 0, 100)
-	for _, e := range m.db {
-		if e.IsOwnedByUserAndExists(uid) {
-			result = append(result, e)
+// CountLinksByUID возвращает количество активных (не удаленных) ссылок пользователя
+func (m InMemoryLinksRepository) CountLinksByUID(_ context.Context, uid string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.countLinksByUID(uid), nil
+}
+
+// FindLinksByUID возвращает страницу личных ссылок пользователя или ссылок пространства opts.WorkspaceID
+// с заданными статусом и порядком. Перебираются только ссылки пользователя или пространства
+func (m InMemoryLinksRepository) FindLinksByUID(_ context.Context, uid string, opts LinkListOptions) (LinkPage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := opts.now()
+	ids := m.byUID[uid]
+	if opts.WorkspaceID != "" {
+		ids = m.byWorkspace[opts.WorkspaceID]
+	}
+	links := make([]entity.LinkEntity, 0, len(ids))
+	for id := range ids {
+		e := m.db[id]
+		if opts.WorkspaceID == "" && !e.IsPersonal() {
+			continue
+		}
+		if !matchStatus(e, opts.Status, now) || (opts.GroupID != "" && e.GroupID != opts.GroupID) {
+			continue
+		}
+		if opts.After == nil || linkAfter(e, *opts.After, opts.Sort) {
+			links = append(links, e)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return linkAfter(links[j], *newLinkCursor(links[i]), opts.Sort)
+	})
+
+	if opts.Limit > 0 && len(links) > opts.Limit {
+		links = links[:opts.Limit]
+		return LinkPage{Links: links, Next: newLinkCursor(links[len(links)-1])}, nil
+	}
+	return LinkPage{Links: links}, nil
+}
+
+// SearchLinks возвращает не удаленные ссылки пользователя, подходящие под все условия filter, от новых к старым.
+// Перебираются только ссылки пользователя
+func (m InMemoryLinksRepository) SearchLinks(_ context.Context, uid string, filter LinkFilter) ([]entity.LinkEntity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	query := strings.ToLower(filter.Query)
+	result := make([]entity.LinkEntity, 0)
+	for id := range m.byUID[uid] {
+		e := m.db[id]
+		if e.Removed || !e.IsPersonal() || (filter.Tag != "" && !e.HasTag(filter.Tag)) {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(e.OriginalURL), query) &&
+			!strings.Contains(strings.ToLower(e.Title), query) {
+			continue
+		}
+		if !filter.CreatedFrom.IsZero() && e.CreatedAt.Before(filter.CreatedFrom) {
+			continue
+		}
+		if !filter.CreatedTo.IsZero() && !e.CreatedAt.Before(filter.CreatedTo) {
+			continue
 		}
+		result = append(result, e)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return linkAfter(result[j], *newLinkCursor(result[i]), SortByCreated)
+	})
 	return result, nil
 }
 
-// DeleteLinksByUID удаляет ссылки пользователя
-func (m InMemoryLinksRepository) DeleteLinksByUID(_ context.Context, uid string, linkIDs ...string) error {
+// PutGroup сохраняет новую группу ссылок
+func (m InMemoryLinksRepository) PutGroup(_ context.Context, group entity.Group) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for _, id := range linkIDs {
+	if _, ok := m.groups[group.ID]; ok {
+		return fmt.Errorf("group with id '%s': %w", group.ID, ErrIDTaken)
+	}
+	if err := m.persistMeta(metaRecord{Group: &group}); err != nil {
+		return err
+	}
+	m.groups[group.ID] = group
+	return nil
+}
+
+// GetGroup возвращает группу ссылок по идентификатору
+func (m InMemoryLinksRepository) GetGroup(_ context.Context, groupID string) (*entity.Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if group, ok := m.groups[groupID]; ok {
+		return &group, nil
+	}
+	return nil, fmt.Errorf("group with id '%s': %w", groupID, ErrGroupNotFound)
+}
+
+// FindGroupsByUID возвращает группы пользователя от старых к новым
+func (m InMemoryLinksRepository) FindGroupsByUID(_ context.Context, uid string) ([]entity.Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]entity.Group, 0)
+	for _, group := range m.groups {
+		if group.UID == uid {
+			result = append(result, group)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// GroupStats подсчитывает статистику по ссылкам группы. Перебираются только ссылки пользователя
+func (m InMemoryLinksRepository) GroupStats(_ context.Context, uid string, groupID string, now time.Time) (entity.GroupStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stats entity.GroupStats
+	for id := range m.byUID[uid] {
+		e := m.db[id]
+		if e.GroupID != groupID {
+			continue
+		}
+		stats.Clicks += e.Clicks
+		switch {
+		case e.Removed:
+			stats.Removed++
+		case e.IsExpired(now):
+			stats.Links++
+			stats.Expired++
+		default:
+			stats.Links++
+			stats.Active++
+		}
+	}
+	return stats, nil
+}
+
+// PutWorkspace сохраняет новое рабочее пространство вместе с его первым участником
+func (m InMemoryLinksRepository) PutWorkspace(_ context.Context, workspace entity.Workspace, owner entity.WorkspaceMember) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.workspaces[workspace.ID]; ok {
+		return fmt.Errorf("workspace with id '%s': %w", workspace.ID, ErrIDTaken)
+	}
+	// пространство и владелец пишутся одной записью, иначе при сбое осталось бы пространство без владельца
+	if err := m.persistMeta(metaRecord{Workspace: &workspace, Member: &owner}); err != nil {
+		return err
+	}
+	m.workspaces[workspace.ID] = workspace
+	m.storeMember(owner)
+	return nil
+}
+
+// GetWorkspace возвращает рабочее пространство по идентификатору
+func (m InMemoryLinksRepository) GetWorkspace(_ context.Context, workspaceID string) (*entity.Workspace, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if workspace, ok := m.workspaces[workspaceID]; ok {
+		return &workspace, nil
+	}
+	return nil, fmt.Errorf("workspace with id '%s': %w", workspaceID, ErrWorkspaceNotFound)
+}
+
+// FindWorkspacesByUID возвращает пространства, в которых состоит пользователь, от старых к новым
+func (m InMemoryLinksRepository) FindWorkspacesByUID(_ context.Context, uid string) ([]entity.WorkspaceMembership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]entity.WorkspaceMembership, 0)
+	for id, members := range m.members {
+		if member, ok := members[uid]; ok {
+			result = append(result, entity.WorkspaceMembership{Workspace: m.workspaces[id], Role: member.Role})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// GetWorkspaceMember возвращает участника пространства
+func (m InMemoryLinksRepository) GetWorkspaceMember(_ context.Context, workspaceID string, uid string) (*entity.WorkspaceMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if member, ok := m.members[workspaceID][uid]; ok {
+		return &member, nil
+	}
+	return nil, fmt.Errorf("user '%s' in workspace '%s': %w", uid, workspaceID, ErrMemberNotFound)
+}
+
+// FindWorkspaceMembers возвращает участников пространства в порядке добавления
+func (m InMemoryLinksRepository) FindWorkspaceMembers(_ context.Context, workspaceID string) ([]entity.WorkspaceMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]entity.WorkspaceMember, 0, len(m.members[workspaceID]))
+	for _, member := range m.members[workspaceID] {
+		result = append(result, member)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].AddedAt.Equal(result[j].AddedAt) {
+			return result[i].AddedAt.Before(result[j].AddedAt)
+		}
+		return result[i].UID < result[j].UID
+	})
+	return result, nil
+}
+
+// PutWorkspaceMember добавляет участника в пространство или меняет роль уже добавленного.
+// Последнего владельца понизить нельзя
+func (m InMemoryLinksRepository) PutWorkspaceMember(_ context.Context, member entity.WorkspaceMember) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if member.Role != entity.RoleOwner && m.isLastOwner(member.WorkspaceID, member.UID) {
+		return fmt.Errorf("user '%s' in workspace '%s': %w", member.UID, member.WorkspaceID, ErrLastOwner)
+	}
+	if err := m.persistMeta(metaRecord{Member: &member}); err != nil {
+		return err
+	}
+	m.storeMember(member)
+	return nil
+}
+
+// DeleteWorkspaceMember исключает пользователя из пространства
+func (m InMemoryLinksRepository) DeleteWorkspaceMember(_ context.Context, workspaceID string, uid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[workspaceID][uid]; !ok {
+		return fmt.Errorf("user '%s' in workspace '%s': %w", uid, workspaceID, ErrMemberNotFound)
+	}
+	if m.isLastOwner(workspaceID, uid) {
+		return fmt.Errorf("user '%s' in workspace '%s': %w", uid, workspaceID, ErrLastOwner)
+	}
+	removed := entity.WorkspaceMember{WorkspaceID: workspaceID, UID: uid}
+	if err := m.persistMeta(metaRecord{Member: &removed}); err != nil {
+		return err
+	}
+	m.storeMember(removed)
+	return nil
+}
+
+// isLastOwner возвращает true, если пользователь uid - единственный владелец пространства workspaceID.
+// Вызывается под блокировкой
+func (m InMemoryLinksRepository) isLastOwner(workspaceID string, uid string) bool {
+	if m.members[workspaceID][uid].Role != entity.RoleOwner {
+		return false
+	}
+	for _, member := range m.members[workspaceID] {
+		if member.Role == entity.RoleOwner && member.UID != uid {
+			return false
+		}
+	}
+	return true
+}
+
+// storeMember сохраняет участника пространства, а участника с пустой ролью исключает.
+// Вызывается под блокировкой
+func (m InMemoryLinksRepository) storeMember(member entity.WorkspaceMember) {
+	if member.Role == "" {
+		delete(m.members[member.WorkspaceID], member.UID)
+		return
+	}
+	members, ok := m.members[member.WorkspaceID]
+	if !ok {
+		members = make(map[string]entity.WorkspaceMember)
+		m.members[member.WorkspaceID] = members
+	}
+	members[member.UID] = member
+}
+
+// PutTransfer сохраняет новую передачу ссылок
+func (m InMemoryLinksRepository) PutTransfer(_ context.Context, transfer entity.Transfer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.persistMeta(metaRecord{Transfer: &transfer}); err != nil {
+		return err
+	}
+	m.transfers[transfer.TokenHash] = transfer
+	return nil
+}
+
+// RedeemTransfer передает пользователю uid ссылки передачи. Атомарность обеспечивает блокировка хранилища
+func (m InMemoryLinksRepository) RedeemTransfer(_ context.Context, tokenHash string, uid string, now time.Time) (entity.Transfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	transfer, ok := m.transfers[tokenHash]
+	switch {
+	case !ok:
+		return entity.Transfer{}, ErrTransferNotFound
+	case transfer.IsRedeemed() || transfer.IsExpired(now):
+		return entity.Transfer{}, ErrTransferUnavailable
+	case transfer.FromUID == uid:
+		return entity.Transfer{}, ErrTransferToSelf
+	}
+
+	moved := make([]entity.LinkEntity, 0, len(transfer.LinkIDs))
+	for _, id := range transfer.LinkIDs {
 		e, ok := m.db[id]
-		if !ok {
-			// такого айди не в хранилище, пока просто его пропустим
+		if !ok || e.UID != transfer.FromUID || !e.IsPersonal() || e.Removed {
+			continue
+		}
+		e.UID = uid
+		if m.duplicatesUserLink(e) {
+			continue
+		}
+		e.GroupID = ""
+		e.UpdatedAt = now.UTC()
+		moved = append(moved, e)
+	}
+	if err := m.checkQuota(map[string]int{uid: len(moved)}); err != nil {
+		return entity.Transfer{}, err
+	}
+
+	redeemedAt := now.UTC()
+	transfer.ToUID = uid
+	transfer.RedeemedAt = &redeemedAt
+	transfer.TransferredIDs = make([]string, 0, len(moved))
+	for _, e := range moved {
+		if err := m.persist(e); err != nil {
+			return entity.Transfer{}, err
+		}
+		m.store(e)
+		transfer.TransferredIDs = append(transfer.TransferredIDs, e.ID)
+	}
+	if err := m.persistMeta(metaRecord{Transfer: &transfer}); err != nil {
+		return entity.Transfer{}, err
+	}
+	m.transfers[tokenHash] = transfer
+	return transfer, nil
+}
+
+// duplicatesUserLink возвращает true, если ссылка дублирует другую ссылку своего владельца. Вызывается под блокировкой
+func (m InMemoryLinksRepository) duplicatesUserLink(e entity.LinkEntity) bool {
+	for id := range m.byUID[e.UID] {
+		if id != e.ID && m.opts.isDuplicate(m.db[id], e) {
+			return true
+		}
+	}
+	return false
+}
+
+// PutAPIKey сохраняет новый API ключ
+func (m InMemoryLinksRepository) PutAPIKey(_ context.Context, key entity.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.apiKeys {
+		if stored.ID == key.ID {
+			return fmt.Errorf("api key with id '%s': %w", key.ID, ErrIDTaken)
+		}
+	}
+	if err := m.persistMeta(metaRecord{APIKey: &key}); err != nil {
+		return err
+	}
+	m.apiKeys[key.KeyHash] = key
+	return nil
+}
+
+// GetAPIKeyByHash возвращает API ключ по хешу
+func (m InMemoryLinksRepository) GetAPIKeyByHash(_ context.Context, keyHash string) (*entity.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if key, ok := m.apiKeys[keyHash]; ok {
+		return &key, nil
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+// FindAPIKeysByUID возвращает API ключи пользователя от старых к новым
+func (m InMemoryLinksRepository) FindAPIKeysByUID(_ context.Context, uid string) ([]entity.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]entity.APIKey, 0)
+	for _, key := range m.apiKeys {
+		if key.UID == uid {
+			result = append(result, key)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// RevokeAPIKey отзывает API ключ пользователя
+func (m InMemoryLinksRepository) RevokeAPIKey(_ context.Context, uid string, keyID string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range m.apiKeys {
+		if key.ID != keyID || key.UID != uid {
 			continue
 		}
-		if !e.IsOwnedByUser(uid) {
-			// тут возможно надо обработать, что пытаются удалить чужой линк, но пока просто его пропустим
+		if key.IsRevoked() {
+			return nil
+		}
+		revokedAt := now.UTC()
+		key.RevokedAt = &revokedAt
+		if err := m.persistMeta(metaRecord{APIKey: &key}); err != nil {
+			return err
+		}
+		m.apiKeys[key.KeyHash] = key
+		return nil
+	}
+	return fmt.Errorf("api key with id '%s': %w", keyID, ErrAPIKeyNotFound)
+}
+
+// DeleteLinksByUID удаляет ссылки, которые пользователь uid вправе удалить
+func (m InMemoryLinksRepository) DeleteLinksByUID(_ context.Context, uid string, linkIDs ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, id := range linkIDs {
+		e, ok := m.db[id]
+		if !ok || e.Removed || !m.canDelete(uid, e) {
+			// такого айди нет в хранилище или ссылка чужая, пока просто его пропустим.
+			// Время удаления остается временем первого удаления
 			continue
 		}
 		e.Removed = true
-		m.db[id] = e
+		e.RemovedAt = &now
+		if err := m.persist(e); err != nil {
+			return err
+		}
+		m.store(e)
+	}
+	return nil
+}
+
+// canDelete возвращает true, если пользователь uid вправе удалить ссылку e: личную ссылку удаляет ее создатель,
+// ссылку пространства - его редакторы и владельцы. Вызывается под блокировкой
+func (m InMemoryLinksRepository) canDelete(uid string, e entity.LinkEntity) bool {
+	if e.IsPersonal() {
+		return e.IsOwnedByUser(uid)
+	}
+	return m.members[e.WorkspaceID][uid].Role.CanEdit()
+}
+
+// stampCreated заполняет время создания новой ссылки, если его не задали, и время изменения
+func stampCreated(e *entity.LinkEntity, now time.Time) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = now
+	}
+	if e.UpdatedAt.IsZero() {
+		e.UpdatedAt = e.CreatedAt
+	}
+}
+
+// matchStatus возвращает true, если ссылка попадает в список ссылок со статусом status
+func matchStatus(e entity.LinkEntity, status LinkStatus, now time.Time) bool {
+	switch status {
+	case StatusRemoved:
+		return e.Removed
+	case StatusActive:
+		return !e.Removed && !e.IsExpired(now)
+	case StatusExpired:
+		return !e.Removed && e.IsExpired(now)
+	default:
+		return !e.Removed
+	}
+}
+
+// linkAfter возвращает true, если в порядке sortBy ссылка e идет после позиции cursor
+func linkAfter(e entity.LinkEntity, cursor LinkCursor, sortBy LinkSort) bool {
+	if sortBy == SortByClicks {
+		if e.Clicks != cursor.Clicks {
+			return e.Clicks < cursor.Clicks
+		}
+	} else if !e.CreatedAt.Equal(cursor.CreatedAt) {
+		return e.CreatedAt.Before(cursor.CreatedAt)
+	}
+	return e.ID > cursor.ID
+}
+
+// assignID подбирает ссылке свободный идентификатор, если ее идентификатор пуст или уже занят.
+// taken - идентификаторы, занятые еще не сохраненными ссылками пачки. Вызывается под блокировкой
+func (m InMemoryLinksRepository) assignID(e *entity.LinkEntity, taken map[string]bool) error {
+	for attempt := 0; ; attempt++ {
+		if _, exists := m.db[e.ID]; e.ID != "" && !exists && !taken[e.ID] {
+			return nil
+		}
+		if attempt == maxIDAttempts {
+			return ErrIDCollision
+		}
+		id, err := m.opts.idGenerator.NewID()
+		if err != nil {
+			return err
+		}
+		e.ID = id
+	}
+}
+
+// countLinksByUID подсчитывает активные ссылки пользователя. Вызывается под блокировкой
+func (m InMemoryLinksRepository) countLinksByUID(uid string) int {
+	count := 0
+	for id := range m.byUID[uid] {
+		if !m.db[id].Removed {
+			count++
+		}
+	}
+	return count
+}
+
+// store сохраняет ссылку в db и индексы ссылок пользователя и пространства. Вызывается под блокировкой
+func (m InMemoryLinksRepository) store(e entity.LinkEntity) {
+	if stored, ok := m.db[e.ID]; ok {
+		if stored.UID != e.UID {
+			delete(m.byUID[stored.UID], e.ID)
+		}
+		if stored.WorkspaceID != e.WorkspaceID {
+			delete(m.byWorkspace[stored.WorkspaceID], e.ID)
+		}
+	}
+	m.db[e.ID] = e
+	m.index(e)
+}
+
+// index добавляет ссылку в индексы ссылок пользователя и пространства. Вызывается под блокировкой
+func (m InMemoryLinksRepository) index(e entity.LinkEntity) {
+	addToIndex(m.byUID, e.UID, e.ID)
+	if !e.IsPersonal() {
+		addToIndex(m.byWorkspace, e.WorkspaceID, e.ID)
+	}
+}
+
+// addToIndex добавляет идентификатор ссылки linkID в индекс под ключом key
+func addToIndex(index map[string]map[string]struct{}, key string, linkID string) {
+	ids, ok := index[key]
+	if !ok {
+		ids = make(map[string]struct{})
+		index[key] = ids
+	}
+	ids[linkID] = struct{}{}
+}
+
+// checkQuota проверяет, что пользователи не превысят квоту на ссылки,
+// если добавить им added[uid] ссылок. Вызывается под блокировкой
+func (m InMemoryLinksRepository) checkQuota(added map[string]int) error {
+	for uid, n := range added {
+		maxLinks := m.opts.maxLinks(uid)
+		if maxLinks > 0 && m.countLinksByUID(uid)+n > maxLinks {
+			return ErrQuotaExceeded
+		}
 	}
 	return nil
 }
@@ -2,43 +2,80 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/app/config"
 	"github.com/zaz600/go-musthave-shortener/internal/entity"
 )
 
+const (
+	// uniqueViolationCode код ошибки PG unique_violation
+	uniqueViolationCode = "23505"
+	// linkIDIndex уникальный индекс по коротким идентификаторам ссылок
+	linkIDIndex = "link_id_idx"
+	// linkColumns колонки ссылки в том порядке, в котором их читает scanLink
+	linkColumns = `uid, original_url, coalesce(canonical_url, ''), link_id, coalesce(password_hash, ''), max_clicks, clicks, removed,
+coalesce(title, ''), coalesce(notes, ''), tags, interstitial, redirect_code, pass_query, pass_path, coalesce(query_merge, ''), utm, targeting, variants,
+(select jsonb_object_agg(variant, clicks) from shortener.link_variant_clicks c where c.link_id = links.link_id),
+not_before, not_after, coalesce(inactive_url, ''), created_at, coalesce(updated_at, created_at), removed_at,
+coalesce(group_id, ''), coalesce(workspace_id, '')`
+)
+
 type PgLinksRepository struct {
 	conn           *pgx.Conn
+	opts           options
 	insertLinkStmt *pgconn.StatementDescription
 	removeLinkStmt *pgconn.StatementDescription
 }
 
-func NewPgLinksRepository(ctx context.Context, databaseDSN string) (*PgLinksRepository, error) {
+func NewPgLinksRepository(ctx context.Context, databaseDSN string, opts ...Option) (*PgLinksRepository, error) {
 	conn, err := pgx.Connect(ctx, databaseDSN)
 	if err != nil {
 		return nil, err
 	}
 	repo := PgLinksRepository{
 		conn: conn,
+		opts: newOptions(opts),
+	}
+	migrateCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	err = repo.migrate(migrateCtx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	// разовые миграции данных проходят по всей таблице ссылок и могут идти дольше миграции схемы
+	if err = repo.migrateData(ctx); err != nil {
+		return nil, err
 	}
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+
+	ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	err = repo.migrate(ctx)
-	if err != nil {
+	if err = repo.migrateDedupIndex(ctx); err != nil {
 		return nil, err
 	}
 
-	queryInsert := `insert into shortener.links(link_id, original_url, uid) values($1, $2, $3)`
+	queryInsert := `insert into shortener.links(link_id, original_url, uid, canonical_url, password_hash, max_clicks, title, interstitial,
+	redirect_code, pass_query, pass_path, query_merge, utm, targeting, variants, not_before, not_after, inactive_url, created_at,
+	notes, tags, group_id, workspace_id)
+values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)`
 	stmtInsert, err := conn.Prepare(ctx, "insert link", queryInsert)
 	if err != nil {
 		return nil, err
 	}
 	repo.insertLinkStmt = stmtInsert
 
-	queryRemove := `update shortener.links set removed=true where uid=$1 and link_id = any($2)`
+	queryRemove := `update shortener.links set removed=true, removed_at=$3 where link_id = any($1) and removed = false
+and ((workspace_id is null and uid = $2)
+	or workspace_id in (select workspace_id from shortener.workspace_members where uid = $2 and role = any($4)))`
 	stmtRemove, err := conn.Prepare(ctx, "remove links", queryRemove)
 	if err != nil {
 		return nil, err
@@ -50,10 +87,11 @@ func NewPgLinksRepository(ctx context.Context, databaseDSN string) (*PgLinksRepo
 
 // Get достает по linkID из БД информацию по сокращенной ссылке entity.LinkEntity
 func (p *PgLinksRepository) Get(ctx context.Context, linkID string) (*entity.LinkEntity, error) {
-	query := `select uid, original_url, link_id, removed  from shortener.links where link_id = $1`
-	var e entity.LinkEntity
-	result := p.conn.QueryRow(ctx, query, linkID)
-	err := result.Scan(&e.UID, &e.OriginalURL, &e.ID, &e.Removed)
+	query := `select ` + linkColumns + ` from shortener.links where link_id = $1`
+	e, err := scanLink(p.conn.QueryRow(ctx, query, linkID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("link with id '%s': %w", linkID, ErrLinkNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -62,48 +100,301 @@ func (p *PgLinksRepository) Get(ctx context.Context, linkID string) (*entity.Lin
 
 // PutIfAbsent сохраняет в БД длинную ссылку, если такой там еще нет.
 // Если длинная ссылка есть в БД, выбрасывает исключение LinkExistsError с идентификатором ее короткой ссылки.
+// Область поиска дубликатов определяется настройкой WithDedupScope.
+// Если новая ссылка превысит квоту пользователя, возвращает ErrQuotaExceeded.
+// Если идентификатор ссылки уже занят, ссылке подбирается новый. Возвращается сохраненная ссылка.
 func (p *PgLinksRepository) PutIfAbsent(ctx context.Context, linkEntity entity.LinkEntity) (entity.LinkEntity, error) {
-	query := `
-WITH new_link AS (
-    INSERT INTO shortener.links(link_id, original_url, uid) VALUES ($1, $2, $3)
-    ON CONFLICT(original_url) DO NOTHING
-    RETURNING link_id
-) SELECT COALESCE(
-    (SELECT link_id FROM new_link),
-    (SELECT link_id FROM shortener.links WHERE original_url = $2)
-);`
-	var linkID string
-	err := p.conn.QueryRow(ctx, query, linkEntity.ID, linkEntity.OriginalURL, linkEntity.UID).Scan(&linkID)
+	tx, err := p.conn.Begin(ctx)
 	if err != nil {
 		return entity.LinkEntity{}, err
 	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if err = p.lockQuota(ctx, tx, linkEntity.UID); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	if err = p.insertWithFreeID(ctx, tx, &linkEntity, p.insertIfAbsent); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	if err = p.checkQuota(ctx, tx, linkEntity.UID); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	return linkEntity, nil
+}
+
+// insertWithFreeID вставляет ссылку функцией insert, подбирая ей новый идентификатор, пока он занят.
+// Каждая попытка выполняется в точке сохранения, чтобы ошибка уникальности не прерывала транзакцию tx
+func (p *PgLinksRepository) insertWithFreeID(ctx context.Context, tx pgx.Tx, linkEntity *entity.LinkEntity,
+	insert func(ctx context.Context, tx pgx.Tx, linkEntity entity.LinkEntity) error) error {
+	for attempt := 0; ; attempt++ {
+		if linkEntity.ID == "" {
+			id, err := p.opts.idGenerator.NewID()
+			if err != nil {
+				return err
+			}
+			linkEntity.ID = id
+		}
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		err = insert(ctx, savepoint, *linkEntity)
+		if err == nil {
+			return savepoint.Commit(ctx)
+		}
+		_ = savepoint.Rollback(ctx)
+		if !isLinkIDCollision(err) {
+			return err
+		}
+		if attempt == maxIDAttempts {
+			return ErrIDCollision
+		}
+		linkEntity.ID = ""
+	}
+}
+
+// insertLink вставляет ссылку в рамках транзакции tx без поиска дубликатов
+func (p *PgLinksRepository) insertLink(ctx context.Context, tx pgx.Tx, linkEntity entity.LinkEntity) error {
+	_, err := tx.Exec(ctx, p.insertLinkStmt.Name, linkEntity.ID, linkEntity.OriginalURL, linkEntity.UID, canonicalURLValue(linkEntity),
+		passwordHashValue(linkEntity), linkEntity.MaxClicks, nullIfEmpty(linkEntity.Title), linkEntity.Interstitial, linkEntity.RedirectCode,
+		linkEntity.PassQuery, linkEntity.PassPath, nullIfEmpty(linkEntity.QueryMerge), utmValue(linkEntity), targetingValue(linkEntity),
+		variantsValue(linkEntity), timeValue(linkEntity.NotBefore), timeValue(linkEntity.NotAfter), nullIfEmpty(linkEntity.InactiveURL),
+		createdAtValue(linkEntity), nullIfEmpty(linkEntity.Notes), tagsValue(linkEntity), nullIfEmpty(linkEntity.GroupID),
+		nullIfEmpty(linkEntity.WorkspaceID))
+	return err
+}
+
+// insertIfAbsent вставляет ссылку в рамках транзакции tx с учетом dedupScope
+func (p *PgLinksRepository) insertIfAbsent(ctx context.Context, tx pgx.Tx, linkEntity entity.LinkEntity) error {
+	if p.opts.dedupScope == config.DedupNone || !linkEntity.Deduplicable() {
+		return p.insertLink(ctx, tx, linkEntity)
+	}
+
+	conflictTarget, duplicateCond := "canonical_url", "canonical_url = $4"
+	if p.opts.dedupScope == config.DedupPerUser {
+		conflictTarget, duplicateCond = "uid, canonical_url", "canonical_url = $4 AND uid = $3"
+	}
+	query := fmt.Sprintf(`
+WITH new_link AS (
+    INSERT INTO shortener.links(link_id, original_url, uid, canonical_url, created_at) VALUES ($1, $2, $3, $4, $5)
+    ON CONFLICT(%s) DO NOTHING
+    RETURNING link_id, uid
+)
+SELECT link_id, uid FROM new_link
+UNION ALL
+SELECT link_id, uid FROM shortener.links WHERE %s
+LIMIT 1;`, conflictTarget, duplicateCond)
+
+	var linkID, ownerUID string
+	err := tx.QueryRow(ctx, query, linkEntity.ID, linkEntity.OriginalURL, linkEntity.UID, linkEntity.DedupURL(), createdAtValue(linkEntity)).
+		Scan(&linkID, &ownerUID)
+	if err != nil {
+		return err
+	}
 	if linkEntity.ID != linkID {
 		// хотели положить в бд ссылку с одним коротким айди,
 		// а вернулся айди ранее сохкращеной ссылки
-		return entity.LinkEntity{}, NewLinkExistsError(linkID)
+		return NewLinkExistsError(linkID, ownerUID)
 	}
-	return linkEntity, nil
+	return nil
 }
 
 // PutBatch сохраняет в БД список сокращенных ссылок. Все ссылки записываются в одной транзакции.
-func (p *PgLinksRepository) PutBatch(ctx context.Context, linkEntities []entity.LinkEntity) error {
+// Если пачка превысит квоту пользователя, не сохраняется ничего и возвращается ErrQuotaExceeded.
+// Занятые идентификаторы заменяются новыми, возвращаются сохраненные ссылки в исходном порядке
+func (p *PgLinksRepository) PutBatch(ctx context.Context, linkEntities []entity.LinkEntity) ([]entity.LinkEntity, error) {
 	tx, err := p.conn.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback(ctx) //nolint:errcheck
 
+	uids := make([]string, 0, 1)
 	for _, e := range linkEntities {
-		if _, err = tx.Exec(ctx, p.insertLinkStmt.Name, e.ID, e.OriginalURL, e.UID); err != nil {
-			return err
+		if !containsString(uids, e.UID) {
+			uids = append(uids, e.UID)
+		}
+	}
+	// блокировки берутся в одном порядке, чтобы параллельные пачки не попали в deadlock
+	sort.Strings(uids)
+	for _, uid := range uids {
+		if err = p.lockQuota(ctx, tx, uid); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]entity.LinkEntity, len(linkEntities))
+	for i := range linkEntities {
+		e := linkEntities[i]
+		if err = p.insertWithFreeID(ctx, tx, &e, p.insertLink); err != nil {
+			return nil, err
+		}
+		result[i] = e
+	}
+	for _, uid := range uids {
+		if err = p.checkQuota(ctx, tx, uid); err != nil {
+			return nil, err
 		}
 	}
 	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// lockQuota сериализует до конца транзакции добавление ссылок пользователю, если у него есть квота.
+// Без блокировки параллельные транзакции могли бы вместе превысить квоту
+func (p *PgLinksRepository) lockQuota(ctx context.Context, tx pgx.Tx, uid string) error {
+	if p.opts.maxLinks(uid) <= 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtext($1))`, uid)
+	return err
+}
+
+// checkQuota проверяет, что с учетом вставленных в транзакции ссылок пользователь не превысил квоту
+func (p *PgLinksRepository) checkQuota(ctx context.Context, tx pgx.Tx, uid string) error {
+	maxLinks := p.opts.maxLinks(uid)
+	if maxLinks <= 0 {
+		return nil
+	}
+	var count int
+	err := tx.QueryRow(ctx, `select count(*) from shortener.links where uid=$1 and removed = false`, uid).Scan(&count)
+	if err != nil {
 		return err
 	}
+	if count > maxLinks {
+		return ErrQuotaExceeded
+	}
 	return nil
 }
 
+// UpdateLink сохраняет изменяемые поля ссылки. Если адрес изменился, прежний записывается в link_revisions
+func (p *PgLinksRepository) UpdateLink(ctx context.Context, linkEntity entity.LinkEntity) (entity.LinkEntity, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return entity.LinkEntity{}, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	var previousURL string
+	err = tx.QueryRow(ctx, `select original_url from shortener.links where link_id = $1 for update`, linkEntity.ID).Scan(&previousURL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.LinkEntity{}, fmt.Errorf("link with id '%s': %w", linkEntity.ID, ErrLinkNotFound)
+	}
+	if err != nil {
+		return entity.LinkEntity{}, err
+	}
+	if err = p.checkDuplicate(ctx, tx, linkEntity); err != nil {
+		return entity.LinkEntity{}, err
+	}
+
+	query := `
+update shortener.links
+set original_url = $2, canonical_url = $3, password_hash = $4, max_clicks = $5,
+    title = $6, interstitial = $7, redirect_code = $8, pass_query = $9, pass_path = $10, query_merge = $11,
+    utm = $12, targeting = $13, variants = $14, not_before = $15, not_after = $16, inactive_url = $17,
+    notes = $18, tags = $19, updated_at = $20, group_id = $21
+where link_id = $1
+returning ` + linkColumns
+	e, err := scanLink(tx.QueryRow(ctx, query, linkEntity.ID, linkEntity.OriginalURL, canonicalURLValue(linkEntity),
+		passwordHashValue(linkEntity), linkEntity.MaxClicks, nullIfEmpty(linkEntity.Title), linkEntity.Interstitial, linkEntity.RedirectCode,
+		linkEntity.PassQuery, linkEntity.PassPath, nullIfEmpty(linkEntity.QueryMerge), utmValue(linkEntity),
+		targetingValue(linkEntity), variantsValue(linkEntity), timeValue(linkEntity.NotBefore), timeValue(linkEntity.NotAfter),
+		nullIfEmpty(linkEntity.InactiveURL), nullIfEmpty(linkEntity.Notes), tagsValue(linkEntity), time.Now().UTC(),
+		nullIfEmpty(linkEntity.GroupID)))
+	if err != nil {
+		return entity.LinkEntity{}, err
+	}
+	if previousURL != linkEntity.OriginalURL {
+		_, err = tx.Exec(ctx, `insert into shortener.link_revisions(link_id, original_url) values($1, $2)`, linkEntity.ID, previousURL)
+		if err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	return e, nil
+}
+
+// checkDuplicate возвращает LinkExistsError, если адрес ссылки дублирует другую ссылку с учетом dedupScope
+func (p *PgLinksRepository) checkDuplicate(ctx context.Context, tx pgx.Tx, linkEntity entity.LinkEntity) error {
+	if p.opts.dedupScope == config.DedupNone || !linkEntity.Deduplicable() {
+		return nil
+	}
+	query := `select link_id, uid from shortener.links where canonical_url = $1 and link_id <> $2`
+	args := []interface{}{linkEntity.DedupURL(), linkEntity.ID}
+	if p.opts.dedupScope == config.DedupPerUser {
+		query += ` and uid = $3`
+		args = append(args, linkEntity.UID)
+	}
+	var linkID, ownerUID string
+	err := tx.QueryRow(ctx, query+` limit 1`, args...).Scan(&linkID, &ownerUID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return NewLinkExistsError(linkID, ownerUID)
+}
+
+// FindLinkRevisions возвращает историю адресов ссылки, от старых к новым
+func (p *PgLinksRepository) FindLinkRevisions(ctx context.Context, linkID string) ([]entity.LinkRevision, error) {
+	query := `select original_url, changed_at from shortener.link_revisions where link_id = $1 order by id`
+	rows, err := p.conn.Query(ctx, query, linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []entity.LinkRevision
+	for rows.Next() {
+		var revision entity.LinkRevision
+		if err = rows.Scan(&revision.OriginalURL, &revision.ChangedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, revision)
+	}
+	return result, rows.Err()
+}
+
+// ConsumeClick атомарно засчитывает переход по ссылке с учетом ограничения MaxClicks.
+// Проверка и увеличение счетчика выполняются одним update, поэтому параллельные переходы не превышают лимит
+func (p *PgLinksRepository) ConsumeClick(ctx context.Context, linkID string) error {
+	query := `update shortener.links set clicks = clicks + 1 where link_id = $1 and (max_clicks = 0 or clicks < max_clicks)`
+	tag, err := p.conn.Exec(ctx, query, linkID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+	// счетчик не изменился: ссылки нет или переходы по ней закончились
+	var exists bool
+	query = `select exists(select 1 from shortener.links where link_id = $1)`
+	if err = p.conn.QueryRow(ctx, query, linkID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("link with id '%s': %w", linkID, ErrLinkNotFound)
+	}
+	return ErrClicksExhausted
+}
+
+// AddVariantClick засчитывает переход по варианту variant ссылки linkID
+func (p *PgLinksRepository) AddVariantClick(ctx context.Context, linkID string, variant string) error {
+	query := `
+insert into shortener.link_variant_clicks(link_id, variant, clicks) values($1, $2, 1)
+on conflict (link_id, variant) do update set clicks = link_variant_clicks.clicks + 1`
+	_, err := p.conn.Exec(ctx, query, linkID, variant)
+	return err
+}
+
 // Count возвращает количество записей в репозитории.
 func (p *PgLinksRepository) Count(ctx context.Context) (int, error) {
 	query := `select count(*) from shortener.links`
@@ -115,31 +406,516 @@ func (p *PgLinksRepository) Count(ctx context.Context) (int, error) {
 	return count, nil
 }
 
-// FindLinksByUID возвращает ссылки по идентификатору пользователя
-func (p *PgLinksRepository) FindLinksByUID(ctx context.Context, uid string) ([]entity.LinkEntity, error) {
-	query := `select uid, original_url, link_id  from shortener.links where uid=$1 and removed = false`
+// CountLinksByUID возвращает количество активных (не удаленных) ссылок пользователя
+func (p *PgLinksRepository) CountLinksByUID(ctx context.Context, uid string) (int, error) {
+	query := `select count(*) from shortener.links where uid=$1 and removed = false`
+	var count int
+	err := p.conn.QueryRow(ctx, query, uid).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
 
-	var result []entity.LinkEntity
-	rows, err := p.conn.Query(ctx, query, uid)
+// FindLinksByUID возвращает страницу личных ссылок пользователя или ссылок пространства opts.WorkspaceID
+// с заданными статусом и порядком.
+// Страницы выбираются по ключу сортировки (keyset), поэтому дальние страницы не дороже первой
+func (p *PgLinksRepository) FindLinksByUID(ctx context.Context, uid string, opts LinkListOptions) (LinkPage, error) {
+	var q linkQuery
+	if opts.WorkspaceID != "" {
+		q.where("workspace_id = ?", opts.WorkspaceID)
+	} else {
+		q.where("uid = ? and workspace_id is null", uid)
+	}
+	switch opts.Status {
+	case StatusRemoved:
+		q.where("removed = true")
+	case StatusActive:
+		q.where("removed = false and not "+expiredCondition, opts.now().UTC())
+	case StatusExpired:
+		q.where("removed = false and "+expiredCondition, opts.now().UTC())
+	default:
+		q.where("removed = false")
+	}
+	if opts.GroupID != "" {
+		q.where("group_id = ?", opts.GroupID)
+	}
+	order := "created_at desc, link_id"
+	if opts.Sort == SortByClicks {
+		order = "clicks desc, link_id"
+		if opts.After != nil {
+			q.where("(clicks < ? or (clicks = ? and link_id > ?))", opts.After.Clicks, opts.After.Clicks, opts.After.ID)
+		}
+	} else if opts.After != nil {
+		createdAt := opts.After.CreatedAt.UTC()
+		q.where("(created_at < ? or (created_at = ? and link_id > ?))", createdAt, createdAt, opts.After.ID)
+	}
+	query := `select ` + linkColumns + ` from shortener.links where ` + q.condition() + ` order by ` + order
+	if opts.Limit > 0 {
+		// лишняя ссылка показывает, что есть следующая страница
+		query += fmt.Sprintf(" limit %d", opts.Limit+1)
+	}
+
+	links, err := p.queryLinks(ctx, query, q.args...)
+	if err != nil {
+		return LinkPage{}, err
+	}
+	if opts.Limit > 0 && len(links) > opts.Limit {
+		links = links[:opts.Limit]
+		return LinkPage{Links: links, Next: newLinkCursor(links[len(links)-1])}, nil
+	}
+	return LinkPage{Links: links}, nil
+}
+
+// SearchLinks возвращает не удаленные личные ссылки пользователя, подходящие под все условия filter, от новых к старым.
+// В запрос попадают только заданные условия: ссылки пользователя выбираются по индексу uid_created_at_idx,
+// тег проверяется по GIN индексу tags_idx
+func (p *PgLinksRepository) SearchLinks(ctx context.Context, uid string, filter LinkFilter) ([]entity.LinkEntity, error) {
+	var q linkQuery
+	q.where("uid = ? and workspace_id is null and removed = false", uid)
+	if filter.Tag != "" {
+		q.where("tags @> array[?]::varchar[]", filter.Tag)
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		q.where("(original_url ilike ? or title ilike ?)", pattern, pattern)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		q.where("created_at >= ?", filter.CreatedFrom.UTC())
+	}
+	if !filter.CreatedTo.IsZero() {
+		q.where("created_at < ?", filter.CreatedTo.UTC())
+	}
+	query := `select ` + linkColumns + ` from shortener.links where ` + q.condition() + ` order by created_at desc, link_id`
+	return p.queryLinks(ctx, query, q.args...)
+}
+
+// queryLinks выполняет запрос, выбирающий колонки linkColumns, и читает все ссылки
+func (p *PgLinksRepository) queryLinks(ctx context.Context, query string, args ...interface{}) ([]entity.LinkEntity, error) {
+	result := make([]entity.LinkEntity, 0)
+	rows, err := p.conn.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var e entity.LinkEntity
-		err = rows.Scan(&e.UID, &e.OriginalURL, &e.ID)
-		if err != nil {
+		if e, err = scanLink(rows); err != nil {
 			return nil, err
 		}
 		result = append(result, e)
 	}
-	err = rows.Err()
-	if err != nil {
+	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-// DeleteLinksByUID удаляет ссылки пользователя
+// PutGroup сохраняет новую группу ссылок
+func (p *PgLinksRepository) PutGroup(ctx context.Context, group entity.Group) error {
+	query := `insert into shortener.link_groups(group_id, uid, name, created_at) values($1, $2, $3, $4)`
+	_, err := p.conn.Exec(ctx, query, group.ID, group.UID, group.Name, group.CreatedAt.UTC())
+	if isPrimaryKeyViolation(err, "link_groups") {
+		return fmt.Errorf("group with id '%s': %w", group.ID, ErrIDTaken)
+	}
+	return err
+}
+
+// GetGroup возвращает группу ссылок по идентификатору
+func (p *PgLinksRepository) GetGroup(ctx context.Context, groupID string) (*entity.Group, error) {
+	query := `select group_id, uid, name, created_at from shortener.link_groups where group_id = $1`
+	var group entity.Group
+	err := p.conn.QueryRow(ctx, query, groupID).Scan(&group.ID, &group.UID, &group.Name, &group.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("group with id '%s': %w", groupID, ErrGroupNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// FindGroupsByUID возвращает группы пользователя от старых к новым
+func (p *PgLinksRepository) FindGroupsByUID(ctx context.Context, uid string) ([]entity.Group, error) {
+	query := `select group_id, uid, name, created_at from shortener.link_groups where uid = $1 order by created_at, group_id`
+	rows, err := p.conn.Query(ctx, query, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]entity.Group, 0)
+	for rows.Next() {
+		var group entity.Group
+		if err = rows.Scan(&group.ID, &group.UID, &group.Name, &group.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, group)
+	}
+	return result, rows.Err()
+}
+
+// GroupStats подсчитывает статистику по ссылкам группы одним запросом по индексу group_id_idx
+func (p *PgLinksRepository) GroupStats(ctx context.Context, uid string, groupID string, now time.Time) (entity.GroupStats, error) {
+	expired := strings.ReplaceAll(expiredCondition, "?", "$1")
+	query := `
+select count(*) filter (where not removed),
+       count(*) filter (where not removed and not ` + expired + `),
+       count(*) filter (where not removed and ` + expired + `),
+       count(*) filter (where removed),
+       coalesce(sum(clicks), 0)
+from shortener.links
+where group_id = $2 and uid = $3`
+	var stats entity.GroupStats
+	err := p.conn.QueryRow(ctx, query, now.UTC(), groupID, uid).
+		Scan(&stats.Links, &stats.Active, &stats.Expired, &stats.Removed, &stats.Clicks)
+	if err != nil {
+		return entity.GroupStats{}, err
+	}
+	return stats, nil
+}
+
+// PutWorkspace сохраняет новое рабочее пространство и его первого участника в одной транзакции
+func (p *PgLinksRepository) PutWorkspace(ctx context.Context, workspace entity.Workspace, owner entity.WorkspaceMember) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	query := `insert into shortener.workspaces(workspace_id, name, created_at) values($1, $2, $3)`
+	_, err = tx.Exec(ctx, query, workspace.ID, workspace.Name, workspace.CreatedAt.UTC())
+	if isPrimaryKeyViolation(err, "workspaces") {
+		return fmt.Errorf("workspace with id '%s': %w", workspace.ID, ErrIDTaken)
+	}
+	if err != nil {
+		return err
+	}
+	if err = putWorkspaceMember(ctx, tx, owner); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetWorkspace возвращает рабочее пространство по идентификатору
+func (p *PgLinksRepository) GetWorkspace(ctx context.Context, workspaceID string) (*entity.Workspace, error) {
+	query := `select workspace_id, name, created_at from shortener.workspaces where workspace_id = $1`
+	var workspace entity.Workspace
+	err := p.conn.QueryRow(ctx, query, workspaceID).Scan(&workspace.ID, &workspace.Name, &workspace.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("workspace with id '%s': %w", workspaceID, ErrWorkspaceNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// FindWorkspacesByUID возвращает пространства, в которых состоит пользователь, от старых к новым
+func (p *PgLinksRepository) FindWorkspacesByUID(ctx context.Context, uid string) ([]entity.WorkspaceMembership, error) {
+	query := `select w.workspace_id, w.name, w.created_at, m.role from shortener.workspace_members m
+join shortener.workspaces w on w.workspace_id = m.workspace_id
+where m.uid = $1 order by w.created_at, w.workspace_id`
+	rows, err := p.conn.Query(ctx, query, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]entity.WorkspaceMembership, 0)
+	for rows.Next() {
+		var membership entity.WorkspaceMembership
+		if err = rows.Scan(&membership.ID, &membership.Name, &membership.CreatedAt, &membership.Role); err != nil {
+			return nil, err
+		}
+		result = append(result, membership)
+	}
+	return result, rows.Err()
+}
+
+// GetWorkspaceMember возвращает участника пространства
+func (p *PgLinksRepository) GetWorkspaceMember(ctx context.Context, workspaceID string, uid string) (*entity.WorkspaceMember, error) {
+	query := `select workspace_id, uid, role, added_at from shortener.workspace_members where workspace_id = $1 and uid = $2`
+	var member entity.WorkspaceMember
+	err := p.conn.QueryRow(ctx, query, workspaceID, uid).Scan(&member.WorkspaceID, &member.UID, &member.Role, &member.AddedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("user '%s' in workspace '%s': %w", uid, workspaceID, ErrMemberNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// FindWorkspaceMembers возвращает участников пространства в порядке добавления
+func (p *PgLinksRepository) FindWorkspaceMembers(ctx context.Context, workspaceID string) ([]entity.WorkspaceMember, error) {
+	query := `select workspace_id, uid, role, added_at from shortener.workspace_members where workspace_id = $1
+order by added_at, uid`
+	rows, err := p.conn.Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]entity.WorkspaceMember, 0)
+	for rows.Next() {
+		var member entity.WorkspaceMember
+		if err = rows.Scan(&member.WorkspaceID, &member.UID, &member.Role, &member.AddedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, member)
+	}
+	return result, rows.Err()
+}
+
+// PutWorkspaceMember добавляет участника в пространство или меняет роль уже добавленного.
+// Последнего владельца понизить нельзя
+func (p *PgLinksRepository) PutWorkspaceMember(ctx context.Context, member entity.WorkspaceMember) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if member.Role != entity.RoleOwner {
+		if err = checkOtherOwner(ctx, tx, member.WorkspaceID, member.UID); err != nil {
+			return err
+		}
+	}
+	if err = putWorkspaceMember(ctx, tx, member); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// DeleteWorkspaceMember исключает пользователя из пространства
+func (p *PgLinksRepository) DeleteWorkspaceMember(ctx context.Context, workspaceID string, uid string) error {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if err = checkOtherOwner(ctx, tx, workspaceID, uid); err != nil {
+		return err
+	}
+	query := `delete from shortener.workspace_members where workspace_id = $1 and uid = $2`
+	tag, err := tx.Exec(ctx, query, workspaceID, uid)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user '%s' in workspace '%s': %w", uid, workspaceID, ErrMemberNotFound)
+	}
+	return tx.Commit(ctx)
+}
+
+// checkOtherOwner проверяет, что без прав владельца пользователя uid в пространстве останется другой владелец.
+// Строка пространства блокируется до конца транзакции tx, поэтому параллельные изменения участников
+// одного пространства выполняются по очереди и не могут вместе убрать всех владельцев
+func checkOtherOwner(ctx context.Context, tx pgx.Tx, workspaceID string, uid string) error {
+	lock := `select workspace_id from shortener.workspaces where workspace_id = $1 for update`
+	if _, err := tx.Exec(ctx, lock, workspaceID); err != nil {
+		return err
+	}
+	query := `select count(*) filter (where uid = $2), count(*) filter (where uid <> $2)
+from shortener.workspace_members where workspace_id = $1 and role = $3`
+	var self, others int
+	if err := tx.QueryRow(ctx, query, workspaceID, uid, string(entity.RoleOwner)).Scan(&self, &others); err != nil {
+		return err
+	}
+	if self > 0 && others == 0 {
+		return fmt.Errorf("user '%s' in workspace '%s': %w", uid, workspaceID, ErrLastOwner)
+	}
+	return nil
+}
+
+// editorRoles роли участников пространства, которым entity.Role.CanEdit разрешает изменять и удалять его ссылки
+var editorRoles = []string{string(entity.RoleOwner), string(entity.RoleEditor)}
+
+// execer выполняет запрос без результата: подключение или транзакция
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+}
+
+// putWorkspaceMember добавляет участника пространства или меняет его роль и время ее получения
+func putWorkspaceMember(ctx context.Context, conn execer, member entity.WorkspaceMember) error {
+	query := `insert into shortener.workspace_members(workspace_id, uid, role, added_at) values($1, $2, $3, $4)
+on conflict (workspace_id, uid) do update set role = excluded.role, added_at = excluded.added_at`
+	_, err := conn.Exec(ctx, query, member.WorkspaceID, member.UID, string(member.Role), member.AddedAt.UTC())
+	return err
+}
+
+// PutTransfer сохраняет новую передачу ссылок
+func (p *PgLinksRepository) PutTransfer(ctx context.Context, transfer entity.Transfer) error {
+	linkIDs := transfer.LinkIDs
+	if linkIDs == nil {
+		linkIDs = []string{}
+	}
+	query := `insert into shortener.link_transfers(token_hash, from_uid, link_ids, created_at, expires_at) values($1, $2, $3, $4, $5)`
+	_, err := p.conn.Exec(ctx, query, transfer.TokenHash, transfer.FromUID, linkIDs, transfer.CreatedAt.UTC(), transfer.ExpiresAt.UTC())
+	return err
+}
+
+// RedeemTransfer передает пользователю uid ссылки передачи в одной транзакции.
+// Строка передачи блокируется, поэтому параллельно использовать один токен дважды нельзя
+func (p *PgLinksRepository) RedeemTransfer(ctx context.Context, tokenHash string, uid string, now time.Time) (entity.Transfer, error) {
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return entity.Transfer{}, err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	transfer := entity.Transfer{TokenHash: tokenHash}
+	query := `select from_uid, link_ids, created_at, expires_at, redeemed_at from shortener.link_transfers
+where token_hash = $1 for update`
+	err = tx.QueryRow(ctx, query, tokenHash).
+		Scan(&transfer.FromUID, &transfer.LinkIDs, &transfer.CreatedAt, &transfer.ExpiresAt, &transfer.RedeemedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Transfer{}, ErrTransferNotFound
+	}
+	if err != nil {
+		return entity.Transfer{}, err
+	}
+	switch {
+	case transfer.IsRedeemed() || transfer.IsExpired(now):
+		return entity.Transfer{}, ErrTransferUnavailable
+	case transfer.FromUID == uid:
+		return entity.Transfer{}, ErrTransferToSelf
+	}
+
+	if err = p.lockQuota(ctx, tx, uid); err != nil {
+		return entity.Transfer{}, err
+	}
+	redeemedAt := now.UTC()
+	// первые параметры - новые значения колонок ссылки
+	q := linkQuery{args: []interface{}{uid, redeemedAt}}
+	q.where("uid = ? and workspace_id is null and removed = false", transfer.FromUID)
+	q.where("link_id = any(?)", transfer.LinkIDs)
+	if p.opts.dedupScope == config.DedupPerUser {
+		// иначе ссылка нарушила бы уникальный индекс uid_canonical_url_idx получателя
+		q.where("(canonical_url is null or not exists (select 1 from shortener.links d where d.uid = $1 and d.canonical_url = links.canonical_url))")
+	}
+	rows, err := tx.Query(ctx, `update shortener.links set uid = $1, group_id = null, updated_at = $2 where `+q.condition()+
+		` returning link_id`, q.args...)
+	if err != nil {
+		return entity.Transfer{}, err
+	}
+	transfer.TransferredIDs = make([]string, 0)
+	for rows.Next() {
+		var linkID string
+		if err = rows.Scan(&linkID); err != nil {
+			rows.Close()
+			return entity.Transfer{}, err
+		}
+		transfer.TransferredIDs = append(transfer.TransferredIDs, linkID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return entity.Transfer{}, err
+	}
+	sort.Strings(transfer.TransferredIDs)
+	if err = p.checkQuota(ctx, tx, uid); err != nil {
+		return entity.Transfer{}, err
+	}
+
+	transfer.ToUID = uid
+	transfer.RedeemedAt = &redeemedAt
+	query = `update shortener.link_transfers set to_uid = $2, redeemed_at = $3, transferred_ids = $4 where token_hash = $1`
+	if _, err = tx.Exec(ctx, query, tokenHash, uid, redeemedAt, transfer.TransferredIDs); err != nil {
+		return entity.Transfer{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return entity.Transfer{}, err
+	}
+	return transfer, nil
+}
+
+// apiKeyColumns колонки API ключа в том порядке, в котором их читает scanAPIKey
+const apiKeyColumns = `key_id, uid, coalesce(name, ''), prefix, key_hash, scopes, created_at, revoked_at`
+
+// PutAPIKey сохраняет новый API ключ
+func (p *PgLinksRepository) PutAPIKey(ctx context.Context, key entity.APIKey) error {
+	query := `insert into shortener.api_keys(key_id, uid, name, prefix, key_hash, scopes, created_at) values($1, $2, $3, $4, $5, $6, $7)`
+	_, err := p.conn.Exec(ctx, query, key.ID, key.UID, nullIfEmpty(key.Name), key.Prefix, key.KeyHash, scopesValue(key.Scopes),
+		key.CreatedAt.UTC())
+	if isPrimaryKeyViolation(err, "api_keys") {
+		return fmt.Errorf("api key with id '%s': %w", key.ID, ErrIDTaken)
+	}
+	return err
+}
+
+// GetAPIKeyByHash возвращает API ключ по хешу
+func (p *PgLinksRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*entity.APIKey, error) {
+	query := `select ` + apiKeyColumns + ` from shortener.api_keys where key_hash = $1`
+	key, err := scanAPIKey(p.conn.QueryRow(ctx, query, keyHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindAPIKeysByUID возвращает API ключи пользователя от старых к новым
+func (p *PgLinksRepository) FindAPIKeysByUID(ctx context.Context, uid string) ([]entity.APIKey, error) {
+	query := `select ` + apiKeyColumns + ` from shortener.api_keys where uid = $1 order by created_at, key_id`
+	rows, err := p.conn.Query(ctx, query, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]entity.APIKey, 0)
+	for rows.Next() {
+		var key entity.APIKey
+		if key, err = scanAPIKey(rows); err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	return result, rows.Err()
+}
+
+// RevokeAPIKey отзывает API ключ пользователя
+func (p *PgLinksRepository) RevokeAPIKey(ctx context.Context, uid string, keyID string, now time.Time) error {
+	query := `update shortener.api_keys set revoked_at = coalesce(revoked_at, $3) where key_id = $1 and uid = $2`
+	tag, err := p.conn.Exec(ctx, query, keyID, uid, now.UTC())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("api key with id '%s': %w", keyID, ErrAPIKeyNotFound)
+	}
+	return nil
+}
+
+// scopesValue значение колонки scopes
+func scopesValue(scopes []entity.Scope) []string {
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		result = append(result, string(scope))
+	}
+	return result
+}
+
+// scanAPIKey читает API ключ из строки с колонками apiKeyColumns
+func scanAPIKey(row pgx.Row) (entity.APIKey, error) {
+	var key entity.APIKey
+	var scopes []string
+	err := row.Scan(&key.ID, &key.UID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		return entity.APIKey{}, err
+	}
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, entity.Scope(scope))
+	}
+	return key, nil
+}
+
+// DeleteLinksByUID удаляет ссылки, которые пользователь uid вправе удалить.
+// Права проверяются в том же запросе, что и удаление
 func (p *PgLinksRepository) DeleteLinksByUID(ctx context.Context, uid string, linkIDs ...string) error {
 	// TODO надо бить ids на чанки по 1024- штуки
 	tx, err := p.conn.Begin(ctx)
@@ -148,7 +924,7 @@ func (p *PgLinksRepository) DeleteLinksByUID(ctx context.Context, uid string, li
 	}
 	defer tx.Rollback(ctx) //nolint:errcheck
 
-	_, err = tx.Exec(ctx, p.removeLinkStmt.Name, uid, linkIDs)
+	_, err = tx.Exec(ctx, p.removeLinkStmt.Name, linkIDs, uid, time.Now().UTC(), editorRoles)
 	if err != nil {
 		return err
 	}
@@ -187,8 +963,390 @@ func (p *PgLinksRepository) migrate(ctx context.Context) error {
 		);
 		ALTER TABLE links ALTER COLUMN created_at SET DEFAULT now();
 		ALTER TABLE links ALTER COLUMN removed SET DEFAULT false;
-		CREATE UNIQUE INDEX IF NOT EXISTS original_url_idx ON links USING btree (original_url);
+		DO $$
+		BEGIN
+			-- ссылки, сохраненные до появления canonical_url, один раз получают его из original_url
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_schema = 'shortener' AND table_name = 'links' AND column_name = 'canonical_url') THEN
+				ALTER TABLE links ADD COLUMN canonical_url varchar;
+				UPDATE links SET canonical_url = original_url;
+			END IF;
+		END $$;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS password_hash varchar;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS max_clicks integer NOT NULL DEFAULT 0;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS clicks integer NOT NULL DEFAULT 0;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS title varchar;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS interstitial boolean NOT NULL DEFAULT false;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS redirect_code integer NOT NULL DEFAULT 0;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS pass_query boolean NOT NULL DEFAULT false;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS pass_path boolean NOT NULL DEFAULT false;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS query_merge varchar;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS utm jsonb;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS targeting jsonb;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS variants jsonb;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS not_before TIMESTAMP;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS not_after TIMESTAMP;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS inactive_url varchar;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS notes varchar;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS tags varchar[] NOT NULL DEFAULT '{}';
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS removed_at TIMESTAMP;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS group_id varchar;
+		ALTER TABLE links ADD COLUMN IF NOT EXISTS workspace_id varchar;
+		DROP INDEX IF EXISTS original_url_idx;
+		DROP INDEX IF EXISTS uid_original_url_idx;
+		CREATE INDEX IF NOT EXISTS uid_idx ON links USING btree (uid);
+		CREATE UNIQUE INDEX IF NOT EXISTS link_id_idx ON links USING btree (link_id);
+		CREATE INDEX IF NOT EXISTS uid_created_at_idx ON links USING btree (uid, created_at);
+		CREATE INDEX IF NOT EXISTS uid_clicks_idx ON links USING btree (uid, clicks);
+		CREATE INDEX IF NOT EXISTS tags_idx ON links USING gin (tags);
+		CREATE INDEX IF NOT EXISTS group_id_idx ON links USING btree (group_id);
+		CREATE INDEX IF NOT EXISTS workspace_id_created_at_idx ON links USING btree (workspace_id, created_at);
+
+		CREATE TABLE IF NOT EXISTS schema_migrations(
+			name varchar PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT now()
+		);
+
+		CREATE TABLE IF NOT EXISTS link_revisions(
+			id serial primary key,
+			link_id varchar NOT NULL,
+			original_url varchar,
+			changed_at TIMESTAMP NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS link_revisions_link_id_idx ON link_revisions USING btree (link_id);
+
+		CREATE TABLE IF NOT EXISTS link_groups(
+			group_id varchar PRIMARY KEY,
+			uid varchar NOT NULL,
+			name varchar NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS link_groups_uid_idx ON link_groups USING btree (uid);
+
+		CREATE TABLE IF NOT EXISTS workspaces(
+			workspace_id varchar PRIMARY KEY,
+			name varchar NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT now()
+		);
+
+		CREATE TABLE IF NOT EXISTS workspace_members(
+			workspace_id varchar NOT NULL,
+			uid varchar NOT NULL,
+			role varchar NOT NULL,
+			added_at TIMESTAMP NOT NULL DEFAULT now(),
+			PRIMARY KEY (workspace_id, uid)
+		);
+		CREATE INDEX IF NOT EXISTS workspace_members_uid_idx ON workspace_members USING btree (uid);
+
+		CREATE TABLE IF NOT EXISTS link_transfers(
+			token_hash varchar PRIMARY KEY,
+			from_uid varchar NOT NULL,
+			link_ids varchar[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP NOT NULL DEFAULT now(),
+			expires_at TIMESTAMP NOT NULL,
+			to_uid varchar,
+			redeemed_at TIMESTAMP,
+			transferred_ids varchar[] NOT NULL DEFAULT '{}'
+		);
+
+		CREATE TABLE IF NOT EXISTS api_keys(
+			key_id varchar PRIMARY KEY,
+			uid varchar NOT NULL,
+			name varchar,
+			prefix varchar NOT NULL,
+			key_hash varchar NOT NULL,
+			scopes varchar[] NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP NOT NULL DEFAULT now(),
+			revoked_at TIMESTAMP
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS api_keys_key_hash_idx ON api_keys USING btree (key_hash);
+		CREATE INDEX IF NOT EXISTS api_keys_uid_idx ON api_keys USING btree (uid);
+
+		CREATE TABLE IF NOT EXISTS link_variant_clicks(
+			link_id varchar NOT NULL,
+			variant varchar NOT NULL,
+			clicks integer NOT NULL DEFAULT 0,
+			PRIMARY KEY (link_id, variant)
+		);
 		`
 	_, err := p.conn.Exec(ctx, migration)
 	return err
 }
+
+// legacyBatchSize сколько ссылок обрабатывает за один запрос разовая миграция данных
+const legacyBatchSize = 500
+
+// dataMigration разовая миграция данных, которую нельзя выразить в SQL
+type dataMigration struct {
+	// name имя, под которым миграция отмечается выполненной в таблице schema_migrations
+	name string
+	run  func(ctx context.Context) error
+}
+
+// migrateData выполняет по порядку разовые миграции данных, которые еще не отмечены в schema_migrations.
+// Миграция отмечается после успешного завершения, прерванная миграция при следующем запуске начнется заново
+func (p *PgLinksRepository) migrateData(ctx context.Context) error {
+	migrations := []dataMigration{
+		{name: "canonicalize_legacy_links", run: p.canonicalizeLegacyLinks},
+	}
+	for _, m := range migrations {
+		var applied bool
+		query := `select exists(select 1 from shortener.schema_migrations where name = $1)`
+		if err := p.conn.QueryRow(ctx, query, m.name).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+		log.Info().Msgf("data migration %s", m.name)
+		if err := m.run(ctx); err != nil {
+			return fmt.Errorf("data migration %s: %w", m.name, err)
+		}
+		query = `insert into shortener.schema_migrations(name) values($1) on conflict do nothing`
+		if _, err := p.conn.Exec(ctx, query, m.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canonicalizeLegacyLinks приводит к каноническому виду адреса ссылок, сохраненных до появления канонизации:
+// у них canonical_url пустой или скопирован из original_url как есть.
+// Если каноническая форма совпадает с другой ссылкой в области dedupScope, адрес ссылки не меняется,
+// иначе сломался бы уникальный индекс
+func (p *PgLinksRepository) canonicalizeLegacyLinks(ctx context.Context) error {
+	query := `select ` + linkColumns + ` from shortener.links
+where (canonical_url is null or canonical_url = original_url) and link_id > $1 order by link_id limit $2`
+	update := `update shortener.links set canonical_url = $2 where link_id = $1`
+	switch p.opts.dedupScope {
+	case config.DedupGlobal:
+		update += ` and not exists (select 1 from shortener.links d where d.canonical_url = $2)`
+	case config.DedupPerUser:
+		update += ` and not exists (select 1 from shortener.links d where d.canonical_url = $2 and d.uid = links.uid)`
+	}
+
+	lastID := ""
+	for {
+		links, err := p.queryLinks(ctx, query, lastID, legacyBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range links {
+			canonicalURL, ok := p.opts.legacyCanonicalURL(e)
+			if !ok || canonicalURL == e.CanonicalURL || !e.Deduplicable() {
+				continue
+			}
+			if _, err = p.conn.Exec(ctx, update, e.ID, canonicalURL); err != nil {
+				return err
+			}
+		}
+		if len(links) < legacyBatchSize {
+			return nil
+		}
+		lastID = links[len(links)-1].ID
+	}
+}
+
+// migrateDedupIndex приводит уникальный индекс по длинным ссылкам в соответствие с настройкой dedupScope.
+// При переключении на более строгую область миграция упадет, если в БД уже есть дубликаты.
+func (p *PgLinksRepository) migrateDedupIndex(ctx context.Context) error {
+	indexes := map[config.DedupScope]string{
+		config.DedupGlobal:  "CREATE UNIQUE INDEX IF NOT EXISTS canonical_url_idx ON shortener.links USING btree (canonical_url);",
+		config.DedupPerUser: "CREATE UNIQUE INDEX IF NOT EXISTS uid_canonical_url_idx ON shortener.links USING btree (uid, canonical_url);",
+	}
+	drops := map[config.DedupScope]string{
+		config.DedupGlobal:  "DROP INDEX IF EXISTS shortener.canonical_url_idx;",
+		config.DedupPerUser: "DROP INDEX IF EXISTS shortener.uid_canonical_url_idx;",
+	}
+
+	tx, err := p.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	for scope, drop := range drops {
+		if scope == p.opts.dedupScope {
+			continue
+		}
+		if _, err = tx.Exec(ctx, drop); err != nil {
+			return err
+		}
+	}
+	if create, ok := indexes[p.opts.dedupScope]; ok {
+		if _, err = tx.Exec(ctx, create); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// canonicalURLValue значение колонки canonical_url. У ссылок, которые не участвуют в поиске дубликатов
+// (entity.LinkEntity.Deduplicable), например защищенных паролем, это NULL,
+// чтобы они не попадали под уникальный индекс и не находились как дубликаты
+func canonicalURLValue(e entity.LinkEntity) interface{} {
+	if !e.Deduplicable() {
+		return nil
+	}
+	return e.DedupURL()
+}
+
+// passwordHashValue значение колонки password_hash. NULL у незащищенных ссылок
+func passwordHashValue(e entity.LinkEntity) interface{} {
+	if !e.IsProtected() {
+		return nil
+	}
+	return e.PasswordHash
+}
+
+// nullIfEmpty значение необязательной строковой колонки: NULL вместо пустой строки
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// utmValue значение колонки utm. NULL у ссылок без разметки
+func utmValue(e entity.LinkEntity) interface{} {
+	return jsonValue(e.UTM, e.UTM != nil)
+}
+
+// targetingValue значение колонки targeting. NULL у ссылок без правил
+func targetingValue(e entity.LinkEntity) interface{} {
+	return jsonValue(e.Targeting, len(e.Targeting) > 0)
+}
+
+// variantsValue значение колонки variants. NULL у ссылок без вариантов
+func variantsValue(e entity.LinkEntity) interface{} {
+	return jsonValue(e.Variants, len(e.Variants) > 0)
+}
+
+// tagsValue значение колонки tags. Пустой массив у ссылок без тегов
+func tagsValue(e entity.LinkEntity) []string {
+	if e.Tags == nil {
+		return []string{}
+	}
+	return e.Tags
+}
+
+// jsonValue значение jsonb колонки: NULL, если значение не задано
+func jsonValue(value interface{}, isSet bool) interface{} {
+	if !isSet {
+		return nil
+	}
+	// в настройках ссылок только строки и числа, ошибки сериализации быть не может
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// unmarshalColumn разбирает значение jsonb колонки. NULL оставляет target без изменений
+func unmarshalColumn(data []byte, target interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, target)
+}
+
+// timeValue значение необязательной колонки времени: NULL или время в UTC, колонки хранятся без часового пояса
+func timeValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// createdAtValue значение колонки created_at. Время создания ссылки, если его не задали при создании
+func createdAtValue(e entity.LinkEntity) time.Time {
+	if e.CreatedAt.IsZero() {
+		return time.Now().UTC()
+	}
+	return e.CreatedAt.UTC()
+}
+
+// scanLink читает ссылку из строки с колонками linkColumns
+func scanLink(row pgx.Row) (entity.LinkEntity, error) {
+	var e entity.LinkEntity
+	var utm, targeting, variants, variantClicks []byte
+	var createdAt, updatedAt *time.Time
+	err := row.Scan(&e.UID, &e.OriginalURL, &e.CanonicalURL, &e.ID, &e.PasswordHash, &e.MaxClicks, &e.Clicks, &e.Removed,
+		&e.Title, &e.Notes, &e.Tags, &e.Interstitial, &e.RedirectCode, &e.PassQuery, &e.PassPath, &e.QueryMerge, &utm, &targeting,
+		&variants, &variantClicks, &e.NotBefore, &e.NotAfter, &e.InactiveURL, &createdAt, &updatedAt, &e.RemovedAt,
+		&e.GroupID, &e.WorkspaceID)
+	if err != nil {
+		return entity.LinkEntity{}, err
+	}
+	for _, column := range []struct {
+		data   []byte
+		target interface{}
+	}{
+		{utm, &e.UTM},
+		{targeting, &e.Targeting},
+		{variants, &e.Variants},
+		{variantClicks, &e.VariantClicks},
+	} {
+		if err = unmarshalColumn(column.data, column.target); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if createdAt != nil {
+		e.CreatedAt = *createdAt
+	}
+	if updatedAt != nil {
+		e.UpdatedAt = *updatedAt
+	}
+	if len(e.Tags) == 0 {
+		e.Tags = nil
+	}
+	return e, nil
+}
+
+// expiredCondition условие истечения ссылки к моменту из параметра запроса, как в entity.LinkEntity.IsExpired
+const expiredCondition = "((not_after is not null and not_after <= ?) or (max_clicks > 0 and clicks >= max_clicks))"
+
+// linkQuery собирает условие where из заданных частей. Знаки ? в частях заменяются номерами параметров
+type linkQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+// where добавляет к запросу условие condition с параметрами args
+func (q *linkQuery) where(condition string, args ...interface{}) {
+	for _, arg := range args {
+		q.args = append(q.args, arg)
+		condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(q.args)), 1)
+	}
+	q.conditions = append(q.conditions, condition)
+}
+
+// condition условие where из всех добавленных частей
+func (q *linkQuery) condition() string {
+	return strings.Join(q.conditions, " and ")
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE, чтобы подстрока искалась как есть
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// isLinkIDCollision возвращает true, если вставка не удалась из-за уже занятого link_id
+func isLinkIDCollision(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == linkIDIndex
+}
+
+// isPrimaryKeyViolation возвращает true, если вставка в таблицу table не удалась из-за уже занятого первичного ключа
+func isPrimaryKeyViolation(err error, table string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == table+"_pkey"
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
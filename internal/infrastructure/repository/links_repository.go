@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/zaz600/go-musthave-shortener/internal/app/config"
@@ -10,25 +12,124 @@ import (
 
 // LinksRepository интерфейс для работы с хранилищем сокращенных ссылок
 type LinksRepository interface {
-	// Get достает по linkID из репозитория информацию по сокращенной ссылке entity.LinkEntity
+	// Get достает по linkID из репозитория информацию по сокращенной ссылке entity.LinkEntity.
+	// Если ссылки нет, возвращает ErrLinkNotFound
 	Get(ctx context.Context, linkID string) (*entity.LinkEntity, error)
 
 	// PutIfAbsent сохраняет в БД длинную ссылку, если такой там еще нет.
-	// Если длинная ссылка есть в БД, выбрасывает исключение LinkExistsError с идентификатором ее короткой ссылки.
+	// Если длинная ссылка есть в БД, выбрасывает исключение LinkExistsError с идентификатором ее короткой ссылки
+	// и владельцем. Где искать дубликаты (среди всех ссылок, ссылок пользователя или нигде), задает WithDedupScope.
+	// Если новая ссылка превысит квоту пользователя (WithLinksQuota), возвращает ErrQuotaExceeded.
+	// Если идентификатор ссылки уже занят, подбирает новый генератором из WithIDGenerator,
+	// поэтому вызывающий должен использовать идентификатор возвращенной ссылки.
 	PutIfAbsent(ctx context.Context, linkEntity entity.LinkEntity) (entity.LinkEntity, error)
 
 	// PutBatch сохраняет в хранилище список сокращенных ссылок. Все ссылки записываются в одной транзакции.
-	PutBatch(ctx context.Context, linkEntities []entity.LinkEntity) error
+	// Если пачка превысит квоту пользователя (WithLinksQuota), не сохраняется ничего и возвращается ErrQuotaExceeded.
+	// Занятые идентификаторы заменяются новыми, возвращаются сохраненные ссылки в исходном порядке
+	PutBatch(ctx context.Context, linkEntities []entity.LinkEntity) ([]entity.LinkEntity, error)
+
+	// UpdateLink сохраняет изменяемые поля ссылки: адрес, пароль, ограничение переходов, название
+	// и настройки перехода, и обновляет время изменения UpdatedAt.
+	// Если адрес изменился, прежний добавляется в историю. Если новый адрес дублирует другую ссылку
+	// (с учетом WithDedupScope), возвращает LinkExistsError. Если ссылки нет, возвращает ErrLinkNotFound
+	UpdateLink(ctx context.Context, linkEntity entity.LinkEntity) (entity.LinkEntity, error)
+
+	// FindLinkRevisions возвращает историю адресов ссылки, от старых к новым
+	FindLinkRevisions(ctx context.Context, linkID string) ([]entity.LinkRevision, error)
+
+	// ConsumeClick атомарно засчитывает переход по ссылке с учетом ограничения MaxClicks.
+	// Если ссылки нет, возвращает ErrLinkNotFound, если переходы закончились - ErrClicksExhausted.
+	// Параллельные переходы не превышают лимит
+	ConsumeClick(ctx context.Context, linkID string) error
+
+	// AddVariantClick засчитывает переход по варианту адреса назначения. Если ссылки нет, возвращает ErrLinkNotFound
+	AddVariantClick(ctx context.Context, linkID string, variant string) error
 
 	// Count возвращает количество записей в репозитории.
 	Count(ctx context.Context) (int, error)
 
-	// FindLinksByUID возвращает ссылки по идентификатору пользователя
-	FindLinksByUID(ctx context.Context, uid string) ([]entity.LinkEntity, error)
+	// CountLinksByUID возвращает количество активных (не удаленных) ссылок пользователя
+	CountLinksByUID(ctx context.Context, uid string) (int, error)
+
+	// FindLinksByUID возвращает страницу личных ссылок пользователя или, если задан opts.WorkspaceID,
+	// ссылок рабочего пространства с заданными статусом и порядком.
+	// Следующая страница запрашивается с курсором LinkPage.Next предыдущей
+	FindLinksByUID(ctx context.Context, uid string, opts LinkListOptions) (LinkPage, error)
+
+	// SearchLinks возвращает не удаленные личные ссылки пользователя, подходящие под все условия filter,
+	// от новых к старым
+	SearchLinks(ctx context.Context, uid string, filter LinkFilter) ([]entity.LinkEntity, error)
 
-	// DeleteLinksByUID отложенно запускает удаление ссылок пользователя
+	// DeleteLinksByUID помечает удаленными ссылки, которые пользователь uid вправе удалить: свои личные
+	// и ссылки пространств, где он редактор или владелец. Остальные идентификаторы пропускаются.
+	// Удаленным ссылкам записывается время удаления RemovedAt, повторное удаление его не меняет
 	DeleteLinksByUID(ctx context.Context, uid string, linkIDs ...string) error
 
+	// PutGroup сохраняет новую группу ссылок. Если идентификатор группы занят, возвращает ErrIDTaken
+	PutGroup(ctx context.Context, group entity.Group) error
+
+	// GetGroup возвращает группу ссылок по идентификатору. Если группы нет, возвращает ErrGroupNotFound
+	GetGroup(ctx context.Context, groupID string) (*entity.Group, error)
+
+	// FindGroupsByUID возвращает группы пользователя от старых к новым
+	FindGroupsByUID(ctx context.Context, uid string) ([]entity.Group, error)
+
+	// GroupStats подсчитывает статистику по ссылкам группы groupID пользователя uid.
+	// Истечение ссылок определяется относительно момента now
+	GroupStats(ctx context.Context, uid string, groupID string, now time.Time) (entity.GroupStats, error)
+
+	// PutWorkspace сохраняет новое рабочее пространство вместе с его первым участником owner.
+	// Если идентификатор пространства занят, возвращает ErrIDTaken
+	PutWorkspace(ctx context.Context, workspace entity.Workspace, owner entity.WorkspaceMember) error
+
+	// GetWorkspace возвращает рабочее пространство по идентификатору.
+	// Если пространства нет, возвращает ErrWorkspaceNotFound
+	GetWorkspace(ctx context.Context, workspaceID string) (*entity.Workspace, error)
+
+	// FindWorkspacesByUID возвращает пространства, в которых состоит пользователь, с его ролью, от старых к новым
+	FindWorkspacesByUID(ctx context.Context, uid string) ([]entity.WorkspaceMembership, error)
+
+	// GetWorkspaceMember возвращает участника пространства. Если пользователь не состоит в нем,
+	// возвращает ErrMemberNotFound
+	GetWorkspaceMember(ctx context.Context, workspaceID string, uid string) (*entity.WorkspaceMember, error)
+
+	// FindWorkspaceMembers возвращает участников пространства в порядке добавления
+	FindWorkspaceMembers(ctx context.Context, workspaceID string) ([]entity.WorkspaceMember, error)
+
+	// PutWorkspaceMember добавляет участника в пространство или меняет роль уже добавленного.
+	// Если понижают последнего владельца, возвращает ErrLastOwner
+	PutWorkspaceMember(ctx context.Context, member entity.WorkspaceMember) error
+
+	// DeleteWorkspaceMember исключает пользователя из пространства.
+	// Если пользователь не состоит в нем, возвращает ErrMemberNotFound, если он последний владелец - ErrLastOwner
+	DeleteWorkspaceMember(ctx context.Context, workspaceID string, uid string) error
+
+	// PutTransfer сохраняет новую передачу ссылок
+	PutTransfer(ctx context.Context, transfer entity.Transfer) error
+
+	// RedeemTransfer атомарно передает пользователю uid ссылки передачи с хешем токена tokenHash
+	// и помечает токен использованным к моменту now. Переходят только перечисленные в передаче не удаленные личные ссылки,
+	// которые все еще принадлежат создателю токена. Ссылки, которые дублировали бы ссылки получателя
+	// (WithDedupScope), остаются у создателя, а из групп создателя ссылки убираются.
+	// Возвращает использованную передачу со списком перешедших ссылок, ErrTransferNotFound,
+	// ErrTransferUnavailable, ErrTransferToSelf или ErrQuotaExceeded, если ссылки превысят квоту получателя
+	RedeemTransfer(ctx context.Context, tokenHash string, uid string, now time.Time) (entity.Transfer, error)
+
+	// PutAPIKey сохраняет новый API ключ. Если идентификатор ключа занят, возвращает ErrIDTaken
+	PutAPIKey(ctx context.Context, key entity.APIKey) error
+
+	// GetAPIKeyByHash возвращает API ключ по хешу, в том числе отозванный.
+	// Если ключа нет, возвращает ErrAPIKeyNotFound
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*entity.APIKey, error)
+
+	// FindAPIKeysByUID возвращает API ключи пользователя, в том числе отозванные, от старых к новым
+	FindAPIKeysByUID(ctx context.Context, uid string) ([]entity.APIKey, error)
+
+	// RevokeAPIKey отзывает API ключ keyID пользователя uid к моменту now. Повторный отзыв время не меняет.
+	// Если у пользователя нет такого ключа, возвращает ErrAPIKeyNotFound
+	RevokeAPIKey(ctx context.Context, uid string, keyID string, now time.Time) error
+
 	// Status статус подключения к хранилищу
 	Status(ctx context.Context) error
 
@@ -36,25 +137,127 @@ type LinksRepository interface {
 	Close(ctx context.Context) error
 }
 
-func NewRepository(ctx context.Context, cfg *config.ShortenConfig) (LinksRepository, error) {
+// LinkFilter условия поиска ссылок пользователя. Незаданные условия не ограничивают поиск
+type LinkFilter struct {
+	// Tag ссылка помечена этим тегом
+	Tag string
+	// Query подстрока адреса или названия ссылки, без учета регистра
+	Query string
+	// CreatedFrom ссылка создана не раньше этого момента
+	CreatedFrom time.Time
+	// CreatedTo ссылка создана раньше этого момента
+	CreatedTo time.Time
+}
+
+// LinkSort порядок ссылок в списке
+type LinkSort string
+
+const (
+	// SortByCreated от новых ссылок к старым
+	SortByCreated LinkSort = "created"
+	// SortByClicks от ссылок с большим количеством переходов к ссылкам с меньшим
+	SortByClicks LinkSort = "clicks"
+)
+
+// LinkStatus состояние ссылки для фильтрации списка
+type LinkStatus string
+
+const (
+	// StatusAny все не удаленные ссылки
+	StatusAny LinkStatus = ""
+	// StatusActive не удаленные ссылки, которые не истекли
+	StatusActive LinkStatus = "active"
+	// StatusRemoved удаленные ссылки
+	StatusRemoved LinkStatus = "removed"
+	// StatusExpired не удаленные ссылки, у которых прошел NotAfter или закончились переходы
+	StatusExpired LinkStatus = "expired"
+)
+
+// LinkListOptions параметры страницы списка ссылок пользователя
+type LinkListOptions struct {
+	// Sort порядок ссылок. Пустой - SortByCreated
+	Sort LinkSort
+	// Status какие ссылки попадают в список
+	Status LinkStatus
+	// GroupID только ссылки этой группы. Пустой - ссылки всех групп и без группы
+	GroupID string
+	// WorkspaceID ссылки этого рабочего пространства. Пустой - личные ссылки пользователя
+	WorkspaceID string
+	// After курсор: ссылки после этой позиции. nil - первая страница
+	After *LinkCursor
+	// Limit максимальное количество ссылок на странице. 0 - без ограничения
+	Limit int
+	// Now момент, относительно которого определяется истечение ссылок. Нулевой - текущее время
+	Now time.Time
+}
+
+// LinkCursor позиция последней ссылки страницы в порядке сортировки
+type LinkCursor struct {
+	// CreatedAt время создания ссылки, для SortByCreated
+	CreatedAt time.Time
+	// Clicks количество переходов по ссылке, для SortByClicks
+	Clicks int
+	// ID идентификатор ссылки, упорядочивает ссылки с одинаковым ключом сортировки
+	ID string
+}
+
+// LinkPage страница списка ссылок
+type LinkPage struct {
+	// Links ссылки страницы
+	Links []entity.LinkEntity
+	// Next курсор следующей страницы. nil - страница последняя
+	Next *LinkCursor
+}
+
+// now момент, относительно которого определяется истечение ссылок
+func (o LinkListOptions) now() time.Time {
+	if o.Now.IsZero() {
+		return time.Now()
+	}
+	return o.Now
+}
+
+// newLinkCursor позиция ссылки e в порядке сортировки
+func newLinkCursor(e entity.LinkEntity) *LinkCursor {
+	return &LinkCursor{CreatedAt: e.CreatedAt, Clicks: e.Clicks, ID: e.ID}
+}
+
+// PutWithFreeID сохраняет новую запись функцией put с идентификатором от generator,
+// подбирая новый идентификатор, пока put возвращает ErrIDTaken.
+// Через maxIDAttempts занятых идентификаторов возвращает ErrIDCollision
+func PutWithFreeID(generator IDGenerator, put func(id string) error) error {
+	for attempt := 0; attempt < maxIDAttempts; attempt++ {
+		id, err := generator.NewID()
+		if err != nil {
+			return err
+		}
+		if err = put(id); !errors.Is(err, ErrIDTaken) {
+			return err
+		}
+	}
+	return ErrIDCollision
+}
+
+func NewRepository(ctx context.Context, cfg *config.ShortenConfig, opts ...Option) (LinksRepository, error) {
 	var repo LinksRepository
 	var err error
+	opts = append([]Option{WithDedupScope(cfg.DedupScope)}, opts...)
 	switch cfg.GetRepositoryType() {
 	case config.FileRepo:
 		log.Info().Msgf("FileRepository %s", cfg.FileStoragePath)
-		repo, err = NewFileLinksRepository(ctx, cfg.FileStoragePath)
+		repo, err = NewFileLinksRepository(ctx, cfg.FileStoragePath, opts...)
 		if err != nil {
 			return nil, err
 		}
 	case config.DatabaseRepo:
 		log.Info().Msg("DatabaseRepo")
-		repo, err = NewPgLinksRepository(ctx, cfg.DatabaseDSN)
+		repo, err = NewPgLinksRepository(ctx, cfg.DatabaseDSN, opts...)
 		if err != nil {
 			return nil, err
 		}
 	default:
 		log.Info().Msg("MemoryRepository")
-		repo = NewInMemoryLinksRepository(context.Background(), nil)
+		repo = NewInMemoryLinksRepository(context.Background(), nil, opts...)
 	}
 
 	return repo, nil
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"github.com/zaz600/go-musthave-shortener/internal/app/config"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/shortid"
+)
+
+// maxIDAttempts сколько раз пытаться подобрать свободный короткий идентификатор при коллизиях
+const maxIDAttempts = 10
+
+// Option настройка репозитория
+type Option func(*options)
+
+// options общие для всех реализаций LinksRepository настройки
+type options struct {
+	// dedupScope область поиска дубликатов длинных ссылок
+	dedupScope config.DedupScope
+	// quota ограничение количества активных ссылок пользователя. Опционально
+	quota LinksQuota
+	// idGenerator генерирует новый идентификатор, если идентификатор ссылки уже занят
+	idGenerator IDGenerator
+	// canonicalizer приводит к каноническому виду ссылки, сохраненные до появления канонизации. Опционально
+	canonicalizer URLCanonicalizer
+}
+
+// URLCanonicalizer приводит ссылки к каноническому виду
+type URLCanonicalizer interface {
+	// Canonicalize возвращает каноническую форму ссылки rawURL
+	Canonicalize(rawURL string) (string, error)
+}
+
+// IDGenerator генератор коротких идентификаторов ссылок
+type IDGenerator interface {
+	// NewID возвращает новый идентификатор
+	NewID() (string, error)
+}
+
+// LinksQuota ограничение количества активных ссылок пользователя
+type LinksQuota interface {
+	// MaxLinks максимальное количество активных ссылок пользователя. 0 - без ограничений
+	MaxLinks(uid string) int
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		dedupScope:  config.DedupGlobal,
+		idGenerator: shortid.Default(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithDedupScope задает область, в пределах которой длинные ссылки считаются дубликатами
+func WithDedupScope(scope config.DedupScope) Option {
+	return func(o *options) {
+		o.dedupScope = scope
+	}
+}
+
+// WithLinksQuota включает ограничение количества активных ссылок пользователя.
+// При превышении сохранение ссылок завершается ошибкой ErrQuotaExceeded
+func WithLinksQuota(quota LinksQuota) Option {
+	return func(o *options) {
+		o.quota = quota
+	}
+}
+
+// WithIDGenerator задает генератор, которым репозиторий заменяет занятые идентификаторы ссылок.
+// Стоит передавать тот же генератор, которым идентификаторы создает сервис
+func WithIDGenerator(generator IDGenerator) Option {
+	return func(o *options) {
+		o.idGenerator = generator
+	}
+}
+
+// WithCanonicalizer задает, как приводить к каноническому виду ссылки, сохраненные до появления канонизации,
+// чтобы они находились как дубликаты новых ссылок. Стоит передавать тот же канонизатор, что и сервису
+func WithCanonicalizer(canonicalizer URLCanonicalizer) Option {
+	return func(o *options) {
+		o.canonicalizer = canonicalizer
+	}
+}
+
+// legacyCanonicalURL возвращает каноническую форму адреса ссылки, сохраненной до появления канонизации.
+// false - канонизатор не задан или адрес не удалось разобрать, тогда дубликаты ищутся по OriginalURL
+func (o options) legacyCanonicalURL(e entity.LinkEntity) (string, bool) {
+	if o.canonicalizer == nil {
+		return "", false
+	}
+	canonicalURL, err := o.canonicalizer.Canonicalize(e.OriginalURL)
+	if err != nil {
+		return "", false
+	}
+	return canonicalURL, true
+}
+
+// maxLinks максимальное количество активных ссылок пользователя. 0 - без ограничений
+func (o options) maxLinks(uid string) int {
+	if o.quota == nil {
+		return 0
+	}
+	return o.quota.MaxLinks(uid)
+}
+
+// isDuplicate возвращает true, если новая ссылка candidate дублирует ранее сохраненную ссылку stored
+func (o options) isDuplicate(stored entity.LinkEntity, candidate entity.LinkEntity) bool {
+	if !stored.Deduplicable() || !candidate.Deduplicable() {
+		return false
+	}
+	switch o.dedupScope {
+	case config.DedupNone:
+		return false
+	case config.DedupPerUser:
+		return stored.DedupURL() == candidate.DedupURL() && stored.IsOwnedByUser(candidate.UID)
+	default:
+		return stored.DedupURL() == candidate.DedupURL()
+	}
+}
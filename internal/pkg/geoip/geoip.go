@@ -0,0 +1,53 @@
+// Package geoip определение страны посетителя по IP-адресу
+// по локальной базе в формате MaxMind DB: GeoLite2-Country, GeoIP2-City и совместимые.
+package geoip
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ErrInvalidIP адрес не удалось разобрать
+var ErrInvalidIP = errors.New("invalid ip address")
+
+// DB база стран по IP-адресам. Безопасна для одновременного использования
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+// Open открывает файл базы path
+func Open(path string) (*DB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{reader: reader}, nil
+}
+
+// countryRecord часть записи базы, из которой берется страна
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// Country возвращает двухбуквенный код страны ISO 3166-1 в верхнем регистре.
+// Для адресов, которых нет в базе, возвращает пустую строку
+func (db *DB) Country(ip net.IP) (string, error) {
+	if ip == nil {
+		return "", ErrInvalidIP
+	}
+	var record countryRecord
+	if err := db.reader.Lookup(ip, &record); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(record.Country.ISOCode), nil
+}
+
+// Close закрывает файл базы
+func (db *DB) Close() error {
+	return db.reader.Close()
+}
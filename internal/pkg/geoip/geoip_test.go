@@ -0,0 +1,78 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbString кодирует строку по формату MaxMind DB, строки в тесте короче 29 байт
+func mmdbString(s string) []byte {
+	return append([]byte{0x40 | byte(len(s))}, s...)
+}
+
+// countryData запись базы {"country": {"iso_code": code}}
+func countryData(code string) []byte {
+	data := []byte{0xE1}
+	data = append(data, mmdbString("country")...)
+	data = append(data, 0xE1)
+	data = append(data, mmdbString("iso_code")...)
+	return append(data, mmdbString(code)...)
+}
+
+// writeTestDatabase пишет базу IPv4 из одного узла: 0.0.0.0/1 - RU, 128.0.0.0/1 - US
+func writeTestDatabase(t *testing.T) string {
+	t.Helper()
+
+	ru, us := countryData("RU"), countryData("US")
+	const nodeCount = 1
+	left := nodeCount + 16
+	right := left + len(ru)
+
+	var db []byte
+	// узел с записями по 24 бита
+	db = append(db, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+	db = append(db, make([]byte, 16)...)
+	db = append(db, ru...)
+	db = append(db, us...)
+	db = append(db, "\xab\xcd\xefMaxMind.com"...)
+	db = append(db, 0xE3)
+	db = append(db, mmdbString("node_count")...)
+	db = append(db, 0xC1, nodeCount)
+	db = append(db, mmdbString("record_size")...)
+	db = append(db, 0xA1, 24)
+	db = append(db, mmdbString("ip_version")...)
+	db = append(db, 0xA1, 4)
+
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	require.NoError(t, os.WriteFile(path, db, 0o600))
+	return path
+}
+
+func TestDB_Country(t *testing.T) {
+	db, err := Open(writeTestDatabase(t))
+	require.NoError(t, err)
+	defer db.Close()
+
+	country, err := db.Country(net.ParseIP("5.255.255.5"))
+	require.NoError(t, err)
+	assert.Equal(t, "RU", country)
+
+	country, err = db.Country(net.ParseIP("198.51.100.1"))
+	require.NoError(t, err)
+	assert.Equal(t, "US", country)
+
+	_, err = db.Country(nil)
+	assert.ErrorIs(t, err, ErrInvalidIP)
+}
+
+func TestOpen_NotDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.mmdb")
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o600))
+	_, err := Open(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,202 @@
+// Package qr генерация QR кодов для коротких ссылок в форматах PNG и SVG.
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	// DefaultSize размер изображения по умолчанию, в пикселях
+	DefaultSize = 256
+	// MinSize минимальный размер изображения
+	MinSize = 32
+	// MaxSize максимальный размер изображения
+	MaxSize = 2048
+	// DefaultMargin ширина пустого поля вокруг кода по умолчанию, в модулях. Стандарт требует не меньше 4
+	DefaultMargin = 4
+	// MaxMargin максимальная ширина пустого поля
+	MaxMargin = 16
+)
+
+// Format формат изображения
+type Format string
+
+const (
+	// FormatPNG растровое изображение
+	FormatPNG Format = "png"
+	// FormatSVG векторное изображение
+	FormatSVG Format = "svg"
+)
+
+// ContentType возвращает MIME тип формата
+func (f Format) ContentType() string {
+	if f == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// ParseFormat разбирает название формата изображения
+func ParseFormat(value string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(value))); f {
+	case FormatPNG, FormatSVG:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown qr format '%s', expected png or svg", value)
+	}
+}
+
+// Level уровень коррекции ошибок: L, M, Q, H. Чем выше уровень, тем большую часть кода можно повредить
+type Level string
+
+const (
+	// LevelLow восстанавливается до 7% кода
+	LevelLow Level = "L"
+	// LevelMedium восстанавливается до 15% кода
+	LevelMedium Level = "M"
+	// LevelQuartile восстанавливается до 25% кода
+	LevelQuartile Level = "Q"
+	// LevelHigh восстанавливается до 30% кода
+	LevelHigh Level = "H"
+)
+
+// ParseLevel разбирает уровень коррекции ошибок
+func ParseLevel(value string) (Level, error) {
+	switch l := Level(strings.ToUpper(strings.TrimSpace(value))); l {
+	case LevelLow, LevelMedium, LevelQuartile, LevelHigh:
+		return l, nil
+	default:
+		return "", fmt.Errorf("unknown qr error correction level '%s', expected L, M, Q or H", value)
+	}
+}
+
+func (l Level) recoveryLevel() qrcode.RecoveryLevel {
+	switch l {
+	case LevelLow:
+		return qrcode.Low
+	case LevelQuartile:
+		return qrcode.High
+	case LevelHigh:
+		return qrcode.Highest
+	default:
+		return qrcode.Medium
+	}
+}
+
+// Options параметры изображения QR кода
+type Options struct {
+	// Format формат изображения
+	Format Format
+	// Size ширина и высота изображения в пикселях
+	Size int
+	// Level уровень коррекции ошибок
+	Level Level
+	// Margin ширина пустого поля вокруг кода в модулях
+	Margin int
+}
+
+// DefaultOptions параметры по умолчанию: PNG 256x256, уровень M, стандартное поле
+func DefaultOptions() Options {
+	return Options{
+		Format: FormatPNG,
+		Size:   DefaultSize,
+		Level:  LevelMedium,
+		Margin: DefaultMargin,
+	}
+}
+
+// Validate проверяет, что параметры в допустимых пределах
+func (o Options) Validate() error {
+	if _, err := ParseFormat(string(o.Format)); err != nil {
+		return err
+	}
+	if _, err := ParseLevel(string(o.Level)); err != nil {
+		return err
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("qr size must be between %d and %d", MinSize, MaxSize)
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("qr margin must be between 0 and %d", MaxMargin)
+	}
+	return nil
+}
+
+// ErrTooSmall содержимое не помещается в изображение заданного размера
+var ErrTooSmall = errors.New("qr size is too small for the content")
+
+// Encode возвращает изображение QR кода с содержимым content
+func Encode(content string, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	code, err := qrcode.New(content, opts.Level.recoveryLevel())
+	if err != nil {
+		return nil, err
+	}
+	// пустое поле рисуется здесь, чтобы его ширина была одинаковой в обоих форматах
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	modules := len(bitmap) + 2*opts.Margin
+	if opts.Size < modules {
+		return nil, ErrTooSmall
+	}
+	if opts.Format == FormatSVG {
+		return encodeSVG(bitmap, opts), nil
+	}
+	return encodePNG(bitmap, opts, modules)
+}
+
+// encodePNG рисует код целым числом пикселей на модуль, остаток размера делится поровну между краями
+func encodePNG(bitmap [][]bool, opts Options, modules int) ([]byte, error) {
+	scale := opts.Size / modules
+	offset := (opts.Size-scale*modules)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{color.White, color.Black})
+	for y, row := range bitmap {
+		for x, set := range row {
+			if !set {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(offset+x*scale+dx, offset+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeSVG рисует код одним путем, модуль - квадрат 1x1 в координатах viewBox
+func encodeSVG(bitmap [][]bool, opts Options) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+	for y, row := range bitmap {
+		for x, set := range row {
+			if set {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
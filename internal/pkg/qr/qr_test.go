@@ -0,0 +1,99 @@
+package qr_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/qr"
+)
+
+func TestEncode_PNG(t *testing.T) {
+	// короткое содержимое помещается в версию 1: 21x21 модуль
+	tests := []struct {
+		name   string
+		size   int
+		margin int
+		// first первый черный пиксель на диагонали
+		first int
+	}{
+		{name: "default margin", size: 290, margin: qr.DefaultMargin, first: 40},
+		{name: "no margin", size: 210, margin: 0, first: 0},
+		{name: "centered", size: 300, margin: qr.DefaultMargin, first: 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := qr.DefaultOptions()
+			opts.Size = tt.size
+			opts.Margin = tt.margin
+
+			data, err := qr.Encode("abc", opts)
+			require.NoError(t, err)
+			img, err := png.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, tt.size, img.Bounds().Dx())
+			assert.Equal(t, tt.size, img.Bounds().Dy())
+
+			black := color.GrayModel.Convert(color.Black)
+			if tt.first > 0 {
+				assert.NotEqual(t, black, color.GrayModel.Convert(img.At(tt.first-1, tt.first-1)))
+			}
+			assert.Equal(t, black, color.GrayModel.Convert(img.At(tt.first, tt.first)))
+		})
+	}
+}
+
+func TestEncode_SVG(t *testing.T) {
+	opts := qr.DefaultOptions()
+	opts.Format = qr.FormatSVG
+
+	data, err := qr.Encode("abc", opts)
+	require.NoError(t, err)
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, "<svg"))
+	assert.Contains(t, svg, `width="256" height="256"`)
+	// 21 модуль версии 1 плюс поле по 4 модуля с каждой стороны
+	assert.Contains(t, svg, `viewBox="0 0 29 29"`)
+	assert.Contains(t, svg, "M4 4h1v1h-1z")
+}
+
+func TestEncode_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *qr.Options)
+	}{
+		{name: "unknown format", modify: func(o *qr.Options) { o.Format = "gif" }},
+		{name: "unknown level", modify: func(o *qr.Options) { o.Level = "X" }},
+		{name: "too small", modify: func(o *qr.Options) { o.Size = 16 }},
+		{name: "too large", modify: func(o *qr.Options) { o.Size = 10000 }},
+		{name: "negative margin", modify: func(o *qr.Options) { o.Margin = -1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := qr.DefaultOptions()
+			tt.modify(&opts)
+			_, err := qr.Encode("http://localhost:8080/abc", opts)
+			assert.Error(t, err)
+		})
+	}
+
+	// длинное содержимое не помещается в минимальный размер
+	opts := qr.DefaultOptions()
+	opts.Size = qr.MinSize
+	_, err := qr.Encode("http://localhost:8080/"+strings.Repeat("a", 200), opts)
+	assert.ErrorIs(t, err, qr.ErrTooSmall)
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, value := range []string{"l", "M", "q", "H"} {
+		level, err := qr.ParseLevel(value)
+		require.NoError(t, err)
+		assert.Equal(t, qr.Level(strings.ToUpper(value)), level)
+	}
+	_, err := qr.ParseLevel("")
+	assert.Error(t, err)
+}
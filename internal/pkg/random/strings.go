@@ -1,13 +1,20 @@
 package random
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/base64"
 	"math/rand"
+	"sync"
 	"time"
 )
 
 const charSet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-var seededRand = rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+var (
+	// seededRand не потокобезопасен, доступ к нему защищен seededRandMu
+	seededRand   = rand.New(rand.NewSource(time.Now().UnixNano())) //nolint:gosec
+	seededRandMu sync.Mutex
+)
 
 // String генерирует случайную строку заданной длинны,
 // содержащую букво-циферную последовательность символов.
@@ -16,6 +23,8 @@ func String(length int) string {
 		return ""
 	}
 	b := make([]byte, length)
+	seededRandMu.Lock()
+	defer seededRandMu.Unlock()
 	for i := range b {
 		b[i] = charSet[seededRand.Intn(len(charSet))]
 	}
@@ -27,3 +36,13 @@ func String(length int) string {
 func UserID() string {
 	return String(24)
 }
+
+// Token генерирует секретный токен из size криптографически случайных байт в кодировке base64url.
+// В отличие от String подходит для секретов, которые нельзя подобрать
+func Token(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := cryptorand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/zaz600/go-musthave-shortener/internal/pkg/random"
 )
 
@@ -17,6 +18,15 @@ func TestString(t *testing.T) {
 	assert.NotEqual(t, random.String(10), random.String(10))
 }
 
+func TestToken(t *testing.T) {
+	token, err := random.Token(32)
+	require.NoError(t, err)
+	assert.Len(t, token, 43)
+	other, err := random.Token(32)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
 func TestUserID(t *testing.T) {
 	assert.Len(t, random.UserID(), 24)
 	assert.NotEqual(t, random.UserID(), random.UserID())
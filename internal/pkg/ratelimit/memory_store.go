@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval как часто MemoryStore удаляет восстановившиеся корзины
+const sweepInterval = time.Minute
+
+// memoryBucket корзина вместе с параметрами, с которыми ее последний раз использовали
+type memoryBucket struct {
+	bucket
+	limit Limit
+}
+
+// MemoryStore хранит корзины в памяти процесса.
+// Полностью восстановившиеся корзины периодически удаляются, т.к. не отличаются от новых.
+type MemoryStore struct {
+	mu        *sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu:      &sync.Mutex{},
+		buckets: make(map[string]*memoryBucket),
+		now:     time.Now,
+	}
+}
+
+// Take списывает n токенов из корзины key с параметрами limit.
+func (m *MemoryStore) Take(_ context.Context, key string, limit Limit, n int) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: bucket{tokens: float64(limit.Burst), updated: now}}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+	return b.take(now, limit, n), nil
+}
+
+// Refund возвращает в корзину key n токенов, списанных Take
+func (m *MemoryStore) Refund(_ context.Context, key string, limit Limit, n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// удаленная корзина и так полна
+	if b, ok := m.buckets[key]; ok {
+		b.refund(limit, n)
+	}
+	return nil
+}
+
+// sweep удаляет полностью восстановившиеся корзины
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if b.isFull(now, b.limit) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Package ratelimit ограничение частоты запросов по алгоритму token bucket.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit параметры корзины: Burst токенов, которые полностью восстанавливаются за Period.
+// Нулевой Limit означает отсутствие ограничения.
+type Limit struct {
+	// Burst емкость корзины - сколько запросов можно сделать подряд
+	Burst int
+	// Period время полного восстановления корзины
+	Period time.Duration
+}
+
+// ParseLimit разбирает ограничение в формате <burst>/<period>, например 60/1m.
+// Пустая строка и 0 означают отсутствие ограничения.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return Limit{}, nil
+	}
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit '%s', expected <burst>/<period>", value)
+	}
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit burst '%s'", parts[0])
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit period '%s'", parts[1])
+	}
+	return Limit{Burst: burst, Period: period}, nil
+}
+
+// Enabled возвращает true, если ограничение задано
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Period > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// rate скорость восстановления корзины в токенах в секунду
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// Result результат попытки списать токены из корзины
+type Result struct {
+	// Allowed токены списаны, запрос можно выполнять
+	Allowed bool
+	// Limit емкость корзины
+	Limit int
+	// Remaining сколько токенов осталось в корзине
+	Remaining int
+	// ResetAfter через сколько корзина восстановится полностью
+	ResetAfter time.Duration
+	// RetryAfter через сколько в корзине наберется нужное число токенов. Заполняется, если Allowed == false
+	RetryAfter time.Duration
+}
+
+// Store хранилище корзин
+type Store interface {
+	// Take списывает n токенов из корзины key с параметрами limit.
+	// Если токенов не хватает, корзина не меняется, а Result.Allowed == false.
+	// При n == 0 корзина только проверяется: если в ней нет целого токена, RetryAfter - когда он появится.
+	Take(ctx context.Context, key string, limit Limit, n int) (Result, error)
+	// Refund возвращает в корзину key n токенов, списанных Take, если запрос все-таки не выполнен.
+	// Корзина не наполняется больше Burst
+	Refund(ctx context.Context, key string, limit Limit, n int) error
+}
+
+// bucket состояние корзины
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take пополняет корзину на время, прошедшее с последнего обращения, и списывает n токенов
+func (b *bucket) take(now time.Time, limit Limit, n int) Result {
+	burst := float64(limit.Burst)
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*limit.rate())
+	}
+	b.updated = now
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= float64(n) {
+		b.tokens -= float64(n)
+		result.Allowed = true
+	} else if n <= limit.Burst {
+		result.RetryAfter = durationFor(float64(n)-b.tokens, limit)
+	} else {
+		// столько токенов в корзине не будет никогда
+		result.RetryAfter = limit.Period
+	}
+	if n == 0 && b.tokens < 1 {
+		result.RetryAfter = durationFor(1-b.tokens, limit)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.ResetAfter = durationFor(burst-b.tokens, limit)
+	return result
+}
+
+// refund возвращает в корзину n токенов
+func (b *bucket) refund(limit Limit, n int) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+float64(n))
+}
+
+// isFull возвращает true, если к моменту now корзина восстановилась полностью
+func (b *bucket) isFull(now time.Time, limit Limit) bool {
+	return b.tokens+now.Sub(b.updated).Seconds()*limit.rate() >= float64(limit.Burst)
+}
+
+// durationFor время, за которое в корзину добавится tokens токенов
+func durationFor(tokens float64, limit Limit) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(tokens / limit.rate() * float64(time.Second)))
+}
@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "", want: Limit{}},
+		{value: "0", want: Limit{}},
+		{value: "60/1m", want: Limit{Burst: 60, Period: time.Minute}},
+		{value: " 5/1s ", want: Limit{Burst: 5, Period: time.Second}},
+		{value: "60", wantErr: true},
+		{value: "a/1m", wantErr: true},
+		{value: "10/0s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLimit(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Burst: 10, Period: 10 * time.Second}
+	ctx := context.Background()
+
+	res, err := store.Take(ctx, "a", limit, 4)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 10, res.Limit)
+	assert.Equal(t, 6, res.Remaining)
+	assert.Equal(t, 4*time.Second, res.ResetAfter)
+
+	res, _ = store.Take(ctx, "a", limit, 6)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// корзина пуста
+	res, _ = store.Take(ctx, "a", limit, 2)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 2*time.Second, res.RetryAfter)
+
+	// проверка без списания
+	res, _ = store.Take(ctx, "a", limit, 0)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// другие ключи не затронуты
+	res, _ = store.Take(ctx, "b", limit, 1)
+	assert.True(t, res.Allowed)
+
+	// через 2 секунды восстановилось 2 токена
+	now = now.Add(2 * time.Second)
+	res, _ = store.Take(ctx, "a", limit, 2)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// запрос больше емкости корзины не пройдет никогда
+	res, _ = store.Take(ctx, "c", limit, 11)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, limit.Period, res.RetryAfter)
+}
+
+func TestMemoryStore_Refund(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Burst: 3, Period: time.Minute}
+	ctx := context.Background()
+
+	_, _ = store.Take(ctx, "a", limit, 3)
+	require.NoError(t, store.Refund(ctx, "a", limit, 2))
+	res, _ := store.Take(ctx, "a", limit, 2)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// корзина не наполняется больше емкости
+	require.NoError(t, store.Refund(ctx, "a", limit, 10))
+	res, _ = store.Take(ctx, "a", limit, 0)
+	assert.Equal(t, 3, res.Remaining)
+
+	require.NoError(t, store.Refund(ctx, "unknown", limit, 1))
+	assert.NotContains(t, store.buckets, "unknown")
+}
+
+func TestMemoryStore_Sweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Burst: 1, Period: time.Second}
+
+	_, _ = store.Take(context.Background(), "a", limit, 1)
+	require.Len(t, store.buckets, 1)
+
+	now = now.Add(2 * sweepInterval)
+	_, _ = store.Take(context.Background(), "b", limit, 1)
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "b")
+}
@@ -0,0 +1,43 @@
+package shortid
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// Random генерирует криптографически случайные идентификаторы
+type Random struct {
+	alphabet string
+	length   int
+}
+
+// NewRandom создает генератор случайных идентификаторов длины length из символов alphabet
+func NewRandom(alphabet string, length int) *Random {
+	return &Random{
+		alphabet: alphabet,
+		length:   length,
+	}
+}
+
+// NewID возвращает новый случайный идентификатор.
+// Байты, которые нельзя равномерно отобразить в алфавит, отбрасываются
+func (g *Random) NewID() (string, error) {
+	limit := 256 - 256%len(g.alphabet)
+	result := make([]byte, 0, g.length)
+	buf := make([]byte, g.length*2)
+	for len(result) < g.length {
+		if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			result = append(result, g.alphabet[int(b)%len(g.alphabet)])
+			if len(result) == g.length {
+				break
+			}
+		}
+	}
+	return string(result), nil
+}
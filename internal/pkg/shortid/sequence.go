@@ -0,0 +1,113 @@
+package shortid
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"math/rand"
+	"sync/atomic"
+)
+
+// counter потокобезопасный счетчик выданных идентификаторов
+type counter struct {
+	next uint64
+}
+
+// take возвращает очередное значение счетчика
+func (c *counter) take() uint64 {
+	return atomic.AddUint64(&c.next, 1) - 1
+}
+
+// Advance сдвигает счетчик так, чтобы следующим было выдано значение не меньше n
+func (c *counter) Advance(n uint64) {
+	for {
+		current := atomic.LoadUint64(&c.next)
+		if current >= n || atomic.CompareAndSwapUint64(&c.next, current, n) {
+			return
+		}
+	}
+}
+
+// Sequence выдает значения счетчика, записанные в алфавите: aaaaaaaa, aaaaaaab, ...
+type Sequence struct {
+	counter
+	alphabet string
+	length   int
+	space    *big.Int
+}
+
+// NewSequence создает генератор последовательных идентификаторов длины length из символов alphabet
+func NewSequence(alphabet string, length int) *Sequence {
+	return &Sequence{
+		alphabet: alphabet,
+		length:   length,
+		space:    space(len(alphabet), length),
+	}
+}
+
+// NewID возвращает следующий идентификатор последовательности
+func (g *Sequence) NewID() (string, error) {
+	n := new(big.Int).SetUint64(g.take())
+	if n.Cmp(g.space) >= 0 {
+		return "", ErrExhausted
+	}
+	return encode(g.alphabet, g.length, n), nil
+}
+
+// Hashids выдает значения счетчика, взаимно однозначно перемешанные солью.
+// Идентификаторы не повторяются, пока не исчерпано пространство, но по ним нельзя угадать соседние
+type Hashids struct {
+	counter
+	alphabet   string
+	length     int
+	space      *big.Int
+	multiplier *big.Int
+	offset     *big.Int
+}
+
+// NewHashids создает генератор обфусцированных идентификаторов длины length из символов alphabet.
+// Разные соли дают разные последовательности
+func NewHashids(alphabet string, length int, salt string) *Hashids {
+	sum := sha256.Sum256([]byte(salt))
+	seed := binary.BigEndian.Uint64(sum[0:8])
+
+	// алфавит перемешивается солью, чтобы по идентификатору нельзя было восстановить счетчик
+	shuffled := []byte(alphabet)
+	rnd := rand.New(rand.NewSource(int64(seed))) //nolint:gosec
+	rnd.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	s := space(len(alphabet), length)
+	// умножение на взаимно простое с размером пространства число - перестановка значений
+	multiplier := new(big.Int).SetUint64(binary.BigEndian.Uint64(sum[8:16]) | 1)
+	multiplier.Mod(multiplier, s)
+	gcd := new(big.Int)
+	one := big.NewInt(1)
+	for gcd.GCD(nil, nil, multiplier, s).Cmp(one) != 0 {
+		multiplier.Add(multiplier, one)
+		multiplier.Mod(multiplier, s)
+	}
+	offset := new(big.Int).SetUint64(binary.BigEndian.Uint64(sum[16:24]))
+	offset.Mod(offset, s)
+
+	return &Hashids{
+		alphabet:   string(shuffled),
+		length:     length,
+		space:      s,
+		multiplier: multiplier,
+		offset:     offset,
+	}
+}
+
+// NewID возвращает следующий идентификатор
+func (g *Hashids) NewID() (string, error) {
+	n := new(big.Int).SetUint64(g.take())
+	if n.Cmp(g.space) >= 0 {
+		return "", ErrExhausted
+	}
+	n.Mul(n, g.multiplier)
+	n.Add(n, g.offset)
+	n.Mod(n, g.space)
+	return encode(g.alphabet, g.length, n), nil
+}
@@ -0,0 +1,142 @@
+// Package shortid генерация коротких идентификаторов ссылок.
+package shortid
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	// DefaultAlphabet алфавит идентификаторов по умолчанию - base62
+	DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// DefaultLength длина идентификатора по умолчанию
+	DefaultLength = 8
+
+	// maxLength максимальная длина идентификатора
+	maxLength = 64
+	// urlSafeChars символы, которые можно использовать в алфавите без экранирования в пути ссылки
+	urlSafeChars = DefaultAlphabet + "-_.~"
+)
+
+// ErrExhausted генератор выдал все идентификаторы заданной длины
+var ErrExhausted = errors.New("short id space exhausted")
+
+// Generator генератор коротких идентификаторов ссылок.
+// Реализации безопасны для использования из нескольких горутин
+type Generator interface {
+	// NewID возвращает новый идентификатор
+	NewID() (string, error)
+}
+
+// Advancer генератор на основе счетчика, который умеет пропускать уже выданные значения.
+// Используется при старте, чтобы не перебирать идентификаторы, сохраненные до рестарта
+type Advancer interface {
+	// Advance сдвигает счетчик так, чтобы следующим было выдано значение не меньше n
+	Advance(n uint64)
+}
+
+// Strategy способ генерации идентификаторов
+type Strategy string
+
+const (
+	// StrategyRandom криптографически случайные идентификаторы
+	StrategyRandom Strategy = "random"
+	// StrategySequence последовательный счетчик, записанный в алфавите
+	StrategySequence Strategy = "sequence"
+	// StrategyHashids счетчик, перемешанный солью так, что соседние идентификаторы не похожи друг на друга
+	StrategyHashids Strategy = "hashids"
+)
+
+// ParseStrategy разбирает название стратегии генерации идентификаторов
+func ParseStrategy(value string) (Strategy, error) {
+	switch s := Strategy(strings.ToLower(strings.TrimSpace(value))); s {
+	case StrategyRandom, StrategySequence, StrategyHashids:
+		return s, nil
+	case "":
+		return StrategyRandom, nil
+	default:
+		return "", fmt.Errorf("unknown id strategy '%s', expected random, sequence or hashids", value)
+	}
+}
+
+// Config настройки генератора идентификаторов
+type Config struct {
+	// Strategy способ генерации. По умолчанию StrategyRandom
+	Strategy Strategy
+	// Alphabet символы идентификатора. По умолчанию DefaultAlphabet
+	Alphabet string
+	// Length длина идентификатора. По умолчанию DefaultLength
+	Length int
+	// Salt соль для StrategyHashids
+	Salt string
+}
+
+// New создает генератор идентификаторов по настройкам cfg
+func New(cfg Config) (Generator, error) {
+	if cfg.Alphabet == "" {
+		cfg.Alphabet = DefaultAlphabet
+	}
+	if cfg.Length == 0 {
+		cfg.Length = DefaultLength
+	}
+	if err := validate(cfg.Alphabet, cfg.Length); err != nil {
+		return nil, err
+	}
+
+	switch cfg.Strategy {
+	case StrategyRandom, "":
+		return NewRandom(cfg.Alphabet, cfg.Length), nil
+	case StrategySequence:
+		return NewSequence(cfg.Alphabet, cfg.Length), nil
+	case StrategyHashids:
+		return NewHashids(cfg.Alphabet, cfg.Length, cfg.Salt), nil
+	default:
+		return nil, fmt.Errorf("unknown id strategy '%s'", cfg.Strategy)
+	}
+}
+
+// Default генератор случайных base62 идентификаторов длины DefaultLength
+func Default() Generator {
+	return NewRandom(DefaultAlphabet, DefaultLength)
+}
+
+// validate проверяет, что из алфавита получатся однозначные и безопасные для URL идентификаторы
+func validate(alphabet string, length int) error {
+	if length < 1 || length > maxLength {
+		return fmt.Errorf("id length must be between 1 and %d, got %d", maxLength, length)
+	}
+	if len(alphabet) < 2 {
+		return errors.New("id alphabet must contain at least 2 characters")
+	}
+	seen := make(map[rune]bool, len(alphabet))
+	for _, c := range alphabet {
+		if !strings.ContainsRune(urlSafeChars, c) {
+			return fmt.Errorf("id alphabet character '%c' is not url safe", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("id alphabet character '%c' is duplicated", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// space количество различных идентификаторов длины length в алфавите из base символов
+func space(base int, length int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(int64(base)), big.NewInt(int64(length)), nil)
+}
+
+// encode записывает число n в алфавите, дополняя слева нулевым символом до длины length
+func encode(alphabet string, length int, n *big.Int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	value := new(big.Int).Set(n)
+	digit := new(big.Int)
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		value.DivMod(value, base, digit)
+		b[i] = alphabet[digit.Int64()]
+	}
+	return string(b)
+}
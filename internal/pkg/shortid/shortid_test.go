@@ -0,0 +1,135 @@
+package shortid_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/shortid"
+)
+
+func TestParseStrategy(t *testing.T) {
+	for value, want := range map[string]shortid.Strategy{
+		"":         shortid.StrategyRandom,
+		"random":   shortid.StrategyRandom,
+		"Sequence": shortid.StrategySequence,
+		"hashids":  shortid.StrategyHashids,
+	} {
+		actual, err := shortid.ParseStrategy(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, actual, value)
+	}
+	_, err := shortid.ParseStrategy("uuid")
+	assert.Error(t, err)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  shortid.Config
+	}{
+		{name: "short alphabet", cfg: shortid.Config{Alphabet: "a"}},
+		{name: "duplicated char", cfg: shortid.Config{Alphabet: "abca"}},
+		{name: "unsafe char", cfg: shortid.Config{Alphabet: "ab/"}},
+		{name: "negative length", cfg: shortid.Config{Length: -1}},
+		{name: "too long", cfg: shortid.Config{Length: 100}},
+		{name: "unknown strategy", cfg: shortid.Config{Strategy: "uuid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := shortid.New(tt.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	for _, strategy := range []shortid.Strategy{shortid.StrategyRandom, shortid.StrategySequence, shortid.StrategyHashids} {
+		strategy := strategy
+		t.Run(string(strategy), func(t *testing.T) {
+			gen, err := shortid.New(shortid.Config{Strategy: strategy, Alphabet: "abcdef0123", Length: 6, Salt: "salt"})
+			require.NoError(t, err)
+
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			seen := make(map[string]bool)
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 250; j++ {
+						id, err := gen.NewID()
+						assert.NoError(t, err)
+						assert.Len(t, id, 6)
+						assert.Empty(t, strings.Trim(id, "abcdef0123"))
+						mu.Lock()
+						seen[id] = true
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			if strategy != shortid.StrategyRandom {
+				// счетчики не дают повторов
+				assert.Len(t, seen, 1000)
+			}
+		})
+	}
+}
+
+func TestSequence(t *testing.T) {
+	gen := shortid.NewSequence("ab", 3)
+	var ids []string
+	for i := 0; i < 8; i++ {
+		id, err := gen.NewID()
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []string{"aaa", "aab", "aba", "abb", "baa", "bab", "bba", "bbb"}, ids)
+	_, err := gen.NewID()
+	assert.ErrorIs(t, err, shortid.ErrExhausted)
+}
+
+func TestSequence_Advance(t *testing.T) {
+	gen := shortid.NewSequence(shortid.DefaultAlphabet, 4)
+	gen.Advance(62)
+	id, err := gen.NewID()
+	require.NoError(t, err)
+	assert.Equal(t, "aaba", id)
+
+	// назад счетчик не сдвигается
+	gen.Advance(1)
+	id, err = gen.NewID()
+	require.NoError(t, err)
+	assert.Equal(t, "aabb", id)
+}
+
+func TestHashids(t *testing.T) {
+	gen := shortid.NewHashids("ab01", 3, "salt")
+	seen := make(map[string]bool)
+	for i := 0; i < 64; i++ {
+		id, err := gen.NewID()
+		require.NoError(t, err)
+		seen[id] = true
+	}
+	// перестановка покрывает все пространство без повторов
+	assert.Len(t, seen, 64)
+	_, err := gen.NewID()
+	assert.ErrorIs(t, err, shortid.ErrExhausted)
+
+	first, _ := shortid.NewHashids(shortid.DefaultAlphabet, 8, "salt").NewID()
+	same, _ := shortid.NewHashids(shortid.DefaultAlphabet, 8, "salt").NewID()
+	other, _ := shortid.NewHashids(shortid.DefaultAlphabet, 8, "pepper").NewID()
+	assert.Equal(t, first, same)
+	assert.NotEqual(t, first, other)
+}
+
+func ExampleNew() {
+	gen, _ := shortid.New(shortid.Config{Strategy: shortid.StrategySequence, Length: 4})
+	id, _ := gen.NewID()
+	fmt.Println(id)
+	// Output: aaaa
+}
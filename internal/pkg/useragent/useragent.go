@@ -0,0 +1,74 @@
+// Package useragent грубое определение платформы и типа устройства по заголовку User-Agent.
+// Точности достаточно, чтобы выбрать магазин приложений или мобильную версию сайта
+package useragent
+
+import "strings"
+
+// Platform операционная система устройства
+type Platform string
+
+const (
+	// PlatformUnknown платформу определить не удалось
+	PlatformUnknown Platform = ""
+	// PlatformIOS iPhone, iPad, iPod
+	PlatformIOS Platform = "ios"
+	// PlatformAndroid Android
+	PlatformAndroid Platform = "android"
+	// PlatformWindows Windows
+	PlatformWindows Platform = "windows"
+	// PlatformMacOS macOS
+	PlatformMacOS Platform = "macos"
+	// PlatformLinux Linux и ChromeOS
+	PlatformLinux Platform = "linux"
+)
+
+// Device тип устройства
+type Device string
+
+const (
+	// DeviceUnknown тип устройства определить не удалось
+	DeviceUnknown Device = ""
+	// DeviceMobile телефон
+	DeviceMobile Device = "mobile"
+	// DeviceTablet планшет
+	DeviceTablet Device = "tablet"
+	// DeviceDesktop компьютер
+	DeviceDesktop Device = "desktop"
+)
+
+// Info платформа и тип устройства
+type Info struct {
+	Platform Platform
+	Device   Device
+}
+
+// Parse определяет платформу и тип устройства по значению заголовка User-Agent
+func Parse(userAgent string) Info {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return Info{}
+	case strings.Contains(ua, "ipad"):
+		return Info{Platform: PlatformIOS, Device: DeviceTablet}
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		return Info{Platform: PlatformIOS, Device: DeviceMobile}
+	case strings.Contains(ua, "android"):
+		// планшеты на Android не пишут Mobile в User-Agent
+		if strings.Contains(ua, "mobile") {
+			return Info{Platform: PlatformAndroid, Device: DeviceMobile}
+		}
+		return Info{Platform: PlatformAndroid, Device: DeviceTablet}
+	case strings.Contains(ua, "windows phone"):
+		return Info{Platform: PlatformWindows, Device: DeviceMobile}
+	case strings.Contains(ua, "windows"):
+		return Info{Platform: PlatformWindows, Device: DeviceDesktop}
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return Info{Platform: PlatformMacOS, Device: DeviceDesktop}
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"), strings.Contains(ua, "cros"):
+		return Info{Platform: PlatformLinux, Device: DeviceDesktop}
+	case strings.Contains(ua, "mobi"):
+		return Info{Device: DeviceMobile}
+	default:
+		return Info{}
+	}
+}
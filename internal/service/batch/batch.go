@@ -24,6 +24,9 @@ type Service struct {
 	buffer []entity.LinkEntity
 	// linksRepository хранилище ссылок, в которое производится запись при заполнении буфера
 	linksRepository repository.LinksRepository
+	// saved ссылки, уже записанные в хранилище. Идентификаторы могут отличаться от добавленных,
+	// если хранилище заменило занятые идентификаторы
+	saved []entity.LinkEntity
 }
 
 func NewBatchService(batchSize int, repository repository.LinksRepository) *Service {
@@ -50,10 +53,16 @@ func (b *Service) Flush(ctx context.Context) error {
 	if len(b.buffer) == 0 {
 		return nil
 	}
-	err := b.linksRepository.PutBatch(ctx, b.buffer)
+	saved, err := b.linksRepository.PutBatch(ctx, b.buffer)
 	if err != nil {
 		return err
 	}
+	b.saved = append(b.saved, saved...)
 	b.buffer = b.buffer[:0]
 	return nil
 }
+
+// Saved возвращает ссылки, записанные в хранилище, в порядке добавления
+func (b *Service) Saved() []entity.LinkEntity {
+	return b.saved
+}
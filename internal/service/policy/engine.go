@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeniedReason причина, по которой хост не прошел проверку
+type DeniedReason string
+
+const (
+	// ReasonBlocked хост есть в списке блокировки
+	ReasonBlocked DeniedReason = "host_blocked"
+	// ReasonNotAllowed список разрешенных хостов задан, но хоста в нем нет
+	ReasonNotAllowed DeniedReason = "host_not_allowed"
+)
+
+// DeniedError ссылка ведет на хост, запрещенный политикой
+type DeniedError struct {
+	Host   string
+	Reason DeniedReason
+}
+
+func (e *DeniedError) Error() string {
+	if e.Reason == ReasonNotAllowed {
+		return fmt.Sprintf("host '%s' is not in allowlist", e.Host)
+	}
+	return fmt.Sprintf("host '%s' is blocked", e.Host)
+}
+
+// listFile список правил и файл, из которого он прочитан
+type listFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	list    *List
+}
+
+// Engine проверяет хосты ссылок по спискам блокировки и разрешения.
+// Хост из списка блокировки запрещен всегда. Если список разрешения не пуст,
+// разрешены только хосты из него. Файлы списков перечитываются при изменении, см. Watch.
+type Engine struct {
+	mu        sync.RWMutex
+	blocklist listFile
+	allowlist listFile
+}
+
+// NewEngine создает Engine и загружает списки из файлов.
+// Пустой путь означает, что соответствующего списка нет.
+func NewEngine(blocklistPath string, allowlistPath string) (*Engine, error) {
+	e := &Engine{
+		blocklist: listFile{path: blocklistPath},
+		allowlist: listFile{path: allowlistPath},
+	}
+	if _, err := e.reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Check проверяет хост ссылки. Возвращает *DeniedError, если хост запрещен.
+// Ссылки, которые не удалось разобрать, не проверяются - это задача URLPolicy.
+func (e *Engine) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		host = strings.ToLower(u.Hostname())
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.blocklist.list.Match(host) {
+		return &DeniedError{Host: host, Reason: ReasonBlocked}
+	}
+	if e.allowlist.list.Len() > 0 && !e.allowlist.list.Match(host) {
+		return &DeniedError{Host: host, Reason: ReasonNotAllowed}
+	}
+	return nil
+}
+
+// Watch раз в interval проверяет файлы списков и перечитывает изменившиеся.
+// Если файл не удалось прочитать, продолжает действовать предыдущая версия списка.
+// Блокирует до отмены ctx.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := e.reload()
+			if err != nil {
+				log.Warn().Err(err).Msg("can't reload destination policy")
+				continue
+			}
+			if reloaded {
+				e.mu.RLock()
+				blocked, allowed := e.blocklist.list.Len(), e.allowlist.list.Len()
+				e.mu.RUnlock()
+				log.Info().Int("blocklist", blocked).Int("allowlist", allowed).Msg("destination policy reloaded")
+			}
+		}
+	}
+}
+
+// reload перечитывает файлы, которые изменились с прошлой загрузки.
+// Возвращает true, если хотя бы один список обновился
+func (e *Engine) reload() (bool, error) {
+	e.mu.RLock()
+	blocklist, allowlist := e.blocklist, e.allowlist
+	e.mu.RUnlock()
+
+	blocklistChanged, err := blocklist.load()
+	if err != nil {
+		return false, err
+	}
+	allowlistChanged, err := allowlist.load()
+	if err != nil {
+		return false, err
+	}
+	if !blocklistChanged && !allowlistChanged {
+		return false, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.blocklist, e.allowlist = blocklist, allowlist
+	return true, nil
+}
+
+// load читает файл списка, если он изменился. Возвращает true, если список обновился
+func (f *listFile) load() (bool, error) {
+	if f.path == "" {
+		return false, nil
+	}
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
+	}
+	if f.list != nil && stat.ModTime().Equal(f.modTime) && stat.Size() == f.size {
+		return false, nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	list, err := ParseList(file)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", f.path, err)
+	}
+	f.list, f.modTime, f.size = list, stat.ModTime(), stat.Size()
+	return true, nil
+}
@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Check(t *testing.T) {
+	dir := t.TempDir()
+	blocklist := filepath.Join(dir, "blocklist.txt")
+	allowlist := filepath.Join(dir, "allowlist.txt")
+	require.NoError(t, os.WriteFile(blocklist, []byte("phish.example.com\n"), 0600))
+	require.NoError(t, os.WriteFile(allowlist, []byte(".example.com\n"), 0600))
+
+	engine, err := NewEngine(blocklist, allowlist)
+	require.NoError(t, err)
+
+	assert.NoError(t, engine.Check("https://www.Example.com/path"))
+	assertDenied(t, engine.Check("https://PHISH.example.com./login"), ReasonBlocked)
+	assertDenied(t, engine.Check("https://ya.ru/"), ReasonNotAllowed)
+	// ссылки без хоста проверяет URLPolicy
+	assert.NoError(t, engine.Check("ya.ru"))
+}
+
+func TestEngine_CheckWithoutLists(t *testing.T) {
+	engine, err := NewEngine("", "")
+	require.NoError(t, err)
+	assert.NoError(t, engine.Check("https://ya.ru/"))
+}
+
+func TestEngine_Watch(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(blocklist, []byte(""), 0600))
+
+	engine, err := NewEngine(blocklist, "")
+	require.NoError(t, err)
+	require.NoError(t, engine.Check("https://ya.ru/"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Watch(ctx, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(blocklist, []byte("ya.ru\n"), 0600))
+	assert.Eventually(t, func() bool {
+		return engine.Check("https://ya.ru/") != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// битый файл не сбрасывает действующий список
+	require.NoError(t, os.WriteFile(blocklist, []byte("/[a-/\n"), 0600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Error(t, engine.Check("https://ya.ru/"))
+}
+
+func TestNewEngine_MissingFile(t *testing.T) {
+	_, err := NewEngine(filepath.Join(t.TempDir(), "nope.txt"), "")
+	assert.Error(t, err)
+}
+
+func assertDenied(t *testing.T, err error, reason DeniedReason) {
+	t.Helper()
+	var deniedErr *DeniedError
+	require.True(t, errors.As(err, &deniedErr), "expected DeniedError, got %v", err)
+	assert.Equal(t, reason, deniedErr.Reason)
+}
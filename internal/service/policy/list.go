@@ -0,0 +1,128 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// rule правило сопоставления хоста
+type rule interface {
+	match(host string) bool
+}
+
+// exactRule совпадение хоста целиком: example.com
+type exactRule string
+
+func (r exactRule) match(host string) bool {
+	return string(r) == host
+}
+
+// suffixRule домен и все его поддомены: .example.com
+type suffixRule string
+
+func (r suffixRule) match(host string) bool {
+	return host == string(r) || strings.HasSuffix(host, "."+string(r))
+}
+
+// regexRule регулярное выражение по хосту: /^ya\.(ru|com)$/
+type regexRule struct {
+	*regexp.Regexp
+}
+
+func (r regexRule) match(host string) bool {
+	return r.MatchString(host)
+}
+
+// List список правил для хостов.
+// Файл списка содержит по одному правилу в строке:
+//
+//	example.com      - только хост example.com
+//	.example.com     - example.com и все его поддомены
+//	/^bad[0-9]+\./   - регулярное выражение по хосту
+//
+// Пустые строки и строки, начинающиеся с #, пропускаются.
+type List struct {
+	rules []rule
+}
+
+// ParseList читает список правил
+func ParseList(r io.Reader) (*List, error) {
+	list := &List{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		list.rules = append(list.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func parseRule(line string) (rule, error) {
+	if len(line) > 2 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") {
+		re, err := regexp.Compile(line[1 : len(line)-1])
+		if err != nil {
+			return nil, err
+		}
+		return regexRule{re}, nil
+	}
+	if strings.HasPrefix(line, ".") {
+		host, err := normalizeHost(strings.TrimPrefix(line, "."))
+		if err != nil {
+			return nil, err
+		}
+		return suffixRule(host), nil
+	}
+	host, err := normalizeHost(line)
+	if err != nil {
+		return nil, err
+	}
+	return exactRule(host), nil
+}
+
+// Len количество правил в списке
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.rules)
+}
+
+// Match возвращает true, если хост подпадает под одно из правил списка
+func (l *List) Match(host string) bool {
+	if l == nil {
+		return false
+	}
+	for _, r := range l.rules {
+		if r.match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost приводит хост к виду, в котором он сравнивается с правилами:
+// нижний регистр, punycode, без завершающей точки
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	asciiHost, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid host '%s': %w", host, err)
+	}
+	return strings.ToLower(asciiHost), nil
+}
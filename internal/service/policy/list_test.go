@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseList(t *testing.T) {
+	list, err := ParseList(strings.NewReader(`
+# фишинг
+evil.com
+.bad.org
+/^promo[0-9]+\./
+Пример.РФ
+`))
+	require.NoError(t, err)
+	assert.Equal(t, 4, list.Len())
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "evil.com", want: true},
+		{host: "www.evil.com", want: false},
+		{host: "bad.org", want: true},
+		{host: "www.bad.org", want: true},
+		{host: "notbad.org", want: false},
+		{host: "promo42.example.net", want: true},
+		{host: "promo.example.net", want: false},
+		{host: "xn--e1afmkfd.xn--p1ai", want: true},
+		{host: "ya.ru", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			assert.Equal(t, tt.want, list.Match(tt.host))
+		})
+	}
+}
+
+func TestParseList_InvalidRegexp(t *testing.T) {
+	_, err := ParseList(strings.NewReader("ya.ru\n/[a-/\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestList_Nil(t *testing.T) {
+	var list *List
+	assert.Equal(t, 0, list.Len())
+	assert.False(t, list.Match("ya.ru"))
+}
@@ -0,0 +1,108 @@
+// Package quota ограничения на количество ссылок пользователя.
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+var (
+	// ErrBatchTooLarge в пакетном запросе больше ссылок, чем разрешено пользователю
+	ErrBatchTooLarge = errors.New("batch is too large")
+	// ErrLinksExceeded у пользователя будет больше активных ссылок, чем разрешено.
+	// Эту же ошибку возвращают репозитории, проверяющие квоту при сохранении
+	ErrLinksExceeded = repository.ErrQuotaExceeded
+)
+
+// Limits ограничения пользователя. 0 означает отсутствие ограничения
+type Limits struct {
+	// MaxLinks максимальное количество активных (не удаленных) ссылок
+	MaxLinks int `json:"max_links"`
+	// MaxBatchSize максимальное количество ссылок в одном пакетном запросе
+	MaxBatchSize int `json:"max_batch_size"`
+}
+
+// override персональные ограничения пользователя. Незаданные поля берутся из ограничений по умолчанию
+type override struct {
+	MaxLinks     *int `json:"max_links"`
+	MaxBatchSize *int `json:"max_batch_size"`
+}
+
+// Quotas ограничения по умолчанию и персональные ограничения пользователей
+type Quotas struct {
+	defaults  Limits
+	overrides map[string]Limits
+}
+
+// New создает Quotas. overrides - персональные ограничения по uid пользователя
+func New(defaults Limits, overrides map[string]Limits) *Quotas {
+	if overrides == nil {
+		overrides = make(map[string]Limits)
+	}
+	return &Quotas{
+		defaults:  defaults,
+		overrides: overrides,
+	}
+}
+
+// Load создает Quotas, читая персональные ограничения из JSON-файла вида
+//
+//	{"<uid>": {"max_links": 1000, "max_batch_size": 100}}
+//
+// Незаданные для пользователя ограничения берутся из defaults. Пустой путь - без персональных ограничений.
+func Load(defaults Limits, path string) (*Quotas, error) {
+	if path == "" {
+		return New(defaults, nil), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]override
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	overrides := make(map[string]Limits, len(raw))
+	for uid, o := range raw {
+		limits := defaults
+		if o.MaxLinks != nil {
+			limits.MaxLinks = *o.MaxLinks
+		}
+		if o.MaxBatchSize != nil {
+			limits.MaxBatchSize = *o.MaxBatchSize
+		}
+		overrides[uid] = limits
+	}
+	return New(defaults, overrides), nil
+}
+
+// For возвращает ограничения пользователя
+func (q *Quotas) For(uid string) Limits {
+	if limits, ok := q.overrides[uid]; ok {
+		return limits
+	}
+	return q.defaults
+}
+
+// MaxLinks максимальное количество активных ссылок пользователя. 0 - без ограничений
+func (q *Quotas) MaxLinks(uid string) int {
+	return q.For(uid).MaxLinks
+}
+
+// CheckBatch проверяет, что пользователь может сократить пачку из n ссылок,
+// имея used активных ссылок
+func (q *Quotas) CheckBatch(uid string, used int, n int) error {
+	limits := q.For(uid)
+	if limits.MaxBatchSize > 0 && n > limits.MaxBatchSize {
+		return fmt.Errorf("%w: %d > %d", ErrBatchTooLarge, n, limits.MaxBatchSize)
+	}
+	if limits.MaxLinks > 0 && used+n > limits.MaxLinks {
+		return ErrLinksExceeded
+	}
+	return nil
+}
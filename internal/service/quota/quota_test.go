@@ -0,0 +1,45 @@
+package quota
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"vip": {"max_links": 0, "max_batch_size": 5000},
+		"small": {"max_links": 3}
+	}`), 0600))
+
+	quotas, err := Load(Limits{MaxLinks: 100, MaxBatchSize: 10}, path)
+	require.NoError(t, err)
+
+	assert.Equal(t, Limits{MaxLinks: 100, MaxBatchSize: 10}, quotas.For("anyone"))
+	assert.Equal(t, Limits{MaxLinks: 0, MaxBatchSize: 5000}, quotas.For("vip"))
+	assert.Equal(t, Limits{MaxLinks: 3, MaxBatchSize: 10}, quotas.For("small"))
+	assert.Equal(t, 3, quotas.MaxLinks("small"))
+}
+
+func TestLoad_Errors(t *testing.T) {
+	_, err := Load(Limits{}, filepath.Join(t.TempDir(), "nope.json"))
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[]`), 0600))
+	_, err = Load(Limits{}, path)
+	assert.Error(t, err)
+}
+
+func TestQuotas_CheckBatch(t *testing.T) {
+	quotas := New(Limits{MaxLinks: 10, MaxBatchSize: 5}, map[string]Limits{"unlimited": {}})
+
+	assert.NoError(t, quotas.CheckBatch("u", 5, 5))
+	assert.ErrorIs(t, quotas.CheckBatch("u", 0, 6), ErrBatchTooLarge)
+	assert.ErrorIs(t, quotas.CheckBatch("u", 6, 5), ErrLinksExceeded)
+	assert.NoError(t, quotas.CheckBatch("unlimited", 1000, 1000))
+}
@@ -0,0 +1,120 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/random"
+)
+
+const (
+	// apiKeyPrefix начало всех API ключей, по нему ключ легко узнать в конфигурации и логах
+	apiKeyPrefix = "shk_"
+	// apiKeySize сколько случайных байт в API ключе
+	apiKeySize = 32
+	// apiKeyVisiblePrefix сколько первых символов ключа показывается в списке ключей
+	apiKeyVisiblePrefix = 12
+	// maxAPIKeyNameLength максимальная длина названия API ключа в символах
+	maxAPIKeyNameLength = 100
+)
+
+var (
+	// ErrInvalidAPIKeySettings API ключ задан неверно: слишком длинное название, нет областей действия
+	// или неизвестная область
+	ErrInvalidAPIKeySettings = errors.New("invalid api key settings")
+	// ErrInvalidAPIKey API ключа нет или он отозван
+	ErrInvalidAPIKey = errors.New("invalid api key")
+)
+
+// CreateAPIKey создает API ключ пользователя uid с названием name и областями действия scopes.
+// Ключ возвращается один раз, хранится только его хеш
+func (s *Service) CreateAPIKey(ctx context.Context, uid string, name string, scopes []entity.Scope) (string, entity.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		return "", entity.APIKey{}, fmt.Errorf("%w: name must be at most %d characters", ErrInvalidAPIKeySettings, maxAPIKeyNameLength)
+	}
+	if len(scopes) == 0 {
+		return "", entity.APIKey{}, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeySettings)
+	}
+	unique := make([]entity.Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		if !scope.IsValid() {
+			return "", entity.APIKey{}, fmt.Errorf("%w: unknown scope '%s'", ErrInvalidAPIKeySettings, scope)
+		}
+		if !(entity.APIKey{Scopes: unique}).HasScope(scope) {
+			unique = append(unique, scope)
+		}
+	}
+
+	secret, err := random.Token(apiKeySize)
+	if err != nil {
+		return "", entity.APIKey{}, err
+	}
+	token := apiKeyPrefix + secret
+	key := entity.APIKey{
+		UID:       uid,
+		Name:      name,
+		Prefix:    token[:apiKeyVisiblePrefix],
+		KeyHash:   hashToken(token),
+		Scopes:    unique,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	err = repository.PutWithFreeID(s.recordIDGenerator, func(id string) error {
+		key.ID = id
+		return s.linksRepository.PutAPIKey(ctx, key)
+	})
+	if err != nil {
+		return "", entity.APIKey{}, err
+	}
+	return token, key, nil
+}
+
+// UserAPIKeys возвращает API ключи пользователя uid, в том числе отозванные, от старых к новым
+func (s *Service) UserAPIKeys(ctx context.Context, uid string) ([]entity.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return s.linksRepository.FindAPIKeysByUID(ctx, uid)
+}
+
+// RevokeAPIKey отзывает API ключ keyID пользователя uid. После отзыва ключ перестает приниматься.
+// Возвращает repository.ErrAPIKeyNotFound, если у пользователя нет такого ключа
+func (s *Service) RevokeAPIKey(ctx context.Context, uid string, keyID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return s.linksRepository.RevokeAPIKey(ctx, uid, keyID, time.Now())
+}
+
+// AuthenticateAPIKey возвращает действующий API ключ по его значению из запроса.
+// Если ключа нет или он отозван, возвращает ErrInvalidAPIKey
+func (s *Service) AuthenticateAPIKey(ctx context.Context, token string) (entity.APIKey, error) {
+	if !strings.HasPrefix(token, apiKeyPrefix) {
+		return entity.APIKey{}, ErrInvalidAPIKey
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	key, err := s.linksRepository.GetAPIKeyByHash(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return entity.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return entity.APIKey{}, err
+	}
+	if key.IsRevoked() {
+		return entity.APIKey{}, fmt.Errorf("%w: key '%s' is revoked", ErrInvalidAPIKey, key.ID)
+	}
+	return *key, nil
+}
@@ -0,0 +1,68 @@
+package shortener
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+func TestService_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, nil)))
+
+	for _, scopes := range [][]entity.Scope{nil, {"admin"}} {
+		_, _, err := s.CreateAPIKey(ctx, "user1", "ci", scopes)
+		assert.ErrorIs(t, err, ErrInvalidAPIKeySettings)
+	}
+	_, _, err := s.CreateAPIKey(ctx, "user1", strings.Repeat("a", maxAPIKeyNameLength+1), []entity.Scope{entity.ScopeRead})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeySettings)
+
+	token, key, err := s.CreateAPIKey(ctx, "user1", " ci ", []entity.Scope{entity.ScopeShorten, entity.ScopeRead, entity.ScopeShorten})
+	require.NoError(t, err)
+	assert.Equal(t, "ci", key.Name)
+	assert.Equal(t, []entity.Scope{entity.ScopeShorten, entity.ScopeRead}, key.Scopes)
+	assert.True(t, strings.HasPrefix(token, key.Prefix))
+	assert.NotContains(t, key.KeyHash, token, "only the key hash is stored")
+
+	authenticated, err := s.AuthenticateAPIKey(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", authenticated.UID)
+	for _, wrong := range []string{"", "token", apiKeyPrefix + "unknown"} {
+		_, err = s.AuthenticateAPIKey(ctx, wrong)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	}
+
+	assert.ErrorIs(t, s.RevokeAPIKey(ctx, "user2", key.ID), repository.ErrAPIKeyNotFound, "only the owner revokes a key")
+	require.NoError(t, s.RevokeAPIKey(ctx, "user1", key.ID))
+	_, err = s.AuthenticateAPIKey(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	keys, err := s.UserAPIKeys(ctx, "user1")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.True(t, keys[0].IsRevoked())
+}
+
+func TestService_CreateAPIKeyIDCollision(t *testing.T) {
+	ctx := context.Background()
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, nil)))
+	s.recordIDGenerator = &fixedIDs{ids: []string{"taken", "taken", "free"}}
+
+	_, first, err := s.CreateAPIKey(ctx, "user1", "first", []entity.Scope{entity.ScopeRead})
+	require.NoError(t, err)
+	_, second, err := s.CreateAPIKey(ctx, "user2", "second", []entity.Scope{entity.ScopeRead})
+	require.NoError(t, err)
+	assert.Equal(t, "free", second.ID)
+
+	// ключ первого пользователя по-прежнему отзывается только им
+	assert.ErrorIs(t, s.RevokeAPIKey(ctx, "user2", first.ID), repository.ErrAPIKeyNotFound)
+	keys, err := s.UserAPIKeys(ctx, "user1")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Nil(t, keys[0].RevokedAt)
+}
@@ -0,0 +1,138 @@
+package shortener
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts порты, которые не пишутся в канонической ссылке для соответствующей схемы
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// trackingParams параметры отслеживания, которые не влияют на содержимое страницы
+var trackingParams = map[string]struct{}{
+	"fbclid":    {},
+	"gclid":     {},
+	"yclid":     {},
+	"dclid":     {},
+	"msclkid":   {},
+	"mc_cid":    {},
+	"mc_eid":    {},
+	"_openstat": {},
+}
+
+// trackingParamPrefixes префиксы параметров отслеживания
+var trackingParamPrefixes = []string{"utm_"}
+
+var ErrEmptyURL = errors.New("empty url")
+
+// Canonicalizer приводит ссылки к каноническому виду, чтобы одинаковые по смыслу адреса
+// (`HTTP://Ya.ru/`, `http://ya.ru`, `http://ya.ru/?`) считались дубликатами.
+type Canonicalizer struct {
+	// stripTrackingParams удалять из ссылки параметры отслеживания (utm_*, fbclid и т.п.)
+	stripTrackingParams bool
+}
+
+func NewCanonicalizer(stripTrackingParams bool) *Canonicalizer {
+	return &Canonicalizer{
+		stripTrackingParams: stripTrackingParams,
+	}
+}
+
+// Canonicalize возвращает каноническую форму ссылки:
+//   - схема и хост в нижнем регистре, интернациональные домены в punycode;
+//   - без порта по умолчанию для схемы;
+//   - пустой путь заменяется на /;
+//   - параметры запроса отсортированы, пустой запрос (`?`) удаляется;
+//   - опционально удаляются параметры отслеживания.
+//
+// Ссылка без схемы считается http-ссылкой.
+func (c *Canonicalizer) Canonicalize(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", ErrEmptyURL
+	}
+	if !strings.Contains(rawURL, "://") && !strings.HasPrefix(rawURL, "//") {
+		rawURL = "http://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, err := c.canonicalHost(u.Scheme, u.Host)
+	if err != nil {
+		return "", err
+	}
+	u.Host = host
+
+	if u.Path == "" && u.Opaque == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+
+	u.ForceQuery = false
+	u.RawQuery = c.canonicalQuery(u.Query())
+
+	return u.String(), nil
+}
+
+// canonicalHost переводит хост в нижний регистр и punycode, убирает порт по умолчанию
+func (c *Canonicalizer) canonicalHost(scheme string, hostport string) (string, error) {
+	host, port := hostport, ""
+	if h, p, err := net.SplitHostPort(hostport); err == nil {
+		host, port = h, p
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	if net.ParseIP(host) == nil && host != "" {
+		asciiHost, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", err
+		}
+		host = asciiHost
+	}
+	host = strings.ToLower(host)
+
+	if port == "" || defaultPorts[scheme] == port {
+		if strings.Contains(host, ":") {
+			// IPv6
+			return "[" + host + "]", nil
+		}
+		return host, nil
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// canonicalQuery сортирует параметры запроса и удаляет параметры отслеживания
+func (c *Canonicalizer) canonicalQuery(query url.Values) string {
+	if c.stripTrackingParams {
+		for key := range query {
+			if isTrackingParam(key) {
+				query.Del(key)
+			}
+		}
+	}
+	return query.Encode()
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if _, ok := trackingParams[key]; ok {
+		return true
+	}
+	for _, prefix := range trackingParamPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
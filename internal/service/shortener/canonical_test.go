@@ -0,0 +1,61 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+func TestCanonicalizer_Canonicalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		stripTracking bool
+		want          string
+	}{
+		{name: "scheme and host case", url: "HTTP://Ya.RU/Path", want: "http://ya.ru/Path"},
+		{name: "empty path", url: "http://ya.ru", want: "http://ya.ru/"},
+		{name: "empty query", url: "http://ya.ru/?", want: "http://ya.ru/"},
+		{name: "default http port", url: "http://ya.ru:80/", want: "http://ya.ru/"},
+		{name: "default https port", url: "https://ya.ru:443/a", want: "https://ya.ru/a"},
+		{name: "custom port", url: "https://ya.ru:8443/a", want: "https://ya.ru:8443/a"},
+		{name: "without scheme", url: "ya.ru", want: "http://ya.ru/"},
+		{name: "idn", url: "http://Пример.РФ/", want: "http://xn--e1afmkfd.xn--p1ai/"},
+		{name: "ipv6", url: "http://[::1]:80/", want: "http://[::1]/"},
+		{name: "query sorted", url: "http://ya.ru/?b=2&a=1", want: "http://ya.ru/?a=1&b=2"},
+		{name: "tracking params kept", url: "http://ya.ru/?utm_source=mail&a=1", want: "http://ya.ru/?a=1&utm_source=mail"},
+		{name: "tracking params stripped", url: "http://ya.ru/?utm_source=mail&a=1&fbclid=x", stripTracking: true, want: "http://ya.ru/?a=1"},
+		{name: "fragment kept", url: "http://ya.ru/#top", want: "http://ya.ru/#top"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewCanonicalizer(tt.stripTracking).Canonicalize(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCanonicalizer_CanonicalizeEmpty(t *testing.T) {
+	_, err := NewCanonicalizer(false).Canonicalize(" ")
+	assert.ErrorIs(t, err, ErrEmptyURL)
+}
+
+func TestService_ShortenURLLegacyDuplicate(t *testing.T) {
+	// ссылка сохранена до появления канонизации, в ней только исходный адрес
+	db := map[string]entity.LinkEntity{
+		"legacy": {ID: "legacy", OriginalURL: "HTTP://Ya.ru/", UID: "100"},
+	}
+	canonicalizer := NewCanonicalizer(false)
+	repo := repository.NewInMemoryLinksRepository(context.TODO(), db, repository.WithCanonicalizer(canonicalizer))
+	linksService := NewService("http://localhost:8080", WithRepository(repo), WithCanonicalizer(canonicalizer))
+
+	_, err := linksService.ShortenURL(context.TODO(), linksService.NewLinkEntity("http://ya.ru", "200"))
+	var linkExistsErr *repository.LinkExistsError
+	require.ErrorAs(t, err, &linkExistsErr)
+	assert.Equal(t, "legacy", linkExistsErr.LinkID)
+}
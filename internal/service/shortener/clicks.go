@@ -0,0 +1,35 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+// ErrInvalidMaxClicks ограничение количества переходов не может быть отрицательным
+var ErrInvalidMaxClicks = errors.New("max_clicks must not be negative")
+
+// LimitClicks ограничивает количество переходов по ссылке. 0 оставляет ссылку без ограничений
+func (s *Service) LimitClicks(linkEntity *entity.LinkEntity, maxClicks int) error {
+	if maxClicks < 0 {
+		return ErrInvalidMaxClicks
+	}
+	linkEntity.MaxClicks = maxClicks
+	return nil
+}
+
+// ConsumeClick засчитывает переход по ссылке. Для ссылок с ограничением количества переходов
+// проверяет лимит: если переходы закончились, возвращает repository.ErrClicksExhausted
+func (s *Service) ConsumeClick(ctx context.Context, linkEntity entity.LinkEntity) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	err := s.linksRepository.ConsumeClick(ctx, linkEntity.ID)
+	if linkEntity.IsClickLimited() {
+		// в кеше остался бы устаревший счетчик переходов, по которому проверяется лимит
+		s.linkCache.invalidate(linkEntity.ID)
+	}
+	return err
+}
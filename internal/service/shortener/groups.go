@@ -0,0 +1,135 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+// maxGroupNameLength максимальная длина названия группы ссылок в символах
+const maxGroupNameLength = 100
+
+var (
+	// ErrInvalidGroup группа ссылок задана неверно: пустое или слишком длинное название,
+	// или ссылку добавляют в несуществующую или чужую группу
+	ErrInvalidGroup = errors.New("invalid group")
+	// ErrNotGroupOwner с группой ссылок пытается работать не ее владелец
+	ErrNotGroupOwner = errors.New("group is owned by another user")
+)
+
+// CreateGroup создает группу ссылок пользователя uid. Пробелы по краям названия отбрасываются
+func (s *Service) CreateGroup(ctx context.Context, uid string, name string) (entity.Group, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxGroupNameLength {
+		return entity.Group{}, fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidGroup, maxGroupNameLength)
+	}
+	group := entity.Group{
+		UID:       uid,
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	err := repository.PutWithFreeID(s.recordIDGenerator, func(id string) error {
+		group.ID = id
+		return s.linksRepository.PutGroup(ctx, group)
+	})
+	if err != nil {
+		return entity.Group{}, err
+	}
+	return group, nil
+}
+
+// UserGroups возвращает группы ссылок пользователя uid от старых к новым
+func (s *Service) UserGroups(ctx context.Context, uid string) ([]entity.Group, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return s.linksRepository.FindGroupsByUID(ctx, uid)
+}
+
+// UserGroup возвращает группу groupID пользователя uid со статистикой по ее ссылкам.
+// Возвращает repository.ErrGroupNotFound, если группы нет, и ErrNotGroupOwner, если группа чужая
+func (s *Service) UserGroup(ctx context.Context, uid string, groupID string) (entity.Group, entity.GroupStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	group, err := s.ownedGroup(ctx, uid, groupID)
+	if err != nil {
+		return entity.Group{}, entity.GroupStats{}, err
+	}
+	stats, err := s.linksRepository.GroupStats(ctx, uid, groupID, time.Now())
+	if err != nil {
+		return entity.Group{}, entity.GroupStats{}, err
+	}
+	return group, stats, nil
+}
+
+// RemoveGroupLinks запускает удаление всех ссылок группы groupID пользователя uid так же, как RemoveLinks.
+// Возвращает количество ссылок, поставленных на удаление
+func (s *Service) RemoveGroupLinks(ctx context.Context, uid string, groupID string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if _, err := s.ownedGroup(ctx, uid, groupID); err != nil {
+		return 0, err
+	}
+	page, err := s.linksRepository.FindLinksByUID(ctx, uid, repository.LinkListOptions{GroupID: groupID})
+	if err != nil {
+		return 0, err
+	}
+	if len(page.Links) == 0 {
+		return 0, nil
+	}
+	linkIDs := make([]string, 0, len(page.Links))
+	for _, e := range page.Links {
+		linkIDs = append(linkIDs, e.ID)
+	}
+	s.RemoveLinks(linkIDs, uid)
+	return len(linkIDs), nil
+}
+
+// SetGroup добавляет ссылку в группу ее владельца. Пустой groupID убирает ссылку из группы.
+// Если группы нет, она принадлежит другому пользователю или ссылка общая (группы личные),
+// возвращает ErrInvalidGroup
+func (s *Service) SetGroup(ctx context.Context, linkEntity *entity.LinkEntity, groupID string) error {
+	if groupID == "" {
+		linkEntity.GroupID = ""
+		return nil
+	}
+	if !linkEntity.IsPersonal() {
+		return fmt.Errorf("%w: workspace links can't be grouped", ErrInvalidGroup)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if _, err := s.ownedGroup(ctx, linkEntity.UID, groupID); err != nil {
+		if errors.Is(err, repository.ErrGroupNotFound) || errors.Is(err, ErrNotGroupOwner) {
+			return fmt.Errorf("%w: %s", ErrInvalidGroup, err.Error())
+		}
+		return err
+	}
+	linkEntity.GroupID = groupID
+	return nil
+}
+
+// ownedGroup возвращает группу groupID, если она принадлежит пользователю uid
+func (s *Service) ownedGroup(ctx context.Context, uid string, groupID string) (entity.Group, error) {
+	group, err := s.linksRepository.GetGroup(ctx, groupID)
+	if err != nil {
+		return entity.Group{}, err
+	}
+	if group.UID != uid {
+		return entity.Group{}, ErrNotGroupOwner
+	}
+	return *group, nil
+}
@@ -0,0 +1,91 @@
+package shortener
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+func TestService_Groups(t *testing.T) {
+	ctx := context.Background()
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, nil)))
+
+	for _, name := range []string{" ", strings.Repeat("a", maxGroupNameLength+1)} {
+		_, err := s.CreateGroup(ctx, "user1", name)
+		assert.ErrorIs(t, err, ErrInvalidGroup)
+	}
+	group, err := s.CreateGroup(ctx, "user1", " Spring sale ")
+	require.NoError(t, err)
+	assert.Equal(t, "Spring sale", group.Name)
+	foreign, err := s.CreateGroup(ctx, "user2", "Other")
+	require.NoError(t, err)
+
+	groups, err := s.UserGroups(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, []entity.Group{group}, groups)
+
+	past := time.Now().Add(-time.Hour)
+	for i, settings := range []func(e *entity.LinkEntity){
+		func(e *entity.LinkEntity) { e.Clicks = 3 },
+		func(e *entity.LinkEntity) { e.NotAfter = &past; e.Clicks = 1 },
+		func(e *entity.LinkEntity) {},
+	} {
+		e := s.NewLinkEntity("https://ya.ru/"+strings.Repeat("a", i+1), "user1")
+		require.NoError(t, s.SetGroup(ctx, &e, group.ID))
+		settings(&e)
+		_, err = s.ShortenURL(ctx, e)
+		require.NoError(t, err)
+	}
+	outside := s.NewLinkEntity("https://ya.ru/outside", "user1")
+	_, err = s.ShortenURL(ctx, outside)
+	require.NoError(t, err)
+
+	e := s.NewLinkEntity("https://ya.ru/x", "user1")
+	assert.ErrorIs(t, s.SetGroup(ctx, &e, foreign.ID), ErrInvalidGroup)
+	assert.ErrorIs(t, s.SetGroup(ctx, &e, "missing"), ErrInvalidGroup)
+
+	_, stats, err := s.UserGroup(ctx, "user1", group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, entity.GroupStats{Links: 3, Active: 2, Expired: 1, Clicks: 4}, stats)
+	_, _, err = s.UserGroup(ctx, "user1", foreign.ID)
+	assert.ErrorIs(t, err, ErrNotGroupOwner)
+
+	links, _, err := s.GetUserLinks(ctx, "user1", ListOptions{GroupID: group.ID})
+	require.NoError(t, err)
+	assert.Len(t, links, 3)
+
+	removed, err := s.RemoveGroupLinks(ctx, "user1", group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	require.Eventually(t, func() bool {
+		_, stats, err = s.UserGroup(ctx, "user1", group.ID)
+		return err == nil && stats.Removed == 3
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, entity.GroupStats{Removed: 3, Clicks: 4}, stats)
+
+	count, err := s.linksRepository.CountLinksByUID(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "links outside the group are kept")
+}
+
+func TestService_CreateGroupIDCollision(t *testing.T) {
+	ctx := context.Background()
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, nil)))
+	s.recordIDGenerator = &fixedIDs{ids: []string{"taken", "taken", "free"}}
+
+	first, err := s.CreateGroup(ctx, "user1", "First")
+	require.NoError(t, err)
+	second, err := s.CreateGroup(ctx, "user2", "Second")
+	require.NoError(t, err)
+	assert.Equal(t, "free", second.ID)
+
+	stored, err := s.linksRepository.GetGroup(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", stored.UID, "a taken id doesn't move the group to another user")
+}
@@ -0,0 +1,99 @@
+package shortener
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+// linkCacheItem ссылка в кеше и момент, после которого ее надо перечитать из хранилища
+type linkCacheItem struct {
+	linkEntity entity.LinkEntity
+	expiresAt  time.Time
+}
+
+// linkCache кеш ссылок для переходов по коротким ссылкам.
+// Изменения ссылок в этом экземпляре сервиса сбрасывают кеш сразу,
+// изменения из других экземпляров станут видны не позже, чем через ttl.
+// nil кеш ничего не хранит
+type linkCache struct {
+	mu    sync.Mutex
+	items map[string]linkCacheItem
+	ttl   time.Duration
+	size  int
+	now   func() time.Time
+}
+
+// newLinkCache создает кеш на size ссылок с временем жизни ttl. Если ttl или size не заданы, кеш выключен
+func newLinkCache(ttl time.Duration, size int) *linkCache {
+	if ttl <= 0 || size <= 0 {
+		return nil
+	}
+	return &linkCache{
+		items: make(map[string]linkCacheItem, size),
+		ttl:   ttl,
+		size:  size,
+		now:   time.Now,
+	}
+}
+
+// get возвращает ссылку из кеша, если она там есть и не устарела
+func (c *linkCache) get(linkID string) (entity.LinkEntity, bool) {
+	if c == nil {
+		return entity.LinkEntity{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item, ok := c.items[linkID]
+	if !ok {
+		return entity.LinkEntity{}, false
+	}
+	if c.now().After(item.expiresAt) {
+		delete(c.items, linkID)
+		return entity.LinkEntity{}, false
+	}
+	return item.linkEntity, true
+}
+
+// put кладет ссылку в кеш. Если кеш заполнен, сначала удаляются устаревшие записи, а если их нет - произвольная
+func (c *linkCache) put(linkEntity entity.LinkEntity) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, ok := c.items[linkEntity.ID]; !ok && len(c.items) >= c.size {
+		for id, item := range c.items {
+			if now.After(item.expiresAt) {
+				delete(c.items, id)
+			}
+		}
+		for id := range c.items {
+			if len(c.items) < c.size {
+				break
+			}
+			delete(c.items, id)
+		}
+	}
+	c.items[linkEntity.ID] = linkCacheItem{
+		linkEntity: linkEntity,
+		expiresAt:  now.Add(c.ttl),
+	}
+}
+
+// invalidate удаляет ссылки из кеша
+func (c *linkCache) invalidate(linkIDs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range linkIDs {
+		delete(c.items, id)
+	}
+}
@@ -0,0 +1,135 @@
+package shortener
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+const (
+	// defaultPageSize сколько ссылок возвращается на странице, если размер не задан
+	defaultPageSize = 100
+	// maxPageSize максимальный размер страницы списка ссылок
+	maxPageSize = 1000
+)
+
+// ErrInvalidListOptions параметры списка ссылок заданы неверно
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// ListOptions параметры страницы списка ссылок пользователя
+type ListOptions struct {
+	// Sort порядок ссылок: repository.SortByCreated (по умолчанию) или repository.SortByClicks
+	Sort repository.LinkSort
+	// Status какие ссылки попадают в список. По умолчанию - все не удаленные
+	Status repository.LinkStatus
+	// GroupID только ссылки этой группы
+	GroupID string
+	// WorkspaceID ссылки этого рабочего пространства вместо личных ссылок пользователя
+	WorkspaceID string
+	// Cursor курсор следующей страницы из ответа на предыдущий запрос. Пустой - первая страница
+	Cursor string
+	// Limit размер страницы, не больше maxPageSize. 0 - defaultPageSize
+	Limit int
+}
+
+// listCursor курсор страницы в том виде, в каком он передается клиенту
+type listCursor struct {
+	Sort      repository.LinkSort `json:"s"`
+	CreatedAt time.Time           `json:"t,omitempty"`
+	Clicks    int                 `json:"c,omitempty"`
+	ID        string              `json:"i"`
+}
+
+// GetUserLinks возвращает страницу личных ссылок пользователя uid или, если задан opts.WorkspaceID,
+// ссылок пространства, и курсор следующей страницы. Пустой курсор означает, что страница последняя.
+// Ссылки пространства видны любому его участнику, остальным возвращается ErrInsufficientRole
+func (s *Service) GetUserLinks(ctx context.Context, uid string, opts ListOptions) ([]entity.LinkEntity, string, error) {
+	listOpts, err := newLinkListOptions(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if listOpts.WorkspaceID != "" {
+		if _, err = s.workspaceRole(ctx, uid, listOpts.WorkspaceID, entity.Role.CanView); err != nil {
+			return nil, "", err
+		}
+	}
+
+	page, err := s.linksRepository.FindLinksByUID(ctx, uid, listOpts)
+	if err != nil {
+		return nil, "", err
+	}
+	if page.Next == nil {
+		return page.Links, "", nil
+	}
+	return page.Links, encodeCursor(listOpts.Sort, *page.Next), nil
+}
+
+// newLinkListOptions проверяет параметры списка и переводит их в параметры хранилища
+func newLinkListOptions(opts ListOptions) (repository.LinkListOptions, error) {
+	result := repository.LinkListOptions{
+		Sort:        opts.Sort,
+		Status:      opts.Status,
+		GroupID:     opts.GroupID,
+		WorkspaceID: opts.WorkspaceID,
+		Limit:       opts.Limit,
+	}
+	switch result.Sort {
+	case "":
+		result.Sort = repository.SortByCreated
+	case repository.SortByCreated, repository.SortByClicks:
+	default:
+		return repository.LinkListOptions{}, fmt.Errorf("%w: unknown sort %q", ErrInvalidListOptions, opts.Sort)
+	}
+	switch result.Status {
+	case repository.StatusAny, repository.StatusActive, repository.StatusRemoved, repository.StatusExpired:
+	default:
+		return repository.LinkListOptions{}, fmt.Errorf("%w: unknown status %q", ErrInvalidListOptions, opts.Status)
+	}
+	if result.Limit < 0 || result.Limit > maxPageSize {
+		return repository.LinkListOptions{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListOptions, maxPageSize)
+	}
+	if result.Limit == 0 {
+		result.Limit = defaultPageSize
+	}
+	if opts.Cursor != "" {
+		after, err := decodeCursor(result.Sort, opts.Cursor)
+		if err != nil {
+			return repository.LinkListOptions{}, err
+		}
+		result.After = &after
+	}
+	return result, nil
+}
+
+// encodeCursor кодирует позицию в списке, отсортированном по sort, в непрозрачную строку
+func encodeCursor(sort repository.LinkSort, cursor repository.LinkCursor) string {
+	// в курсоре только строки, числа и время, ошибки сериализации быть не может
+	data, _ := json.Marshal(listCursor{Sort: sort, CreatedAt: cursor.CreatedAt, Clicks: cursor.Clicks, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор, выданный encodeCursor для списка с тем же порядком sort
+func decodeCursor(sort repository.LinkSort, value string) (repository.LinkCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return repository.LinkCursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	var cursor listCursor
+	if err = json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return repository.LinkCursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+	if cursor.Sort != sort {
+		return repository.LinkCursor{}, fmt.Errorf("%w: cursor was issued for sort %q", ErrInvalidListOptions, cursor.Sort)
+	}
+	return repository.LinkCursor{CreatedAt: cursor.CreatedAt, Clicks: cursor.Clicks, ID: cursor.ID}, nil
+}
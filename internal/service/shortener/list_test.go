@@ -0,0 +1,65 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+func TestService_GetUserLinks(t *testing.T) {
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-time.Hour)
+	past := base.Add(-time.Minute)
+	db := map[string]entity.LinkEntity{
+		"a": {ID: "a", UID: "user1", OriginalURL: "https://ya.ru/a", Clicks: 5, CreatedAt: base},
+		"b": {ID: "b", UID: "user1", OriginalURL: "https://ya.ru/b", Clicks: 7, CreatedAt: base.Add(time.Minute)},
+		"c": {ID: "c", UID: "user1", OriginalURL: "https://ya.ru/c", Clicks: 5, CreatedAt: base.Add(2 * time.Minute)},
+		"d": {ID: "d", UID: "user1", OriginalURL: "https://ya.ru/d", CreatedAt: base, NotAfter: &past},
+		"e": {ID: "e", UID: "user1", OriginalURL: "https://ya.ru/e", MaxClicks: 1, Clicks: 1, CreatedAt: base},
+		"f": {ID: "f", UID: "user1", OriginalURL: "https://ya.ru/f", CreatedAt: base, Removed: true},
+		"g": {ID: "g", UID: "user2", OriginalURL: "https://ya.ru/g", CreatedAt: base},
+	}
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, db)))
+
+	// pages обходит все страницы списка и возвращает идентификаторы ссылок по страницам
+	pages := func(opts ListOptions) [][]string {
+		var result [][]string
+		for {
+			links, next, err := s.GetUserLinks(ctx, "user1", opts)
+			require.NoError(t, err)
+			ids := make([]string, 0, len(links))
+			for _, e := range links {
+				ids = append(ids, e.ID)
+			}
+			result = append(result, ids)
+			if next == "" {
+				return result
+			}
+			opts.Cursor = next
+		}
+	}
+
+	assert.Equal(t, [][]string{{"c", "b"}, {"a", "d"}, {"e"}}, pages(ListOptions{Limit: 2}))
+	assert.Equal(t, [][]string{{"b", "a", "c"}, {"e", "d"}}, pages(ListOptions{Sort: repository.SortByClicks, Limit: 3}))
+	assert.Equal(t, [][]string{{"c", "b", "a"}}, pages(ListOptions{Status: repository.StatusActive}))
+	assert.Equal(t, [][]string{{"d", "e"}}, pages(ListOptions{Status: repository.StatusExpired}))
+	assert.Equal(t, [][]string{{"f"}}, pages(ListOptions{Status: repository.StatusRemoved}))
+
+	_, next, err := s.GetUserLinks(ctx, "user1", ListOptions{Limit: 1})
+	require.NoError(t, err)
+	for _, opts := range []ListOptions{
+		{Sort: "title"},
+		{Status: "deleted"},
+		{Limit: maxPageSize + 1},
+		{Cursor: "not a cursor"},
+		{Sort: repository.SortByClicks, Cursor: next},
+	} {
+		_, _, err = s.GetUserLinks(ctx, "user1", opts)
+		assert.ErrorIs(t, err, ErrInvalidListOptions, opts)
+	}
+}
@@ -1,7 +1,14 @@
 package shortener
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/ratelimit"
+	"github.com/zaz600/go-musthave-shortener/internal/service/quota"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Option func(*Service) error
@@ -13,3 +20,125 @@ func WithRepository(linksRepository repository.LinksRepository) Option {
 		return nil
 	}
 }
+
+// WithCanonicalizer задает правила приведения ссылок к каноническому виду
+func WithCanonicalizer(canonicalizer *Canonicalizer) Option {
+	return func(s *Service) error {
+		s.canonicalizer = canonicalizer
+		return nil
+	}
+}
+
+// WithURLPolicy задает правила проверки сокращаемых ссылок
+func WithURLPolicy(policy URLPolicy) Option {
+	return func(s *Service) error {
+		s.urlPolicy = policy
+		return nil
+	}
+}
+
+// WithDestinationPolicy задает списки запрещенных и разрешенных хостов.
+// disableBlockedLinks - перестать отдавать уже сохраненные ссылки, хост которых попал под запрет
+func WithDestinationPolicy(destinationPolicy DestinationPolicy, disableBlockedLinks bool) Option {
+	return func(s *Service) error {
+		s.destinationPolicy = destinationPolicy
+		s.disableBlockedLinks = disableBlockedLinks
+		return nil
+	}
+}
+
+// WithQuotas задает ограничения на количество ссылок пользователей.
+// Чтобы квота на количество ссылок соблюдалась атомарно, те же quotas
+// надо передать в репозиторий через repository.WithLinksQuota
+func WithQuotas(quotas *quota.Quotas) Option {
+	return func(s *Service) error {
+		s.quotas = quotas
+		return nil
+	}
+}
+
+// WithIDGenerator задает генератор коротких идентификаторов новых ссылок.
+// Тот же генератор надо передать в репозиторий через repository.WithIDGenerator,
+// чтобы при коллизии идентификаторы подбирались по тем же правилам
+func WithIDGenerator(generator IDGenerator) Option {
+	return func(s *Service) error {
+		if generator == nil {
+			return errors.New("id generator is nil")
+		}
+		s.idGenerator = generator
+		return nil
+	}
+}
+
+// WithPasswordAttempts задает хранилище и ограничение неудачных попыток ввода пароля одной ссылки.
+// Нулевой limit снимает ограничение
+func WithPasswordAttempts(store ratelimit.Store, limit ratelimit.Limit) Option {
+	return func(s *Service) error {
+		if store == nil {
+			return errors.New("password attempts store is nil")
+		}
+		s.passwordAttemptsStore = store
+		s.passwordAttempts = limit
+		return nil
+	}
+}
+
+// WithPasswordCost задает стоимость bcrypt хеширования паролей ссылок
+func WithPasswordCost(cost int) Option {
+	return func(s *Service) error {
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		s.passwordCost = cost
+		return nil
+	}
+}
+
+// WithLinkCache включает кеш ссылок для переходов на size ссылок с временем жизни ttl.
+// При нескольких экземплярах сервиса изменения ссылок из других экземпляров станут видны не позже, чем через ttl
+func WithLinkCache(ttl time.Duration, size int) Option {
+	return func(s *Service) error {
+		s.linkCache = newLinkCache(ttl, size)
+		return nil
+	}
+}
+
+// WithQRCache задает размер кеша изображений QR кодов. 0 - кеш выключен
+func WithQRCache(size int) Option {
+	return func(s *Service) error {
+		s.qrCache = newQRCache(size)
+		return nil
+	}
+}
+
+// WithDefaultRedirectCode задает код ответа при переходе по ссылкам, для которых он не задан: 301, 302, 307 или 308
+func WithDefaultRedirectCode(code int) Option {
+	return func(s *Service) error {
+		if !IsValidRedirectCode(code) {
+			return ErrInvalidRedirectCode
+		}
+		s.defaultRedirectCode = code
+		return nil
+	}
+}
+
+// WithQueryMerge задает правило объединения параметров для ссылок, у которых оно не задано
+func WithQueryMerge(rule QueryMergeRule) Option {
+	return func(s *Service) error {
+		parsed, err := ParseQueryMergeRule(string(rule))
+		if err != nil {
+			return err
+		}
+		s.queryMerge = parsed
+		return nil
+	}
+}
+
+// WithCountryResolver задает определение страны посетителя по IP-адресу для правил выбора адреса назначения.
+// Без него условия по странам не выполняются
+func WithCountryResolver(resolver CountryResolver) Option {
+	return func(s *Service) error {
+		s.countryResolver = resolver
+		return nil
+	}
+}
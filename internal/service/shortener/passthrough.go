@@ -0,0 +1,137 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+// QueryMergeRule правило объединения одноименных параметров адреса назначения и запроса на короткую ссылку
+type QueryMergeRule string
+
+const (
+	// QueryMergeLink остаются значения из адреса назначения, из запроса добавляются только новые параметры
+	QueryMergeLink QueryMergeRule = "link"
+	// QueryMergeRequest значения из запроса заменяют одноименные параметры адреса назначения
+	QueryMergeRequest QueryMergeRule = "request"
+	// QueryMergeAppend сохраняются значения и из адреса назначения, и из запроса
+	QueryMergeAppend QueryMergeRule = "append"
+)
+
+// DefaultQueryMerge правило объединения параметров по умолчанию
+const DefaultQueryMerge = QueryMergeLink
+
+var (
+	// ErrPathNotAllowed к ссылке без PassPath обратились с дополнительным путем
+	ErrPathNotAllowed = errors.New("link does not accept extra path")
+	// ErrInvalidQueryMerge неизвестное правило объединения параметров
+	ErrInvalidQueryMerge = errors.New("query_merge must be link, request or append")
+)
+
+// ParseQueryMergeRule разбирает правило объединения параметров: link, request или append
+func ParseQueryMergeRule(value string) (QueryMergeRule, error) {
+	switch rule := QueryMergeRule(strings.ToLower(strings.TrimSpace(value))); rule {
+	case QueryMergeLink, QueryMergeRequest, QueryMergeAppend:
+		return rule, nil
+	default:
+		return "", fmt.Errorf("unknown rule '%s': %w", value, ErrInvalidQueryMerge)
+	}
+}
+
+// SetQueryMerge задает правило объединения параметров для ссылки. Пустое - правило из настроек сервиса
+func (s *Service) SetQueryMerge(linkEntity *entity.LinkEntity, value string) error {
+	if value == "" {
+		linkEntity.QueryMerge = ""
+		return nil
+	}
+	rule, err := ParseQueryMergeRule(value)
+	if err != nil {
+		return err
+	}
+	linkEntity.QueryMerge = string(rule)
+	return nil
+}
+
+// Destination возвращает адрес, на который ведет переход посетителя visitor по ссылке с дополнительным путем extraPath
+// и параметрами query. Адрес выбирается по правилам Targeting, к нему добавляется UTM разметка ссылки,
+// заменяя одноименные параметры.
+// Путь и параметры запроса добавляются, только если это разрешено в настройках ссылки.
+// Возвращает ErrPathNotAllowed, если путь передан, а ссылка его не принимает
+func (s *Service) Destination(linkEntity entity.LinkEntity, visitor Visitor, extraPath string, query url.Values) (string, error) {
+	if extraPath != "" && !linkEntity.PassPath {
+		return "", ErrPathNotAllowed
+	}
+	target := s.TargetURL(linkEntity, visitor)
+	if extraPath == "" && (!linkEntity.PassQuery || len(query) == 0) && linkEntity.UTM == nil {
+		return target, nil
+	}
+
+	destination, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if extraPath != "" {
+		// путь очищается от . и .., чтобы нельзя было подняться выше пути адреса назначения
+		extra := path.Clean("/" + extraPath)
+		if strings.HasSuffix(extraPath, "/") && extra != "/" {
+			extra += "/"
+		}
+		destination.Path = strings.TrimSuffix(destination.Path, "/") + extra
+		destination.RawPath = ""
+	}
+	if linkEntity.UTM != nil {
+		destination.RawQuery = mergeQuery(destination.RawQuery, linkEntity.UTM.Values(), QueryMergeRequest)
+	}
+	if linkEntity.PassQuery {
+		rule := QueryMergeRule(linkEntity.QueryMerge)
+		if rule == "" {
+			rule = s.queryMerge
+		}
+		destination.RawQuery = mergeQuery(destination.RawQuery, query, rule)
+	}
+	return destination.String(), nil
+}
+
+// mergeQuery добавляет к строке параметров rawQuery параметры query по правилу rule.
+// Параметры адреса назначения остаются в исходном порядке и виде
+func mergeQuery(rawQuery string, query url.Values, rule QueryMergeRule) string {
+	if len(query) == 0 {
+		return rawQuery
+	}
+
+	pairs := make([]string, 0)
+	present := make(map[string]bool)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key := pair
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			key = pair[:i]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if _, ok := query[key]; ok && rule == QueryMergeRequest {
+			continue
+		}
+		present[key] = true
+		pairs = append(pairs, pair)
+	}
+
+	extra := make(url.Values, len(query))
+	for key, values := range query {
+		if present[key] && rule == QueryMergeLink {
+			continue
+		}
+		extra[key] = values
+	}
+	if encoded := extra.Encode(); encoded != "" {
+		pairs = append(pairs, encoded)
+	}
+	return strings.Join(pairs, "&")
+}
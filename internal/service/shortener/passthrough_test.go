@@ -0,0 +1,101 @@
+package shortener
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+func TestService_Destination(t *testing.T) {
+	s := NewService("http://localhost:8080")
+
+	tests := []struct {
+		name      string
+		link      entity.LinkEntity
+		extraPath string
+		query     string
+		want      string
+		wantErr   error
+	}{
+		{
+			name:  "passthrough disabled",
+			link:  entity.LinkEntity{OriginalURL: "https://ya.ru/a?b=1"},
+			query: "utm_source=mail",
+			want:  "https://ya.ru/a?b=1",
+		},
+		{
+			name:      "path not allowed",
+			link:      entity.LinkEntity{OriginalURL: "https://ya.ru/a"},
+			extraPath: "x",
+			wantErr:   ErrPathNotAllowed,
+		},
+		{
+			name:  "query added",
+			link:  entity.LinkEntity{OriginalURL: "https://ya.ru/a?z=1&b=2", PassQuery: true},
+			query: "utm_source=mail",
+			want:  "https://ya.ru/a?z=1&b=2&utm_source=mail",
+		},
+		{
+			name:  "link wins by default",
+			link:  entity.LinkEntity{OriginalURL: "https://ya.ru/a?b=2", PassQuery: true},
+			query: "b=3&c=4",
+			want:  "https://ya.ru/a?b=2&c=4",
+		},
+		{
+			name:  "request wins",
+			link:  entity.LinkEntity{OriginalURL: "https://ya.ru/a?b=2&d=5", PassQuery: true, QueryMerge: string(QueryMergeRequest)},
+			query: "b=3",
+			want:  "https://ya.ru/a?d=5&b=3",
+		},
+		{
+			name:  "append",
+			link:  entity.LinkEntity{OriginalURL: "https://ya.ru/a?b=2", PassQuery: true, QueryMerge: string(QueryMergeAppend)},
+			query: "b=3",
+			want:  "https://ya.ru/a?b=2&b=3",
+		},
+		{
+			name:      "path appended",
+			link:      entity.LinkEntity{OriginalURL: "https://ya.ru/docs/?v=1", PassPath: true},
+			extraPath: "guide/intro/",
+			want:      "https://ya.ru/docs/guide/intro/?v=1",
+		},
+		{
+			name:      "path can't escape",
+			link:      entity.LinkEntity{OriginalURL: "https://ya.ru/docs", PassPath: true},
+			extraPath: "../../admin",
+			want:      "https://ya.ru/docs/admin",
+		},
+		{
+			name:      "path and query",
+			link:      entity.LinkEntity{OriginalURL: "https://ya.ru", PassPath: true, PassQuery: true},
+			extraPath: "a b",
+			query:     "q=1",
+			want:      "https://ya.ru/a%20b?q=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			got, err := s.Destination(tt.link, Visitor{}, tt.extraPath, query)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseQueryMergeRule(t *testing.T) {
+	rule, err := ParseQueryMergeRule(" Append ")
+	require.NoError(t, err)
+	assert.Equal(t, QueryMergeAppend, rule)
+
+	_, err = ParseQueryMergeRule("replace")
+	assert.ErrorIs(t, err, ErrInvalidQueryMerge)
+}
@@ -0,0 +1,88 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength bcrypt учитывает только первые 72 байта пароля
+const maxPasswordLength = 72
+
+var (
+	// ErrPasswordRequired для перехода по ссылке нужен пароль
+	ErrPasswordRequired = errors.New("link is password protected")
+	// ErrWrongPassword пароль ссылки не подошел
+	ErrWrongPassword = errors.New("wrong link password")
+	// ErrPasswordTooLong пароль длиннее, чем может проверить bcrypt
+	ErrPasswordTooLong = fmt.Errorf("password must be at most %d bytes", maxPasswordLength)
+)
+
+// TooManyAttemptsError исчерпан лимит неудачных попыток ввода пароля ссылки
+type TooManyAttemptsError struct {
+	// RetryAfter когда можно будет попробовать снова
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many wrong passwords, retry after %s", e.RetryAfter)
+}
+
+// ProtectLink закрывает ссылку паролем: в ссылке сохраняется bcrypt хеш пароля.
+// Пустой пароль оставляет ссылку открытой
+func (s *Service) ProtectLink(linkEntity *entity.LinkEntity, password string) error {
+	if password == "" {
+		return nil
+	}
+	if len(password) > maxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.passwordCost)
+	if err != nil {
+		return err
+	}
+	linkEntity.PasswordHash = string(hash)
+	return nil
+}
+
+// UnlockLink проверяет пароль для перехода по ссылке. Для открытых ссылок всегда возвращает nil.
+// Возвращает ErrPasswordRequired, ErrWrongPassword или *TooManyAttemptsError,
+// если неудачных попыток для этой ссылки было больше, чем разрешает лимит
+func (s *Service) UnlockLink(ctx context.Context, linkEntity entity.LinkEntity, password string) error {
+	if !linkEntity.IsProtected() {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+
+	key := "password:" + linkEntity.ID
+	if s.passwordAttempts.Enabled() {
+		// пока лимит исчерпан, пароль не проверяется вовсе, иначе его можно было бы подобрать и под лимитом
+		res, err := s.passwordAttemptsStore.Take(ctx, key, s.passwordAttempts, 0)
+		if err != nil {
+			return err
+		}
+		if res.Remaining < 1 {
+			return &TooManyAttemptsError{RetryAfter: res.RetryAfter}
+		}
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(linkEntity.PasswordHash), []byte(password))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return err
+	}
+	if s.passwordAttempts.Enabled() {
+		if _, err = s.passwordAttemptsStore.Take(ctx, key, s.passwordAttempts, 1); err != nil {
+			return err
+		}
+	}
+	return ErrWrongPassword
+}
@@ -0,0 +1,94 @@
+package shortener
+
+import (
+	"sync"
+
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/qr"
+)
+
+// DefaultQRCacheSize количество изображений QR кодов в кеше по умолчанию
+const DefaultQRCacheSize = 1000
+
+// LinkQRCode возвращает изображение QR кода короткой ссылки linkID.
+// Код зависит только от короткой ссылки, поэтому изображения кешируются по идентификатору ссылки и параметрам
+func (s *Service) LinkQRCode(linkID string, opts qr.Options) ([]byte, error) {
+	if image, ok := s.qrCache.get(linkID, opts); ok {
+		return image, nil
+	}
+	image, err := qr.Encode(s.ShortURL(linkID), opts)
+	if err != nil {
+		return nil, err
+	}
+	s.qrCache.put(linkID, opts, image)
+	return image, nil
+}
+
+// qrCache кеш изображений QR кодов. nil кеш ничего не хранит
+type qrCache struct {
+	mu    sync.Mutex
+	items map[string]map[qr.Options][]byte
+	count int
+	size  int
+}
+
+// newQRCache создает кеш на size изображений. Если size не задан, кеш выключен
+func newQRCache(size int) *qrCache {
+	if size <= 0 {
+		return nil
+	}
+	return &qrCache{
+		items: make(map[string]map[qr.Options][]byte),
+		size:  size,
+	}
+}
+
+func (c *qrCache) get(linkID string, opts qr.Options) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	image, ok := c.items[linkID][opts]
+	return image, ok
+}
+
+// put кладет изображение в кеш. Если кеш заполнен, сначала удаляются изображения произвольной ссылки
+func (c *qrCache) put(linkID string, opts qr.Options, image []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id := range c.items {
+		if c.count < c.size {
+			break
+		}
+		c.count -= len(c.items[id])
+		delete(c.items, id)
+	}
+	images, ok := c.items[linkID]
+	if !ok {
+		images = make(map[qr.Options][]byte)
+		c.items[linkID] = images
+	}
+	if _, ok = images[opts]; !ok {
+		c.count++
+	}
+	images[opts] = image
+}
+
+// invalidate удаляет из кеша все изображения ссылок
+func (c *qrCache) invalidate(linkIDs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, id := range linkIDs {
+		c.count -= len(c.items[id])
+		delete(c.items, id)
+	}
+}
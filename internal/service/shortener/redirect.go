@@ -0,0 +1,59 @@
+package shortener
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+// DefaultRedirectCode код ответа при переходе по ссылке, если другой не задан в настройках
+const DefaultRedirectCode = http.StatusTemporaryRedirect
+
+// ErrInvalidRedirectCode код ответа при переходе не входит в список поддерживаемых
+var ErrInvalidRedirectCode = errors.New("redirect_code must be one of 301, 302, 307, 308")
+
+// IsValidRedirectCode возвращает true для поддерживаемых кодов ответа при переходе: 301, 302, 307, 308
+func IsValidRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsPermanentRedirect возвращает true для кодов постоянного перенаправления, которые браузеры кешируют
+func IsPermanentRedirect(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+}
+
+// SetRedirectCode задает код ответа при переходе по ссылке. 0 - код по умолчанию из настроек сервиса
+func (s *Service) SetRedirectCode(linkEntity *entity.LinkEntity, code int) error {
+	if code != 0 && !IsValidRedirectCode(code) {
+		return ErrInvalidRedirectCode
+	}
+	linkEntity.RedirectCode = code
+	return nil
+}
+
+// RedirectCode возвращает код ответа при переходе по ссылке.
+// Защищенные паролем и ограниченные по переходам ссылки перенаправляются только временно:
+// закешированный браузером постоянный переход обходил бы и пароль, и счетчик.
+// Так же перенаправляются ссылки с правилами выбора адреса и вариантами: браузер запомнил бы адрес одного посетителя,
+// и ссылки с окном работы: браузер продолжал бы переходить после его окончания
+func (s *Service) RedirectCode(linkEntity entity.LinkEntity) int {
+	code := linkEntity.RedirectCode
+	if code == 0 {
+		code = s.defaultRedirectCode
+	}
+	if linkEntity.IsProtected() || linkEntity.IsClickLimited() || linkEntity.IsTargeted() || linkEntity.IsScheduled() {
+		switch code {
+		case http.StatusMovedPermanently:
+			code = http.StatusFound
+		case http.StatusPermanentRedirect:
+			code = http.StatusTemporaryRedirect
+		}
+	}
+	return code
+}
@@ -0,0 +1,66 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+var (
+	// ErrInvalidSchedule окно работы ссылки не прошло проверку
+	ErrInvalidSchedule = errors.New("invalid link schedule")
+	// ErrLinkNotYetActive ссылка еще не начала работать
+	ErrLinkNotYetActive = errors.New("link is not active yet")
+	// ErrLinkExpired ссылка уже перестала работать
+	ErrLinkExpired = errors.New("link has expired")
+)
+
+// Schedule окно, в которое работает ссылка, и куда вести посетителей вне его
+type Schedule struct {
+	// NotBefore с какого момента ссылка работает. nil - сразу
+	NotBefore *time.Time
+	// NotAfter с какого момента ссылка перестает работать. nil - без срока
+	NotAfter *time.Time
+	// InactiveURL адрес для посетителей вне окна. Пустой - страница о том, что ссылка не работает
+	InactiveURL string
+}
+
+// SetSchedule задает окно работы ссылки. Расписание заменяется целиком: пустое снимает ограничения
+func (s *Service) SetSchedule(linkEntity *entity.LinkEntity, schedule Schedule) error {
+	if schedule.NotBefore != nil && schedule.NotAfter != nil && !schedule.NotAfter.After(*schedule.NotBefore) {
+		return fmt.Errorf("%w: not_after must be later than not_before", ErrInvalidSchedule)
+	}
+	if schedule.InactiveURL != "" {
+		if err := s.ValidateURL(schedule.InactiveURL); err != nil {
+			return fmt.Errorf("%w: inactive_url: %s", ErrInvalidSchedule, err.Error())
+		}
+	}
+	linkEntity.NotBefore = utcTime(schedule.NotBefore)
+	linkEntity.NotAfter = utcTime(schedule.NotAfter)
+	linkEntity.InactiveURL = schedule.InactiveURL
+	return nil
+}
+
+// utcTime возвращает копию времени в UTC, чтобы ссылка не делила значение с вызывающим кодом
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// CheckSchedule проверяет, работает ли ссылка сейчас.
+// Возвращает ErrLinkNotYetActive до NotBefore и ErrLinkExpired начиная с NotAfter
+func (s *Service) CheckSchedule(linkEntity entity.LinkEntity) error {
+	now := time.Now()
+	if linkEntity.NotBefore != nil && now.Before(*linkEntity.NotBefore) {
+		return ErrLinkNotYetActive
+	}
+	if linkEntity.NotAfter != nil && !now.Before(*linkEntity.NotAfter) {
+		return ErrLinkExpired
+	}
+	return nil
+}
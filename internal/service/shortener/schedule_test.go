@@ -0,0 +1,57 @@
+package shortener
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+func TestService_Schedule(t *testing.T) {
+	s := NewService("http://localhost:8080")
+	linkEntity := entity.NewLinkEntity("https://example.com", "user1")
+	require.NoError(t, s.CheckSchedule(linkEntity))
+
+	hour := time.Hour
+	past, future := time.Now().Add(-hour), time.Now().Add(hour)
+	tests := []struct {
+		name     string
+		schedule Schedule
+		want     error
+	}{
+		{
+			name:     "not yet active",
+			schedule: Schedule{NotBefore: &future},
+			want:     ErrLinkNotYetActive,
+		},
+		{
+			name:     "expired",
+			schedule: Schedule{NotAfter: &past},
+			want:     ErrLinkExpired,
+		},
+		{
+			name:     "inside window",
+			schedule: Schedule{NotBefore: &past, NotAfter: &future},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, s.SetSchedule(&linkEntity, tt.schedule))
+			assert.True(t, linkEntity.IsScheduled())
+			err := s.CheckSchedule(linkEntity)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	assert.ErrorIs(t, s.SetSchedule(&linkEntity, Schedule{NotBefore: &future, NotAfter: &past}), ErrInvalidSchedule)
+	assert.ErrorIs(t, s.SetSchedule(&linkEntity, Schedule{NotBefore: &future, InactiveURL: "soon"}), ErrInvalidSchedule)
+
+	require.NoError(t, s.SetSchedule(&linkEntity, Schedule{}))
+	assert.False(t, linkEntity.IsScheduled())
+}
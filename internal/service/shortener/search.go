@@ -0,0 +1,29 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+// ErrInvalidSearch условия поиска ссылок заданы неверно
+var ErrInvalidSearch = errors.New("invalid search filter")
+
+// SearchUserLinks ищет не удаленные ссылки пользователя uid по тегу, подстроке адреса или названия
+// и интервалу времени создания [CreatedFrom, CreatedTo). Ссылки возвращаются от новых к старым
+func (s *Service) SearchUserLinks(ctx context.Context, uid string, filter repository.LinkFilter) ([]entity.LinkEntity, error) {
+	filter.Tag = NormalizeTag(filter.Tag)
+	filter.Query = strings.TrimSpace(filter.Query)
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero() && !filter.CreatedFrom.Before(filter.CreatedTo) {
+		return nil, ErrInvalidSearch
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return s.linksRepository.SearchLinks(ctx, uid, filter)
+}
@@ -2,12 +2,16 @@ package shortener
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/zaz600/go-musthave-shortener/internal/entity"
 	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
 	"github.com/zaz600/go-musthave-shortener/internal/pkg/random"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/shortid"
 )
 
 func Test_isValidURL(t *testing.T) {
@@ -40,6 +44,43 @@ func Test_isValidURL(t *testing.T) {
 	}
 }
 
+func TestService_ShortenURLIDCollision(t *testing.T) {
+	db := map[string]entity.LinkEntity{
+		"aaa": {ID: "aaa", OriginalURL: "http://ya.ru/1", UID: "100"},
+		"aab": {ID: "aab", OriginalURL: "http://ya.ru/2", UID: "100"},
+	}
+	// сервис и репозиторий выдают идентификаторы из одной последовательности, первые два уже заняты
+	generator := shortid.NewSequence("ab", 3)
+	repo := repository.NewInMemoryLinksRepository(context.TODO(), db, repository.WithIDGenerator(generator))
+	linksService := NewService("http://localhost:8080", WithRepository(repo), WithIDGenerator(generator))
+
+	link := linksService.NewLinkEntity("http://ya.ru/3", "100")
+	assert.Equal(t, "aaa", link.ID)
+	saved, err := linksService.ShortenURL(context.TODO(), link)
+	require.NoError(t, err)
+	assert.Equal(t, "aba", saved.ID)
+	assert.Equal(t, "http://ya.ru/1", db["aaa"].OriginalURL, "existing link is not overwritten")
+
+	batch := linksService.NewBatchService(10)
+	require.NoError(t, batch.Add(context.TODO(), entity.LinkEntity{ID: "aba", OriginalURL: "http://ya.ru/4", UID: "100"}))
+	require.NoError(t, batch.Add(context.TODO(), entity.LinkEntity{ID: "zzz", OriginalURL: "http://ya.ru/5", UID: "100"}))
+	require.NoError(t, batch.Add(context.TODO(), entity.LinkEntity{ID: "zzz", OriginalURL: "http://ya.ru/6", UID: "100"}))
+	require.NoError(t, batch.Flush(context.TODO()))
+	ids := make([]string, 0, 3)
+	for _, e := range batch.Saved() {
+		ids = append(ids, e.ID)
+	}
+	assert.Equal(t, []string{"abb", "zzz", "baa"}, ids)
+
+	// пространство идентификаторов исчерпано
+	for i := 0; i < 3; i++ {
+		_, err = linksService.ShortenURL(context.TODO(), linksService.NewLinkEntity(fmt.Sprintf("http://ya.ru/x%d", i), "100"))
+		require.NoError(t, err)
+	}
+	_, err = linksService.ShortenURL(context.TODO(), linksService.NewLinkEntity("http://ya.ru/last", "100"))
+	assert.ErrorIs(t, err, shortid.ErrExhausted)
+}
+
 func Benchmark_isValidURL(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		IsValidURL("http://ya.ru?1")
@@ -55,3 +96,29 @@ func BenchmarkShortenURL(b *testing.B) {
 		_, _ = linksService.ShortenURL(context.TODO(), link)
 	}
 }
+
+func TestService_RedirectCode(t *testing.T) {
+	s := NewService("http://localhost:8080", WithDefaultRedirectCode(http.StatusFound))
+
+	tests := []struct {
+		name string
+		link entity.LinkEntity
+		want int
+	}{
+		{name: "default", link: entity.LinkEntity{}, want: http.StatusFound},
+		{name: "per link", link: entity.LinkEntity{RedirectCode: http.StatusMovedPermanently}, want: http.StatusMovedPermanently},
+		{name: "protected", link: entity.LinkEntity{RedirectCode: http.StatusMovedPermanently, PasswordHash: "hash"}, want: http.StatusFound},
+		{name: "click limited", link: entity.LinkEntity{RedirectCode: http.StatusPermanentRedirect, MaxClicks: 1}, want: http.StatusTemporaryRedirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, s.RedirectCode(tt.link))
+		})
+	}
+
+	var e entity.LinkEntity
+	assert.ErrorIs(t, s.SetRedirectCode(&e, http.StatusOK), ErrInvalidRedirectCode)
+	require.NoError(t, s.SetRedirectCode(&e, http.StatusPermanentRedirect))
+	assert.Equal(t, http.StatusPermanentRedirect, e.RedirectCode)
+	assert.False(t, e.Deduplicable())
+}
@@ -2,6 +2,7 @@ package shortener
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"time"
@@ -10,9 +11,17 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/zaz600/go-musthave-shortener/internal/entity"
 	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/ratelimit"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/shortid"
 	"github.com/zaz600/go-musthave-shortener/internal/service/batch"
+	"github.com/zaz600/go-musthave-shortener/internal/service/policy"
+	"github.com/zaz600/go-musthave-shortener/internal/service/quota"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// DefaultPasswordAttempts ограничение неудачных попыток ввода пароля ссылки по умолчанию
+var DefaultPasswordAttempts = ratelimit.Limit{Burst: 5, Period: 15 * time.Minute}
+
 // Service сервис сокращения ссылок
 type Service struct {
 	*chi.Mux
@@ -22,13 +31,72 @@ type Service struct {
 	linksRepository repository.LinksRepository
 	// linkRemoveCh канал для отправки запросов на асинхронное удаление ссылок
 	linkRemoveCh chan<- removeUserLinksRequest
+	// canonicalizer приводит ссылки к каноническому виду перед сохранением
+	canonicalizer *Canonicalizer
+	// urlPolicy правила проверки сокращаемых ссылок
+	urlPolicy URLPolicy
+	// destinationPolicy списки запрещенных и разрешенных хостов. Опционально
+	destinationPolicy DestinationPolicy
+	// disableBlockedLinks перестать отдавать уже сохраненные ссылки, хост которых попал под запрет
+	disableBlockedLinks bool
+	// quotas ограничения на количество ссылок пользователей. Опционально
+	quotas *quota.Quotas
+	// idGenerator генератор коротких идентификаторов новых ссылок
+	idGenerator IDGenerator
+	// recordIDGenerator генератор идентификаторов групп, рабочих пространств и API ключей
+	recordIDGenerator IDGenerator
+	// passwordCost стоимость bcrypt хеширования паролей ссылок
+	passwordCost int
+	// passwordAttemptsStore хранилище счетчиков неудачных попыток ввода пароля ссылок
+	passwordAttemptsStore ratelimit.Store
+	// passwordAttempts ограничение неудачных попыток ввода пароля одной ссылки. Нулевое - без ограничений
+	passwordAttempts ratelimit.Limit
+	// linkCache кеш ссылок для переходов. nil - кеш выключен
+	linkCache *linkCache
+	// qrCache кеш изображений QR кодов ссылок. nil - кеш выключен
+	qrCache *qrCache
+	// defaultRedirectCode код ответа при переходе по ссылкам, для которых он не задан
+	defaultRedirectCode int
+	// queryMerge правило объединения параметров для ссылок, у которых оно не задано
+	queryMerge QueryMergeRule
+	// countryResolver определяет страну посетителя для правил выбора адреса. Опционально
+	countryResolver CountryResolver
+}
+
+// IDGenerator генератор коротких идентификаторов ссылок. Реализации - в пакете shortid
+type IDGenerator interface {
+	// NewID возвращает новый идентификатор
+	NewID() (string, error)
+}
+
+// QuotaUsage ограничения пользователя и их текущее использование
+type QuotaUsage struct {
+	quota.Limits
+	// UsedLinks количество активных ссылок пользователя
+	UsedLinks int
+}
+
+// DestinationPolicy проверяет, разрешено ли сокращать ссылки на хост
+type DestinationPolicy interface {
+	// Check возвращает *policy.DeniedError, если хост ссылки запрещен
+	Check(rawURL string) error
 }
 
 func NewService(baseURL string, opts ...Option) *Service {
 	s := &Service{
-		Mux:             chi.NewRouter(),
-		baseURL:         baseURL,
-		linksRepository: nil,
+		Mux:                   chi.NewRouter(),
+		baseURL:               baseURL,
+		linksRepository:       nil,
+		canonicalizer:         NewCanonicalizer(false),
+		urlPolicy:             DefaultURLPolicy(),
+		idGenerator:           shortid.Default(),
+		recordIDGenerator:     shortid.Default(),
+		passwordCost:          bcrypt.DefaultCost,
+		passwordAttemptsStore: ratelimit.NewMemoryStore(),
+		passwordAttempts:      DefaultPasswordAttempts,
+		qrCache:               newQRCache(DefaultQRCacheSize),
+		defaultRedirectCode:   DefaultRedirectCode,
+		queryMerge:            DefaultQueryMerge,
 	}
 
 	for _, opt := range opts {
@@ -54,6 +122,8 @@ func (s *Service) ShortURL(linkID string) string {
 // RemoveLinks запрос на удаление ссылок.
 // Фактически ссылки не удаляются из БД,
 // а помечаются как удаленные и перестают быть доступными в других методах.
+// Удаляются только ссылки, которые пользователь вправе изменять: его личные ссылки
+// и ссылки пространств, где он редактор или владелец, остальные пропускаются
 func (s *Service) RemoveLinks(removeIDs []string, uid string) {
 	s.linkRemoveCh <- removeUserLinksRequest{
 		linkIDs: removeIDs,
@@ -69,28 +139,142 @@ func (s *Service) Shutdown(ctx context.Context) error {
 	return s.linksRepository.Close(ctx)
 }
 
-// ShortenURL сохраняет в хранилище запись о сокращенной ссылке
+// ValidateURL проверяет ссылку на пригодность для сокращения по правилам URLPolicy.
+// Возвращает *InvalidURLError с причиной отказа.
+func (s *Service) ValidateURL(rawURL string) error {
+	if err := s.urlPolicy.Validate(rawURL, s.baseURL); err != nil {
+		return err
+	}
+	if s.destinationPolicy == nil {
+		return nil
+	}
+	if err := s.destinationPolicy.Check(rawURL); err != nil {
+		var deniedErr *policy.DeniedError
+		if errors.As(err, &deniedErr) {
+			return &InvalidURLError{Reason: InvalidURLReason(deniedErr.Reason), Message: deniedErr.Error()}
+		}
+		return err
+	}
+	return nil
+}
+
+// CheckDestination проверяет, можно ли переходить по ранее сохраненной ссылке.
+// Возвращает ошибку, если включено отключение заблокированных ссылок и запрещен хост ссылки
+// или любого из адресов ее правил, вариантов и адреса для посетителей вне окна работы
+func (s *Service) CheckDestination(linkEntity entity.LinkEntity) error {
+	if s.destinationPolicy == nil || !s.disableBlockedLinks {
+		return nil
+	}
+	if err := s.destinationPolicy.Check(linkEntity.OriginalURL); err != nil {
+		return err
+	}
+	for _, rule := range linkEntity.Targeting {
+		if err := s.destinationPolicy.Check(rule.URL); err != nil {
+			return err
+		}
+	}
+	for _, variant := range linkEntity.Variants {
+		if err := s.destinationPolicy.Check(variant.URL); err != nil {
+			return err
+		}
+	}
+	if linkEntity.InactiveURL != "" {
+		return s.destinationPolicy.Check(linkEntity.InactiveURL)
+	}
+	return nil
+}
+
+// URLPolicy возвращает действующие правила проверки ссылок
+func (s *Service) URLPolicy() URLPolicy {
+	return s.urlPolicy
+}
+
+// NewLinkEntity создает ссылку пользователя uid.
+// Оригинальная ссылка сохраняется как есть для отображения, дубликаты ищутся по ее канонической форме.
+// Идентификатор выдает IDGenerator. Если он не смог, идентификатор остается пустым и его подберет репозиторий
+func (s *Service) NewLinkEntity(originalURL string, uid string) entity.LinkEntity {
+	e := entity.NewLinkEntity(originalURL, uid)
+	e.CanonicalURL = s.canonicalURL(originalURL)
+	id, err := s.idGenerator.NewID()
+	if err != nil {
+		log.Warn().Err(err).Msg("can't generate link id")
+	}
+	e.ID = id
+	return e
+}
+
+// ShortenURL сохраняет в хранилище запись о сокращенной ссылке.
+// Возвращает сохраненную ссылку: при коллизии хранилище заменяет ее идентификатор
 func (s *Service) ShortenURL(ctx context.Context, linkEntity entity.LinkEntity) (entity.LinkEntity, error) {
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
+	if linkEntity.CanonicalURL == "" {
+		linkEntity.CanonicalURL = s.canonicalURL(linkEntity.OriginalURL)
+	}
 	return s.linksRepository.PutIfAbsent(ctx, linkEntity)
 }
 
-// GetUserLinks извлекает ссылки, сокращенные пользователем по его идентификатору
-func (s *Service) GetUserLinks(ctx context.Context, uid string) ([]entity.LinkEntity, error) {
+// canonicalURL возвращает каноническую форму ссылки.
+// Если ссылку не удалось разобрать, дубликаты будут искаться по ней самой
+func (s *Service) canonicalURL(originalURL string) string {
+	canonicalURL, err := s.canonicalizer.Canonicalize(originalURL)
+	if err != nil {
+		log.Debug().Err(err).Str("url", originalURL).Msg("can't canonicalize url")
+		return originalURL
+	}
+	return canonicalURL
+}
+
+// GetQuota возвращает ограничения пользователя и количество его активных ссылок
+func (s *Service) GetQuota(ctx context.Context, uid string) (QuotaUsage, error) {
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
-	return s.linksRepository.FindLinksByUID(ctx, uid)
+	var usage QuotaUsage
+	if s.quotas != nil {
+		usage.Limits = s.quotas.For(uid)
+	}
+	count, err := s.linksRepository.CountLinksByUID(ctx, uid)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	usage.UsedLinks = count
+	return usage, nil
+}
+
+// CheckBatchQuota проверяет, что пользователь может сократить пачку из n ссылок.
+// Возвращает quota.ErrBatchTooLarge или quota.ErrLinksExceeded.
+// Окончательно квота на количество ссылок проверяется репозиторием при сохранении
+func (s *Service) CheckBatchQuota(ctx context.Context, uid string, n int) error {
+	if s.quotas == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	count, err := s.linksRepository.CountLinksByUID(ctx, uid)
+	if err != nil {
+		return err
+	}
+	return s.quotas.CheckBatch(uid, count, n)
 }
 
-// Get возвращает информацию о сокращенной ссылке по ее короткому идентификатору
+// Get возвращает информацию о сокращенной ссылке по ее короткому идентификатору.
+// Используется при переходах, поэтому ссылка может быть взята из кеша (WithLinkCache)
 func (s *Service) Get(ctx context.Context, linkID string) (*entity.LinkEntity, error) {
+	if e, ok := s.linkCache.get(linkID); ok {
+		return &e, nil
+	}
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
-	return s.linksRepository.Get(ctx, linkID)
+	e, err := s.linksRepository.Get(ctx, linkID)
+	if err != nil {
+		return nil, err
+	}
+	s.linkCache.put(*e)
+	return e, nil
 }
 
 // Count возвращает количество ссылок в хранилище
@@ -131,6 +315,8 @@ func (s *Service) startRemoveLinksWorkers(ctx context.Context, count int) chan<-
 						defer cancel()
 
 						err := s.linksRepository.DeleteLinksByUID(ctx, req.uid, req.linkIDs...)
+						s.linkCache.invalidate(req.linkIDs...)
+						s.qrCache.invalidate(req.linkIDs...)
 						if err != nil {
 							log.Warn().Str("worker", workerID).Err(err).Strs("ids", req.linkIDs).Str("uid", req.uid).Msg("error delete user links")
 							return
@@ -144,7 +330,8 @@ func (s *Service) startRemoveLinksWorkers(ctx context.Context, count int) chan<-
 	return linkCh
 }
 
-// IsValidURL проверяет адрес на пригодность для сохранения в БД
+// IsValidURL проверяет адрес на пригодность для сохранения в БД.
+// Проверяется только то, что адрес разбирается как URL, более строгие правила задает URLPolicy
 func IsValidURL(value string) bool {
 	if value == "" {
 		return false
@@ -0,0 +1,85 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+const (
+	// maxNotesLength максимальная длина заметок к ссылке в символах
+	maxNotesLength = 2000
+	// maxTags максимальное количество тегов у ссылки
+	maxTags = 20
+	// maxTagLength максимальная длина тега в символах
+	maxTagLength = 32
+)
+
+var (
+	// ErrNotesTooLong заметки к ссылке длиннее допустимого
+	ErrNotesTooLong = fmt.Errorf("notes must be at most %d characters", maxNotesLength)
+	// ErrInvalidTags теги ссылки заданы неверно
+	ErrInvalidTags = errors.New("invalid tags")
+)
+
+// SetNotes задает заметки владельца к ссылке. Пробелы по краям отбрасываются, пустые заметки снимают их
+func (s *Service) SetNotes(linkEntity *entity.LinkEntity, notes string) error {
+	notes = strings.TrimSpace(notes)
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return ErrNotesTooLong
+	}
+	linkEntity.Notes = notes
+	return nil
+}
+
+// SetTags задает теги ссылки целиком. Теги приводятся к нижнему регистру, повторы отбрасываются,
+// порядок сохраняется. Тег состоит из букв, цифр и символов "-", "_", ".". Пустой список снимает теги
+func (s *Service) SetTags(linkEntity *entity.LinkEntity, tags []string) error {
+	if len(tags) == 0 {
+		linkEntity.Tags = nil
+		return nil
+	}
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if err := validateTag(tag); err != nil {
+			return err
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxTags {
+		return fmt.Errorf("%w: at most %d tags allowed", ErrInvalidTags, maxTags)
+	}
+	linkEntity.Tags = result
+	return nil
+}
+
+// NormalizeTag приводит тег к виду, в котором он хранится у ссылок
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// validateTag проверяет приведенный к нижнему регистру тег
+func validateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("%w: empty tag", ErrInvalidTags)
+	}
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		return fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidTags, tag, maxTagLength)
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.", r) {
+			return fmt.Errorf("%w: tag %q contains %q", ErrInvalidTags, tag, r)
+		}
+	}
+	return nil
+}
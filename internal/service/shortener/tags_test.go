@@ -0,0 +1,82 @@
+package shortener
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+func TestService_SetTags(t *testing.T) {
+	s := NewService("http://localhost:8080")
+	linkEntity := entity.NewLinkEntity("https://ya.ru", "user1")
+
+	require.NoError(t, s.SetTags(&linkEntity, []string{" News ", "promo", "news", "ёлка_2022"}))
+	assert.Equal(t, []string{"news", "promo", "ёлка_2022"}, linkEntity.Tags)
+	assert.False(t, linkEntity.Deduplicable())
+
+	for _, tags := range [][]string{
+		{""},
+		{"two words"},
+		{"tag,list"},
+		{strings.Repeat("a", maxTagLength+1)},
+	} {
+		assert.ErrorIs(t, s.SetTags(&linkEntity, tags), ErrInvalidTags, tags)
+	}
+	tooMany := make([]string, 0, maxTags+1)
+	for i := 0; i <= maxTags; i++ {
+		tooMany = append(tooMany, strings.Repeat("a", i+1))
+	}
+	assert.ErrorIs(t, s.SetTags(&linkEntity, tooMany), ErrInvalidTags)
+	assert.Equal(t, []string{"news", "promo", "ёлка_2022"}, linkEntity.Tags, "invalid tags are not applied")
+
+	require.NoError(t, s.SetTags(&linkEntity, nil))
+	assert.Nil(t, linkEntity.Tags)
+}
+
+func TestService_SetNotes(t *testing.T) {
+	s := NewService("http://localhost:8080")
+	linkEntity := entity.NewLinkEntity("https://ya.ru", "user1")
+
+	require.NoError(t, s.SetNotes(&linkEntity, "  для рассылки  "))
+	assert.Equal(t, "для рассылки", linkEntity.Notes)
+	assert.ErrorIs(t, s.SetNotes(&linkEntity, strings.Repeat("я", maxNotesLength+1)), ErrNotesTooLong)
+}
+
+func TestService_SearchUserLinks(t *testing.T) {
+	ctx := context.Background()
+	base := time.Date(2022, 1, 10, 12, 0, 0, 0, time.UTC)
+	db := map[string]entity.LinkEntity{
+		"a": {ID: "a", UID: "user1", OriginalURL: "https://ya.ru/news", Tags: []string{"news"}, CreatedAt: base},
+		"b": {ID: "b", UID: "user1", OriginalURL: "https://go.dev", Title: "Go News", CreatedAt: base.Add(24 * time.Hour)},
+		"c": {ID: "c", UID: "user1", OriginalURL: "https://example.com", Tags: []string{"news", "promo"}, CreatedAt: base.Add(48 * time.Hour)},
+		"d": {ID: "d", UID: "user1", OriginalURL: "https://ya.ru/old", Tags: []string{"news"}, CreatedAt: base, Removed: true},
+		"e": {ID: "e", UID: "user2", OriginalURL: "https://ya.ru/news", Tags: []string{"news"}, CreatedAt: base},
+	}
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, db)))
+
+	ids := func(filter repository.LinkFilter) []string {
+		links, err := s.SearchUserLinks(ctx, "user1", filter)
+		require.NoError(t, err)
+		result := make([]string, 0, len(links))
+		for _, e := range links {
+			result = append(result, e.ID)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"c", "b", "a"}, ids(repository.LinkFilter{}))
+	assert.Equal(t, []string{"c", "a"}, ids(repository.LinkFilter{Tag: " NEWS"}))
+	assert.Equal(t, []string{"b", "a"}, ids(repository.LinkFilter{Query: "news"}))
+	assert.Equal(t, []string{"b"}, ids(repository.LinkFilter{Query: "News", CreatedFrom: base.Add(time.Hour)}))
+	assert.Equal(t, []string{"b", "a"}, ids(repository.LinkFilter{CreatedTo: base.Add(48 * time.Hour)}))
+	assert.Empty(t, ids(repository.LinkFilter{Tag: "promo", Query: "ya.ru"}))
+
+	_, err := s.SearchUserLinks(ctx, "user1", repository.LinkFilter{CreatedFrom: base, CreatedTo: base})
+	assert.ErrorIs(t, err, ErrInvalidSearch)
+}
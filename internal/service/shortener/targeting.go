@@ -0,0 +1,224 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/useragent"
+)
+
+// maxTargetRules максимальное количество правил выбора адреса назначения у одной ссылки
+const maxTargetRules = 20
+
+// ErrInvalidTargeting правила выбора адреса назначения не прошли проверку
+var ErrInvalidTargeting = errors.New("invalid targeting rules")
+
+// CountryResolver определяет страну по IP-адресу. Реализация - geoip.DB
+type CountryResolver interface {
+	// Country возвращает двухбуквенный код страны ISO 3166-1 или пустую строку, если страна неизвестна
+	Country(ip net.IP) (string, error)
+}
+
+// Visitor посетитель короткой ссылки. Пустые поля не подходят ни под одно условие правил
+type Visitor struct {
+	// Platform операционная система из User-Agent
+	Platform useragent.Platform
+	// Device тип устройства из User-Agent
+	Device useragent.Device
+	// Language самый предпочтительный язык из Accept-Language в нижнем регистре, например en-us
+	Language string
+	// Country код страны по IP-адресу в верхнем регистре
+	Country string
+	// ID постоянный идентификатор посетителя, по которому выбирается вариант адреса назначения
+	ID string
+	// Variant вариант адреса назначения, выбранный посетителю раньше
+	Variant string
+}
+
+// NewVisitor описывает посетителя по заголовкам User-Agent, Accept-Language и IP-адресу.
+// Страна определяется, только если сервису задан CountryResolver
+func (s *Service) NewVisitor(userAgent string, acceptLanguage string, ip net.IP) Visitor {
+	info := useragent.Parse(userAgent)
+	visitor := Visitor{
+		Platform: info.Platform,
+		Device:   info.Device,
+		Language: preferredLanguage(acceptLanguage),
+	}
+	if s.countryResolver != nil && ip != nil {
+		country, err := s.countryResolver.Country(ip)
+		if err != nil {
+			log.Debug().Err(err).Str("ip", ip.String()).Msg("can't resolve country")
+		}
+		visitor.Country = country
+	}
+	return visitor
+}
+
+// SetTargeting задает правила выбора адреса назначения. Адреса правил проверяются так же, как при сокращении.
+// Пустой список снимает правила
+func (s *Service) SetTargeting(linkEntity *entity.LinkEntity, rules []entity.TargetRule) error {
+	if len(rules) == 0 {
+		linkEntity.Targeting = nil
+		return nil
+	}
+	if len(rules) > maxTargetRules {
+		return fmt.Errorf("%w: at most %d rules allowed", ErrInvalidTargeting, maxTargetRules)
+	}
+
+	result := make([]entity.TargetRule, 0, len(rules))
+	for i, rule := range rules {
+		normalized, err := s.normalizeTargetRule(rule)
+		if err != nil {
+			return fmt.Errorf("%w: rule %d: %s", ErrInvalidTargeting, i+1, err.Error())
+		}
+		result = append(result, normalized)
+	}
+	linkEntity.Targeting = result
+	return nil
+}
+
+// normalizeTargetRule проверяет правило и приводит значения условий к виду, в котором они сравниваются с Visitor
+func (s *Service) normalizeTargetRule(rule entity.TargetRule) (entity.TargetRule, error) {
+	if err := s.ValidateURL(rule.URL); err != nil {
+		return entity.TargetRule{}, err
+	}
+	result := entity.TargetRule{
+		Platforms: normalizeValues(rule.Platforms, strings.ToLower),
+		Devices:   normalizeValues(rule.Devices, strings.ToLower),
+		Languages: normalizeValues(rule.Languages, strings.ToLower),
+		Countries: normalizeValues(rule.Countries, strings.ToUpper),
+		URL:       rule.URL,
+	}
+	if len(result.Platforms) == 0 && len(result.Devices) == 0 && len(result.Languages) == 0 && len(result.Countries) == 0 {
+		// правило без условий подходит всем, и адрес ссылки никогда бы не использовался
+		return entity.TargetRule{}, errors.New("rule has no conditions")
+	}
+	for _, platform := range result.Platforms {
+		switch useragent.Platform(platform) {
+		case useragent.PlatformIOS, useragent.PlatformAndroid, useragent.PlatformWindows, useragent.PlatformMacOS, useragent.PlatformLinux:
+		default:
+			return entity.TargetRule{}, fmt.Errorf("unknown platform '%s'", platform)
+		}
+	}
+	for _, device := range result.Devices {
+		switch useragent.Device(device) {
+		case useragent.DeviceMobile, useragent.DeviceTablet, useragent.DeviceDesktop:
+		default:
+			return entity.TargetRule{}, fmt.Errorf("unknown device '%s'", device)
+		}
+	}
+	for _, country := range result.Countries {
+		if len(country) != 2 {
+			return entity.TargetRule{}, fmt.Errorf("country '%s' must be a two-letter code", country)
+		}
+	}
+	return result, nil
+}
+
+// normalizeValues убирает пробелы и пустые значения и приводит значения к одному регистру
+func normalizeValues(values []string, toCase func(string) string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, toCase(value))
+		}
+	}
+	return result
+}
+
+// TargetURL возвращает адрес первого подходящего посетителю правила. Если не подошло ни одно,
+// возвращает адрес варианта посетителя, а у ссылки без вариантов - OriginalURL
+func (s *Service) TargetURL(linkEntity entity.LinkEntity, visitor Visitor) string {
+	if rule, ok := matchTargetRule(linkEntity, visitor); ok {
+		return rule.URL
+	}
+	if variant, ok := s.Variant(linkEntity, visitor); ok {
+		return variant.URL
+	}
+	return linkEntity.OriginalURL
+}
+
+// matchTargetRule возвращает первое правило ссылки, которое подходит посетителю
+func matchTargetRule(linkEntity entity.LinkEntity, visitor Visitor) (entity.TargetRule, bool) {
+	for _, rule := range linkEntity.Targeting {
+		if ruleMatches(rule, visitor) {
+			return rule, true
+		}
+	}
+	return entity.TargetRule{}, false
+}
+
+// ruleMatches возвращает true, если посетитель подходит под все условия правила
+func ruleMatches(rule entity.TargetRule, visitor Visitor) bool {
+	return matchesAny(rule.Platforms, string(visitor.Platform), strings.EqualFold) &&
+		matchesAny(rule.Devices, string(visitor.Device), strings.EqualFold) &&
+		matchesAny(rule.Languages, visitor.Language, languageMatches) &&
+		matchesAny(rule.Countries, visitor.Country, strings.EqualFold)
+}
+
+// matchesAny возвращает true, если условие не задано или value совпадает с одним из его значений
+func matchesAny(values []string, value string, match func(expected string, actual string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	if value == "" {
+		return false
+	}
+	for _, expected := range values {
+		if match(expected, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// languageMatches сравнивает язык правила с языком посетителя: en подходит для en и en-us
+func languageMatches(expected string, actual string) bool {
+	return strings.EqualFold(expected, actual) || strings.HasPrefix(strings.ToLower(actual), strings.ToLower(expected)+"-")
+}
+
+// preferredLanguage возвращает язык с наибольшим весом из заголовка Accept-Language.
+// При равных весах выигрывает указанный раньше
+func preferredLanguage(header string) string {
+	best, bestWeight := "", 0.0
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		tag := strings.ToLower(strings.TrimSpace(parts[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		weight := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+				weight = q
+			}
+		}
+		if weight > bestWeight {
+			best, bestWeight = tag, weight
+		}
+	}
+	return best
+}
+
+// LinkTargeting возвращает правила выбора адреса назначения ссылки linkID пользователя uid
+func (s *Service) LinkTargeting(ctx context.Context, uid string, linkID string) ([]entity.TargetRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	linkEntity, err := s.accessibleLink(ctx, uid, linkID, accessView)
+	if err != nil {
+		return nil, err
+	}
+	return linkEntity.Targeting, nil
+}
@@ -0,0 +1,99 @@
+package shortener
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/useragent"
+)
+
+// countries определение страны по IP-адресу для тестов
+type countries map[string]string
+
+func (c countries) Country(ip net.IP) (string, error) {
+	return c[ip.String()], nil
+}
+
+func TestService_TargetURL(t *testing.T) {
+	s := NewService("http://localhost:8080", WithCountryResolver(countries{"5.255.255.5": "RU"}))
+	linkEntity := entity.NewLinkEntity("https://example.com", "user1")
+	require.NoError(t, s.SetTargeting(&linkEntity, []entity.TargetRule{
+		{Platforms: []string{"iOS"}, URL: "https://apps.apple.com/app/id1"},
+		{Platforms: []string{"android"}, Devices: []string{"mobile"}, URL: "https://play.google.com/store/apps/details?id=app"},
+		{Languages: []string{"ru"}, Countries: []string{"ru"}, URL: "https://example.ru"},
+	}))
+	assert.Equal(t, []string{"ios"}, linkEntity.Targeting[0].Platforms)
+	assert.Equal(t, []string{"RU"}, linkEntity.Targeting[2].Countries)
+
+	tests := []struct {
+		name    string
+		visitor Visitor
+		want    string
+	}{
+		{
+			name:    "ios",
+			visitor: Visitor{Platform: useragent.PlatformIOS, Device: useragent.DeviceTablet},
+			want:    "https://apps.apple.com/app/id1",
+		},
+		{
+			name:    "android phone",
+			visitor: Visitor{Platform: useragent.PlatformAndroid, Device: useragent.DeviceMobile},
+			want:    "https://play.google.com/store/apps/details?id=app",
+		},
+		{
+			name:    "android tablet falls back",
+			visitor: Visitor{Platform: useragent.PlatformAndroid, Device: useragent.DeviceTablet},
+			want:    "https://example.com",
+		},
+		{
+			name:    "language and country",
+			visitor: s.NewVisitor("Mozilla/5.0 (X11; Linux x86_64)", "en;q=0.5, ru-RU", net.ParseIP("5.255.255.5")),
+			want:    "https://example.ru",
+		},
+		{
+			name:    "unknown country",
+			visitor: s.NewVisitor("", "ru", net.ParseIP("198.51.100.1")),
+			want:    "https://example.com",
+		},
+		{
+			name: "unknown visitor",
+			want: "https://example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, s.TargetURL(linkEntity, tt.visitor))
+		})
+	}
+}
+
+func TestService_SetTargeting(t *testing.T) {
+	s := NewService("http://localhost:8080")
+	linkEntity := entity.NewLinkEntity("https://example.com", "user1")
+
+	for _, rules := range [][]entity.TargetRule{
+		{{Platforms: []string{"ios"}, URL: "not a url"}},
+		{{URL: "https://example.org"}},
+		{{Platforms: []string{"symbian"}, URL: "https://example.org"}},
+		{{Devices: []string{"watch"}, URL: "https://example.org"}},
+		{{Countries: []string{"RUS"}, URL: "https://example.org"}},
+	} {
+		assert.ErrorIs(t, s.SetTargeting(&linkEntity, rules), ErrInvalidTargeting)
+	}
+	assert.Nil(t, linkEntity.Targeting)
+
+	require.NoError(t, s.SetTargeting(&linkEntity, []entity.TargetRule{{Devices: []string{"desktop"}, URL: "https://example.org"}}))
+	assert.True(t, linkEntity.IsTargeted())
+	require.NoError(t, s.SetTargeting(&linkEntity, nil))
+	assert.False(t, linkEntity.IsTargeted())
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	assert.Equal(t, "ru-ru", preferredLanguage("ru-RU,ru;q=0.9,en-US;q=0.8"))
+	assert.Equal(t, "en", preferredLanguage("de;q=0.3, en;q=0.7, *;q=0.9"))
+	assert.Equal(t, "", preferredLanguage("fr;q=0"))
+	assert.Equal(t, "", preferredLanguage(""))
+}
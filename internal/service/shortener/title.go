@@ -0,0 +1,26 @@
+package shortener
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+// maxTitleLength максимальная длина названия ссылки в символах
+const maxTitleLength = 200
+
+// ErrTitleTooLong название ссылки длиннее допустимого
+var ErrTitleTooLong = fmt.Errorf("title must be at most %d characters", maxTitleLength)
+
+// SetTitle задает название ссылки для страницы предпросмотра. Пробелы по краям отбрасываются,
+// пустое название снимает его
+func (s *Service) SetTitle(linkEntity *entity.LinkEntity, title string) error {
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return ErrTitleTooLong
+	}
+	linkEntity.Title = title
+	return nil
+}
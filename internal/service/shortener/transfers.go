@@ -0,0 +1,116 @@
+package shortener
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/random"
+)
+
+const (
+	// transferTokenSize сколько случайных байт в токене передачи ссылок
+	transferTokenSize = 32
+	// transferTTL сколько действует токен передачи ссылок
+	transferTTL = 24 * time.Hour
+	// maxTransferLinks сколько ссылок можно перечислить в одной передаче
+	maxTransferLinks = 1000
+)
+
+// ErrInvalidTransfer передача ссылок задана неверно: слишком много ссылок
+// или среди них есть ссылки, которые пользователь не может передать
+var ErrInvalidTransfer = errors.New("invalid transfer")
+
+// CreateTransfer создает одноразовый токен, по которому другой пользователь получит ссылки linkIDs
+// пользователя uid. Пустой linkIDs передает все личные ссылки пользователя на момент создания токена:
+// их список сохраняется в передаче, и ссылки, созданные позже, по токену не уходят.
+// Передать можно только свои не удаленные личные ссылки. Токен возвращается один раз, хранится только его хеш
+func (s *Service) CreateTransfer(ctx context.Context, uid string, linkIDs []string) (string, entity.Transfer, error) {
+	if len(linkIDs) > maxTransferLinks {
+		return "", entity.Transfer{}, fmt.Errorf("%w: no more than %d links", ErrInvalidTransfer, maxTransferLinks)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	unique := make([]string, 0, len(linkIDs))
+	if len(linkIDs) == 0 {
+		// список берется сейчас, иначе по токену ушли бы и ссылки, созданные после его выдачи
+		page, err := s.linksRepository.FindLinksByUID(ctx, uid, repository.LinkListOptions{})
+		if err != nil {
+			return "", entity.Transfer{}, err
+		}
+		if len(page.Links) == 0 {
+			return "", entity.Transfer{}, fmt.Errorf("%w: no links to transfer", ErrInvalidTransfer)
+		}
+		for _, e := range page.Links {
+			unique = append(unique, e.ID)
+		}
+	}
+	seen := make(map[string]bool, len(linkIDs))
+	for _, linkID := range linkIDs {
+		if seen[linkID] {
+			continue
+		}
+		seen[linkID] = true
+		linkEntity, err := s.linksRepository.Get(ctx, linkID)
+		if err != nil && !errors.Is(err, repository.ErrLinkNotFound) {
+			return "", entity.Transfer{}, err
+		}
+		// чужие и несуществующие ссылки неотличимы, чтобы не раскрывать чужие идентификаторы
+		if err != nil || !linkEntity.IsOwnedByUserAndExists(uid) || !linkEntity.IsPersonal() {
+			return "", entity.Transfer{}, fmt.Errorf("%w: link '%s' can't be transferred", ErrInvalidTransfer, linkID)
+		}
+		unique = append(unique, linkID)
+	}
+
+	token, err := random.Token(transferTokenSize)
+	if err != nil {
+		return "", entity.Transfer{}, err
+	}
+	now := time.Now().UTC()
+	transfer := entity.Transfer{
+		TokenHash: hashToken(token),
+		FromUID:   uid,
+		CreatedAt: now,
+		ExpiresAt: now.Add(transferTTL),
+		LinkIDs:   unique,
+	}
+	if err = s.linksRepository.PutTransfer(ctx, transfer); err != nil {
+		return "", entity.Transfer{}, err
+	}
+	log.Info().Str("audit", "transfer_created").Str("from_uid", uid).Strs("ids", transfer.LinkIDs).
+		Time("expires_at", transfer.ExpiresAt).Msg("link transfer token created")
+	return token, transfer, nil
+}
+
+// RedeemTransfer передает пользователю uid ссылки по токену передачи. Токен действует один раз.
+// Возвращает использованную передачу со списком перешедших ссылок. Ошибки хранилища - как в
+// repository.LinksRepository.RedeemTransfer. Каждая попытка использовать токен записывается в журнал
+func (s *Service) RedeemTransfer(ctx context.Context, uid string, token string) (entity.Transfer, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	transfer, err := s.linksRepository.RedeemTransfer(ctx, hashToken(token), uid, time.Now())
+	if err != nil {
+		log.Warn().Str("audit", "transfer_rejected").Str("to_uid", uid).Err(err).Msg("link transfer token rejected")
+		return entity.Transfer{}, err
+	}
+	// в кеше ссылки остались бы с прежним владельцем
+	s.linkCache.invalidate(transfer.TransferredIDs...)
+	log.Info().Str("audit", "transfer_redeemed").Str("from_uid", transfer.FromUID).Str("to_uid", uid).
+		Strs("ids", transfer.TransferredIDs).Msg("links transferred")
+	return transfer, nil
+}
+
+// hashToken хеш токена, под которым он хранится. Токены случайные и длинные, поэтому соль не нужна
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,99 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/app/config"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/service/quota"
+)
+
+func TestService_Transfer(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryLinksRepository(ctx, nil, repository.WithDedupScope(config.DedupPerUser))
+	s := NewService("http://localhost:8080", WithRepository(repo))
+
+	first, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/1", "old"))
+	require.NoError(t, err)
+	second, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/2", "old"))
+	require.NoError(t, err)
+	kept, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/3", "old"))
+	require.NoError(t, err)
+	foreign, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/4", "other"))
+	require.NoError(t, err)
+	// у получателя уже есть такая же ссылка, дубликат остается у создателя токена
+	_, err = s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/2", "new"))
+	require.NoError(t, err)
+
+	_, _, err = s.CreateTransfer(ctx, "old", []string{first.ID, foreign.ID})
+	assert.ErrorIs(t, err, ErrInvalidTransfer)
+	_, _, err = s.CreateTransfer(ctx, "old", []string{"missing"})
+	assert.ErrorIs(t, err, ErrInvalidTransfer)
+
+	token, transfer, err := s.CreateTransfer(ctx, "old", []string{first.ID, second.ID, first.ID})
+	require.NoError(t, err)
+	assert.Equal(t, []string{first.ID, second.ID}, transfer.LinkIDs)
+	assert.NotContains(t, transfer.TokenHash, token, "only the token hash is stored")
+
+	_, err = s.RedeemTransfer(ctx, "old", token)
+	assert.ErrorIs(t, err, repository.ErrTransferToSelf)
+	_, err = s.RedeemTransfer(ctx, "new", "wrong")
+	assert.ErrorIs(t, err, repository.ErrTransferNotFound)
+
+	redeemed, err := s.RedeemTransfer(ctx, "new", token)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first.ID}, redeemed.TransferredIDs)
+	assert.Equal(t, "new", redeemed.ToUID)
+	_, err = s.RedeemTransfer(ctx, "third", token)
+	assert.ErrorIs(t, err, repository.ErrTransferUnavailable, "token is one-time")
+
+	moved, err := s.Get(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new", moved.UID)
+	links, _, err := s.GetUserLinks(ctx, "old", ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+
+	// пустой список передает все личные ссылки на момент создания токена
+	token, transfer, err = s.CreateTransfer(ctx, "old", nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{second.ID, kept.ID}, transfer.LinkIDs)
+	later, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/later", "old"))
+	require.NoError(t, err)
+	redeemed, err = s.RedeemTransfer(ctx, "third", token)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{second.ID, kept.ID}, redeemed.TransferredIDs)
+	stored, err := s.linksRepository.Get(ctx, later.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "old", stored.UID, "links created after the token stay with the creator")
+
+	_, _, err = s.CreateTransfer(ctx, "nobody", nil)
+	assert.ErrorIs(t, err, ErrInvalidTransfer)
+}
+
+func TestService_TransferQuota(t *testing.T) {
+	ctx := context.Background()
+	quotas := quota.New(quota.Limits{MaxLinks: 1}, nil)
+	repo := repository.NewInMemoryLinksRepository(ctx, nil, repository.WithLinksQuota(quotas))
+	s := NewService("http://localhost:8080", WithRepository(repo))
+
+	_, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/old", "old"))
+	require.NoError(t, err)
+	_, err = s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/new", "new"))
+	require.NoError(t, err)
+
+	token, _, err := s.CreateTransfer(ctx, "old", nil)
+	require.NoError(t, err)
+	_, err = s.RedeemTransfer(ctx, "new", token)
+	assert.ErrorIs(t, err, repository.ErrQuotaExceeded)
+
+	// отказ по квоте не расходует токен
+	redeemed, err := s.RedeemTransfer(ctx, "empty", token)
+	require.NoError(t, err)
+	assert.Len(t, redeemed.TransferredIDs, 1)
+	assert.WithinDuration(t, time.Now(), *redeemed.RedeemedAt, time.Second)
+}
@@ -0,0 +1,176 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+// ErrNotLinkOwner ссылку пытается изменить не ее владелец
+var ErrNotLinkOwner = errors.New("link is owned by another user")
+
+// LinkUpdate изменения ссылки. Поля со значением nil не меняются
+type LinkUpdate struct {
+	// OriginalURL новый адрес ссылки
+	OriginalURL *string
+	// Password новый пароль ссылки. Пустая строка снимает пароль
+	Password *string
+	// MaxClicks новое ограничение количества переходов. 0 снимает ограничение
+	MaxClicks *int
+	// Title новое название ссылки. Пустая строка снимает название
+	Title *string
+	// Notes новые заметки к ссылке. Пустая строка снимает заметки
+	Notes *string
+	// Tags новые теги ссылки целиком. Пустой список снимает теги
+	Tags *[]string
+	// GroupID новая группа ссылки. Пустая строка убирает ссылку из группы
+	GroupID *string
+	// Interstitial показывать ли перед переходом страницу с адресом назначения
+	Interstitial *bool
+	// RedirectCode новый код ответа при переходе. 0 - код по умолчанию
+	RedirectCode *int
+	// PassQuery добавлять ли к адресу назначения параметры запроса
+	PassQuery *bool
+	// PassPath добавлять ли к адресу назначения путь после короткой ссылки
+	PassPath *bool
+	// QueryMerge новое правило объединения параметров. Пустая строка - правило по умолчанию
+	QueryMerge *string
+	// UTM новая разметка целиком. Пустая разметка снимает ее
+	UTM *entity.UTMParams
+	// Targeting новые правила выбора адреса назначения целиком. Пустой список снимает правила
+	Targeting *[]entity.TargetRule
+	// Variants новые варианты адреса назначения целиком. Пустой список снимает эксперимент
+	Variants *[]entity.Variant
+	// Schedule новое окно работы ссылки целиком
+	Schedule *Schedule
+}
+
+// UpdateLink изменяет ссылку linkID пользователя uid. Новый адрес проверяется так же, как при сокращении.
+// Ссылку пространства может изменить его редактор или владелец.
+// Возвращает repository.ErrLinkNotFound, если ссылки нет или она удалена, ErrNotLinkOwner, если ссылка чужая,
+// ErrInsufficientRole, если роли в пространстве не хватает, и *repository.LinkExistsError, если новый адрес дублирует другую ссылку
+func (s *Service) UpdateLink(ctx context.Context, uid string, linkID string, update LinkUpdate) (entity.LinkEntity, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	linkEntity, err := s.accessibleLink(ctx, uid, linkID, accessEdit)
+	if err != nil {
+		return entity.LinkEntity{}, err
+	}
+
+	if update.OriginalURL != nil {
+		if err = s.ValidateURL(*update.OriginalURL); err != nil {
+			return entity.LinkEntity{}, err
+		}
+		linkEntity.OriginalURL = *update.OriginalURL
+	}
+	// каноническая форма пересчитывается всегда: у защищенных ссылок ее может не быть в хранилище
+	linkEntity.CanonicalURL = s.canonicalURL(linkEntity.OriginalURL)
+	if update.Password != nil {
+		linkEntity.PasswordHash = ""
+		if err = s.ProtectLink(&linkEntity, *update.Password); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.MaxClicks != nil {
+		if err = s.LimitClicks(&linkEntity, *update.MaxClicks); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.Title != nil {
+		if err = s.SetTitle(&linkEntity, *update.Title); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.Notes != nil {
+		if err = s.SetNotes(&linkEntity, *update.Notes); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.Tags != nil {
+		if err = s.SetTags(&linkEntity, *update.Tags); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.GroupID != nil {
+		if err = s.SetGroup(ctx, &linkEntity, *update.GroupID); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.Interstitial != nil {
+		linkEntity.Interstitial = *update.Interstitial
+	}
+	if update.RedirectCode != nil {
+		if err = s.SetRedirectCode(&linkEntity, *update.RedirectCode); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.PassQuery != nil {
+		linkEntity.PassQuery = *update.PassQuery
+	}
+	if update.PassPath != nil {
+		linkEntity.PassPath = *update.PassPath
+	}
+	if update.QueryMerge != nil {
+		if err = s.SetQueryMerge(&linkEntity, *update.QueryMerge); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.UTM != nil {
+		if err = s.SetUTM(&linkEntity, *update.UTM); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.Targeting != nil {
+		if err = s.SetTargeting(&linkEntity, *update.Targeting); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.Variants != nil {
+		if err = s.SetVariants(&linkEntity, *update.Variants); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+	if update.Schedule != nil {
+		if err = s.SetSchedule(&linkEntity, *update.Schedule); err != nil {
+			return entity.LinkEntity{}, err
+		}
+	}
+
+	updated, err := s.linksRepository.UpdateLink(ctx, linkEntity)
+	if err != nil {
+		return entity.LinkEntity{}, err
+	}
+	s.linkCache.invalidate(linkID)
+	return updated, nil
+}
+
+// LinkRevisions возвращает историю адресов ссылки linkID пользователя uid, от старых к новым
+func (s *Service) LinkRevisions(ctx context.Context, uid string, linkID string) ([]entity.LinkRevision, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if _, err := s.accessibleLink(ctx, uid, linkID, accessView); err != nil {
+		return nil, err
+	}
+	return s.linksRepository.FindLinkRevisions(ctx, linkID)
+}
+
+// accessibleLink возвращает из хранилища, минуя кеш, не удаленную ссылку, если пользователю uid разрешен доступ need
+func (s *Service) accessibleLink(ctx context.Context, uid string, linkID string, need access) (entity.LinkEntity, error) {
+	linkEntity, err := s.linksRepository.Get(ctx, linkID)
+	if err != nil {
+		return entity.LinkEntity{}, err
+	}
+	if linkEntity.Removed {
+		return entity.LinkEntity{}, fmt.Errorf("link with id '%s' was removed: %w", linkID, repository.ErrLinkNotFound)
+	}
+	if err = s.authorize(ctx, uid, *linkEntity, need); err != nil {
+		return entity.LinkEntity{}, err
+	}
+	return *linkEntity, nil
+}
@@ -0,0 +1,49 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+const (
+	// maxUTMExtra максимальное количество дополнительных параметров разметки
+	maxUTMExtra = 20
+	// maxUTMValueLength максимальная длина имени и значения параметра разметки
+	maxUTMValueLength = 256
+)
+
+// ErrInvalidUTM разметка ссылки не прошла проверку
+var ErrInvalidUTM = errors.New("invalid utm params")
+
+// SetUTM задает разметку, которая добавляется к адресу назначения при переходе. Пустая разметка снимает ее
+func (s *Service) SetUTM(linkEntity *entity.LinkEntity, utm entity.UTMParams) error {
+	if utm.IsZero() {
+		linkEntity.UTM = nil
+		return nil
+	}
+	if len(utm.Extra) > maxUTMExtra {
+		return fmt.Errorf("%w: at most %d extra params allowed", ErrInvalidUTM, maxUTMExtra)
+	}
+	for key, values := range utm.Values() {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%w: empty param name", ErrInvalidUTM)
+		}
+		if len(key) > maxUTMValueLength || len(values[0]) > maxUTMValueLength {
+			return fmt.Errorf("%w: param '%.32s' is longer than %d bytes", ErrInvalidUTM, key, maxUTMValueLength)
+		}
+	}
+	// копия, чтобы ссылка не делила карту параметров с вызывающим кодом
+	extra := make(map[string]string, len(utm.Extra))
+	for key, value := range utm.Extra {
+		extra[key] = value
+	}
+	if len(extra) == 0 {
+		extra = nil
+	}
+	utm.Extra = extra
+	linkEntity.UTM = &utm
+	return nil
+}
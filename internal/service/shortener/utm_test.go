@@ -0,0 +1,40 @@
+package shortener
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+func TestService_SetUTM(t *testing.T) {
+	s := NewService("http://localhost:8080")
+	linkEntity := entity.NewLinkEntity("https://ya.ru/a?utm_source=old&x=1", "user1")
+
+	extra := map[string]string{"ref": "footer"}
+	require.NoError(t, s.SetUTM(&linkEntity, entity.UTMParams{Source: "mail", Campaign: "spring", Extra: extra}))
+	extra["ref"] = "changed"
+	assert.Equal(t, "footer", linkEntity.UTM.Extra["ref"])
+
+	// разметка заменяет одноименные параметры адреса, остальные параметры сохраняются
+	got, err := s.Destination(linkEntity, Visitor{}, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru/a?x=1&ref=footer&utm_campaign=spring&utm_source=mail", got)
+
+	// параметры запроса не перекрывают разметку при правиле по умолчанию
+	linkEntity.PassQuery = true
+	got, err = s.Destination(linkEntity, Visitor{}, "", url.Values{"utm_source": {"spam"}, "q": {"1"}})
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru/a?x=1&ref=footer&utm_campaign=spring&utm_source=mail&q=1", got)
+
+	err = s.SetUTM(&linkEntity, entity.UTMParams{Medium: strings.Repeat("a", maxUTMValueLength+1)})
+	assert.ErrorIs(t, err, ErrInvalidUTM)
+	err = s.SetUTM(&linkEntity, entity.UTMParams{Extra: map[string]string{" ": "x"}})
+	assert.ErrorIs(t, err, ErrInvalidUTM)
+
+	require.NoError(t, s.SetUTM(&linkEntity, entity.UTMParams{}))
+	assert.Nil(t, linkEntity.UTM)
+}
@@ -0,0 +1,196 @@
+package shortener
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/zaz600/go-musthave-shortener/internal/service/policy"
+)
+
+// InvalidURLReason машиночитаемая причина, по которой ссылка не прошла проверку
+type InvalidURLReason string
+
+const (
+	ReasonEmpty            InvalidURLReason = "empty"
+	ReasonTooLong          InvalidURLReason = "too_long"
+	ReasonMalformed        InvalidURLReason = "malformed"
+	ReasonSchemeNotAllowed InvalidURLReason = "scheme_not_allowed"
+	ReasonHostRequired     InvalidURLReason = "host_required"
+	ReasonPrivateAddress   InvalidURLReason = "private_address"
+	ReasonRedirectLoop     InvalidURLReason = "redirect_loop"
+	ReasonHostBlocked      InvalidURLReason = InvalidURLReason(policy.ReasonBlocked)
+	ReasonHostNotAllowed   InvalidURLReason = InvalidURLReason(policy.ReasonNotAllowed)
+)
+
+// InvalidURLError ссылка не прошла проверку URLPolicy
+type InvalidURLError struct {
+	// Reason причина отказа
+	Reason InvalidURLReason
+	// Message описание причины для человека
+	Message string
+}
+
+func newInvalidURLError(reason InvalidURLReason, format string, args ...interface{}) *InvalidURLError {
+	return &InvalidURLError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *InvalidURLError) Error() string {
+	return fmt.Sprintf("invalid url: %s (%s)", e.Message, e.Reason)
+}
+
+// URLPolicy правила проверки ссылок перед сокращением
+type URLPolicy struct {
+	// AllowedSchemes допустимые схемы ссылок. Пустой список разрешает любую схему
+	AllowedSchemes []string
+	// MaxLength максимальная длина ссылки. 0 - без ограничений
+	MaxLength int
+	// RequireHost ссылка обязана содержать хост
+	RequireHost bool
+	// DenyPrivateAddresses запрещает ссылки на localhost, loopback, приватные и link-local адреса.
+	// Проверяются только хосты, заданные IP-адресом, DNS-имена не резолвятся
+	DenyPrivateAddresses bool
+	// DenySelfLinks запрещает ссылки на сам сервис, т.к. они приводят к петле редиректов
+	DenySelfLinks bool
+}
+
+// DefaultURLPolicy политика проверки ссылок по умолчанию
+func DefaultURLPolicy() URLPolicy {
+	return URLPolicy{
+		AllowedSchemes:       []string{"http", "https"},
+		MaxLength:            2048,
+		RequireHost:          true,
+		DenyPrivateAddresses: true,
+		DenySelfLinks:        true,
+	}
+}
+
+// Validate проверяет ссылку rawURL. selfURL - базовый адрес сервиса, ссылки на него считаются петлей.
+// Возвращает *InvalidURLError, если ссылка не прошла проверку.
+func (p URLPolicy) Validate(rawURL string, selfURL string) error {
+	if strings.TrimSpace(rawURL) == "" {
+		return newInvalidURLError(ReasonEmpty, "url is empty")
+	}
+	if p.MaxLength > 0 && len(rawURL) > p.MaxLength {
+		return newInvalidURLError(ReasonTooLong, "url is longer than %d bytes", p.MaxLength)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return newInvalidURLError(ReasonMalformed, "url can't be parsed")
+	}
+	if !p.isSchemeAllowed(u.Scheme) {
+		return newInvalidURLError(ReasonSchemeNotAllowed, "scheme '%s' is not allowed", u.Scheme)
+	}
+	if p.RequireHost && u.Hostname() == "" {
+		return newInvalidURLError(ReasonHostRequired, "url must contain host")
+	}
+	if ip, numeric := parseIPv4(u.Hostname()); numeric && ip == nil {
+		// браузеры не откроют такой адрес, а системный резолвер может понять его по-своему
+		return newInvalidURLError(ReasonMalformed, "host '%s' is not a valid ip address", u.Hostname())
+	}
+	if p.DenyPrivateAddresses && isPrivateHost(u.Hostname()) {
+		return newInvalidURLError(ReasonPrivateAddress, "host '%s' is a private address", u.Hostname())
+	}
+	if p.DenySelfLinks && isSameHost(u, selfURL) {
+		return newInvalidURLError(ReasonRedirectLoop, "url points to the shortener itself")
+	}
+	return nil
+}
+
+func (p URLPolicy) isSchemeAllowed(scheme string) bool {
+	if len(p.AllowedSchemes) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedSchemes {
+		if strings.EqualFold(allowed, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrivateHost возвращает true для localhost и IP-адресов, не доступных из интернета,
+// в том числе записанных в сокращенной или числовой форме, например 127.1 или 2130706433
+func isPrivateHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip, numeric := parseIPv4(host)
+	if !numeric {
+		ip = net.ParseIP(host)
+	}
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+}
+
+// parseIPv4 разбирает IPv4 адрес во всех формах, которые понимают inet_aton и браузеры:
+// 127.0.0.1, 127.1, 2130706433, 0x7f.1, 0177.0.0.1.
+// numeric - хост заканчивается числом, то есть считается IPv4 адресом, а не доменом.
+// ip - nil, если такой адрес некорректен
+func parseIPv4(host string) (ip net.IP, numeric bool) {
+	parts := strings.Split(host, ".")
+	if _, ok := parseIPv4Part(parts[len(parts)-1]); !ok {
+		return nil, false
+	}
+	if len(parts) > net.IPv4len {
+		return nil, true
+	}
+	var addr uint64
+	for i, part := range parts {
+		value, ok := parseIPv4Part(part)
+		if !ok {
+			return nil, true
+		}
+		// последняя часть заполняет все оставшиеся байты адреса: 127.1 - это 127.0.0.1
+		bits := uint(8)
+		if i == len(parts)-1 {
+			bits = uint(8 * (net.IPv4len - i))
+		}
+		if value >= 1<<bits {
+			return nil, true
+		}
+		addr = addr<<bits | value
+	}
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr)), true
+}
+
+// parseIPv4Part разбирает часть IPv4 адреса: десятичное число, восьмеричное с ведущим 0 или шестнадцатеричное с 0x
+func parseIPv4Part(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(part) > 1 && (strings.HasPrefix(part, "0x") || strings.HasPrefix(part, "0X")):
+		part, base = part[2:], 16
+		if part == "" {
+			return 0, true
+		}
+	case len(part) > 1 && strings.HasPrefix(part, "0"):
+		part, base = part[1:], 8
+	}
+	value, err := strconv.ParseUint(part, base, 32)
+	return value, err == nil
+}
+
+// isSameHost возвращает true, если ссылка u указывает на хост и порт selfURL
+func isSameHost(u *url.URL, selfURL string) bool {
+	self, err := url.Parse(selfURL)
+	if err != nil || self.Hostname() == "" {
+		return false
+	}
+	return strings.EqualFold(u.Hostname(), self.Hostname()) &&
+		effectivePort(u) == effectivePort(self)
+}
+
+// effectivePort возвращает порт ссылки с учетом порта по умолчанию для схемы
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return defaultPorts[strings.ToLower(u.Scheme)]
+}
@@ -0,0 +1,55 @@
+package shortener
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLPolicy_Validate(t *testing.T) {
+	selfURL := "http://short.example:8080"
+	tests := []struct {
+		name   string
+		policy URLPolicy
+		url    string
+		want   InvalidURLReason
+	}{
+		{name: "valid", policy: DefaultURLPolicy(), url: "https://ya.ru/?q=1"},
+		{name: "empty", policy: DefaultURLPolicy(), url: " ", want: ReasonEmpty},
+		{name: "too long", policy: DefaultURLPolicy(), url: "https://ya.ru/" + strings.Repeat("a", 2048), want: ReasonTooLong},
+		{name: "malformed", policy: DefaultURLPolicy(), url: "http://ya.ru/%zz", want: ReasonMalformed},
+		{name: "javascript", policy: DefaultURLPolicy(), url: "javascript:alert(1)", want: ReasonSchemeNotAllowed},
+		{name: "scheme case", policy: DefaultURLPolicy(), url: "HTTPS://ya.ru"},
+		{name: "bare word", policy: DefaultURLPolicy(), url: "ya.ru", want: ReasonSchemeNotAllowed},
+		{name: "bare word any scheme", policy: URLPolicy{RequireHost: true}, url: "ya.ru", want: ReasonHostRequired},
+		{name: "localhost", policy: DefaultURLPolicy(), url: "http://LocalHost:3000", want: ReasonPrivateAddress},
+		{name: "loopback v6", policy: DefaultURLPolicy(), url: "http://[::1]/", want: ReasonPrivateAddress},
+		{name: "link local", policy: DefaultURLPolicy(), url: "http://169.254.169.254/latest", want: ReasonPrivateAddress},
+		{name: "decimal loopback", policy: DefaultURLPolicy(), url: "http://2130706433/", want: ReasonPrivateAddress},
+		{name: "hex loopback", policy: DefaultURLPolicy(), url: "http://0x7f.1/", want: ReasonPrivateAddress},
+		{name: "short loopback", policy: DefaultURLPolicy(), url: "http://127.1/", want: ReasonPrivateAddress},
+		{name: "octal private", policy: DefaultURLPolicy(), url: "http://012.0.0.1/", want: ReasonPrivateAddress},
+		{name: "invalid numeric", policy: DefaultURLPolicy(), url: "http://1.2.3.256/", want: ReasonMalformed},
+		{name: "numeric public", policy: DefaultURLPolicy(), url: "http://134744072/"},
+		{name: "numeric label", policy: DefaultURLPolicy(), url: "http://1.ya.ru/"},
+		{name: "private allowed", policy: URLPolicy{}, url: "http://10.0.0.1/"},
+		{name: "self", policy: DefaultURLPolicy(), url: "http://SHORT.example:8080/abc", want: ReasonRedirectLoop},
+		{name: "self other port", policy: DefaultURLPolicy(), url: "http://short.example/abc"},
+		{name: "self allowed", policy: URLPolicy{}, url: "http://short.example:8080/abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.url, selfURL)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var invalidURLErr *InvalidURLError
+			require.True(t, errors.As(err, &invalidURLErr))
+			assert.Equal(t, tt.want, invalidURLErr.Reason)
+		})
+	}
+}
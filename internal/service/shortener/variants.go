@@ -0,0 +1,101 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"time"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+)
+
+const (
+	// maxVariants максимальное количество вариантов адреса назначения у одной ссылки
+	maxVariants = 10
+	// maxVariantWeight максимальный вес варианта
+	maxVariantWeight = 1000
+)
+
+// variantNameRe допустимые имена вариантов: имя попадает в cookie и статистику
+var variantNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ErrInvalidVariants варианты адреса назначения не прошли проверку
+var ErrInvalidVariants = errors.New("invalid variants")
+
+// SetVariants задает варианты адреса назначения для A/B эксперимента. Адреса вариантов проверяются так же,
+// как при сокращении. Пустой список снимает эксперимент, статистика переходов по вариантам сохраняется
+func (s *Service) SetVariants(linkEntity *entity.LinkEntity, variants []entity.Variant) error {
+	if len(variants) == 0 {
+		linkEntity.Variants = nil
+		return nil
+	}
+	if len(variants) < 2 || len(variants) > maxVariants {
+		return fmt.Errorf("%w: from 2 to %d variants allowed", ErrInvalidVariants, maxVariants)
+	}
+
+	names := make(map[string]bool, len(variants))
+	totalWeight := 0
+	for _, variant := range variants {
+		if !variantNameRe.MatchString(variant.Name) {
+			return fmt.Errorf("%w: name '%.32s' must be 1-32 latin letters, digits, '-' or '_'", ErrInvalidVariants, variant.Name)
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("%w: duplicate name '%s'", ErrInvalidVariants, variant.Name)
+		}
+		names[variant.Name] = true
+		if variant.Weight < 0 || variant.Weight > maxVariantWeight {
+			return fmt.Errorf("%w: variant '%s' weight must be between 0 and %d", ErrInvalidVariants, variant.Name, maxVariantWeight)
+		}
+		totalWeight += variant.Weight
+		if err := s.ValidateURL(variant.URL); err != nil {
+			return fmt.Errorf("%w: variant '%s': %s", ErrInvalidVariants, variant.Name, err.Error())
+		}
+	}
+	if totalWeight == 0 {
+		return fmt.Errorf("%w: at least one variant must have positive weight", ErrInvalidVariants)
+	}
+	linkEntity.Variants = append([]entity.Variant(nil), variants...)
+	return nil
+}
+
+// Variant возвращает вариант адреса назначения для посетителя. Посетитель получает вариант,
+// выбранный ему раньше, если такой вариант еще есть и его вес не нулевой. Иначе вариант выбирается по весам,
+// детерминированно по ссылке и идентификатору посетителя. Возвращает false, если у ссылки нет вариантов
+// или посетителю подошло правило Targeting
+func (s *Service) Variant(linkEntity entity.LinkEntity, visitor Visitor) (entity.Variant, bool) {
+	if len(linkEntity.Variants) == 0 {
+		return entity.Variant{}, false
+	}
+	if _, ok := matchTargetRule(linkEntity, visitor); ok {
+		return entity.Variant{}, false
+	}
+
+	totalWeight := 0
+	for _, variant := range linkEntity.Variants {
+		if variant.Name == visitor.Variant && variant.Weight > 0 {
+			return variant, true
+		}
+		totalWeight += variant.Weight
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(linkEntity.ID + "\x00" + visitor.ID))
+	point := int(h.Sum64() % uint64(totalWeight))
+	for _, variant := range linkEntity.Variants {
+		if point < variant.Weight {
+			return variant, true
+		}
+		point -= variant.Weight
+	}
+	return linkEntity.Variants[len(linkEntity.Variants)-1], true
+}
+
+// CountVariantClick засчитывает переход по варианту variant ссылки linkID
+func (s *Service) CountVariantClick(ctx context.Context, linkID string, variant string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return s.linksRepository.AddVariantClick(ctx, linkID, variant)
+}
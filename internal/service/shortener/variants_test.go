@@ -0,0 +1,95 @@
+package shortener
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+	"github.com/zaz600/go-musthave-shortener/internal/pkg/useragent"
+)
+
+func TestService_SetVariants(t *testing.T) {
+	s := NewService("http://localhost:8080")
+	linkEntity := entity.NewLinkEntity("https://example.com", "user1")
+
+	for name, variants := range map[string][]entity.Variant{
+		"single":       {{Name: "a", URL: "https://example.com/a", Weight: 1}},
+		"invalid name": {{Name: "a b", URL: "https://example.com/a", Weight: 1}, {Name: "b", URL: "https://example.com/b", Weight: 1}},
+		"duplicate":    {{Name: "a", URL: "https://example.com/a", Weight: 1}, {Name: "a", URL: "https://example.com/b", Weight: 1}},
+		"weight":       {{Name: "a", URL: "https://example.com/a", Weight: -1}, {Name: "b", URL: "https://example.com/b", Weight: 1}},
+		"zero total":   {{Name: "a", URL: "https://example.com/a"}, {Name: "b", URL: "https://example.com/b"}},
+		"url":          {{Name: "a", URL: "example", Weight: 1}, {Name: "b", URL: "https://example.com/b", Weight: 1}},
+	} {
+		assert.ErrorIs(t, s.SetVariants(&linkEntity, variants), ErrInvalidVariants, name)
+	}
+	assert.Nil(t, linkEntity.Variants)
+
+	require.NoError(t, s.SetVariants(&linkEntity, []entity.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 1},
+		{Name: "b", URL: "https://example.com/b"},
+	}))
+	assert.True(t, linkEntity.IsTargeted())
+	require.NoError(t, s.SetVariants(&linkEntity, nil))
+	assert.False(t, linkEntity.IsTargeted())
+}
+
+func TestService_Variant(t *testing.T) {
+	s := NewService("http://localhost:8080")
+	linkEntity := entity.NewLinkEntity("https://example.com", "user1")
+	require.NoError(t, s.SetVariants(&linkEntity, []entity.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 3},
+		{Name: "b", URL: "https://example.com/b", Weight: 1},
+		{Name: "paused", URL: "https://example.com/c", Weight: 0},
+	}))
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		visitor := Visitor{ID: "visitor" + strconv.Itoa(i)}
+		variant, ok := s.Variant(linkEntity, visitor)
+		require.True(t, ok)
+		counts[variant.Name]++
+
+		// выбор повторяется для того же посетителя
+		again, _ := s.Variant(linkEntity, visitor)
+		assert.Equal(t, variant, again)
+	}
+	assert.InDelta(t, 3000, counts["a"], 200)
+	assert.InDelta(t, 1000, counts["b"], 200)
+	assert.Zero(t, counts["paused"])
+
+	// запомненный вариант важнее весов, но не вариант с нулевым весом
+	variant, _ := s.Variant(linkEntity, Visitor{ID: "visitor1", Variant: "b"})
+	assert.Equal(t, "b", variant.Name)
+	variant, _ = s.Variant(linkEntity, Visitor{ID: "visitor1", Variant: "paused"})
+	assert.NotEqual(t, "paused", variant.Name)
+
+	// подошедшее правило важнее вариантов
+	require.NoError(t, s.SetTargeting(&linkEntity, []entity.TargetRule{{Platforms: []string{"ios"}, URL: "https://apps.apple.com/app/id1"}}))
+	visitor := Visitor{ID: "visitor1", Platform: useragent.PlatformIOS}
+	_, ok := s.Variant(linkEntity, visitor)
+	assert.False(t, ok)
+	assert.Equal(t, "https://apps.apple.com/app/id1", s.TargetURL(linkEntity, visitor))
+}
+
+func TestService_CountVariantClick(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryLinksRepository(ctx, nil)
+	s := NewService("http://localhost:8080", WithRepository(repo))
+
+	linkEntity := s.NewLinkEntity("https://example.com", "user1")
+	linkEntity, err := repo.PutIfAbsent(ctx, linkEntity)
+	require.NoError(t, err)
+	require.NoError(t, s.CountVariantClick(ctx, linkEntity.ID, "a"))
+	require.NoError(t, s.CountVariantClick(ctx, linkEntity.ID, "a"))
+	require.NoError(t, s.CountVariantClick(ctx, linkEntity.ID, "b"))
+
+	stored, err := repo.Get(ctx, linkEntity.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 2, "b": 1}, stored.VariantClicks)
+
+	assert.ErrorIs(t, s.CountVariantClick(ctx, "missing", "a"), repository.ErrLinkNotFound)
+}
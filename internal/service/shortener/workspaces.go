@@ -0,0 +1,182 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+// maxWorkspaceNameLength максимальная длина названия рабочего пространства в символах
+const maxWorkspaceNameLength = 100
+
+var (
+	// ErrInvalidWorkspace рабочее пространство задано неверно: пустое или слишком длинное название,
+	// неизвестная роль участника или ссылку создают в пространстве, которого нет
+	ErrInvalidWorkspace = errors.New("invalid workspace")
+	// ErrInsufficientRole роли пользователя в рабочем пространстве не хватает для действия
+	ErrInsufficientRole = errors.New("insufficient workspace role")
+	// ErrLastOwner из пространства пытаются убрать последнего владельца
+	ErrLastOwner = repository.ErrLastOwner
+)
+
+// access доступ к ссылке, который проверяет authorize
+type access int
+
+const (
+	// accessView просмотр ссылки и ее статистики
+	accessView access = iota
+	// accessEdit изменение и удаление ссылки
+	accessEdit
+)
+
+// CreateWorkspace создает рабочее пространство. Создатель uid становится его владельцем.
+// Пробелы по краям названия отбрасываются
+func (s *Service) CreateWorkspace(ctx context.Context, uid string, name string) (entity.Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxWorkspaceNameLength {
+		return entity.Workspace{}, fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidWorkspace, maxWorkspaceNameLength)
+	}
+	now := time.Now().UTC()
+	workspace := entity.Workspace{Name: name, CreatedAt: now}
+	owner := entity.WorkspaceMember{UID: uid, Role: entity.RoleOwner, AddedAt: now}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	err := repository.PutWithFreeID(s.recordIDGenerator, func(id string) error {
+		workspace.ID, owner.WorkspaceID = id, id
+		return s.linksRepository.PutWorkspace(ctx, workspace, owner)
+	})
+	if err != nil {
+		return entity.Workspace{}, err
+	}
+	return workspace, nil
+}
+
+// UserWorkspaces возвращает пространства, в которых состоит пользователь uid, с его ролью, от старых к новым
+func (s *Service) UserWorkspaces(ctx context.Context, uid string) ([]entity.WorkspaceMembership, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	return s.linksRepository.FindWorkspacesByUID(ctx, uid)
+}
+
+// WorkspaceMembers возвращает участников пространства workspaceID. Список виден любому участнику.
+// Возвращает repository.ErrWorkspaceNotFound, если пространства нет, и ErrInsufficientRole,
+// если пользователь uid в нем не состоит
+func (s *Service) WorkspaceMembers(ctx context.Context, uid string, workspaceID string) ([]entity.WorkspaceMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if _, err := s.workspaceRole(ctx, uid, workspaceID, entity.Role.CanView); err != nil {
+		return nil, err
+	}
+	return s.linksRepository.FindWorkspaceMembers(ctx, workspaceID)
+}
+
+// SetWorkspaceMember добавляет пользователя memberUID в пространство с ролью role или меняет его роль.
+// Участниками управляет только владелец пространства. Последний владелец не может понизить себя
+func (s *Service) SetWorkspaceMember(ctx context.Context, uid string, workspaceID string, memberUID string, role entity.Role) (entity.WorkspaceMember, error) {
+	if memberUID == "" {
+		return entity.WorkspaceMember{}, fmt.Errorf("%w: member uid is empty", ErrInvalidWorkspace)
+	}
+	if !role.IsValid() {
+		return entity.WorkspaceMember{}, fmt.Errorf("%w: unknown role '%s'", ErrInvalidWorkspace, role)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if _, err := s.workspaceRole(ctx, uid, workspaceID, entity.Role.CanManage); err != nil {
+		return entity.WorkspaceMember{}, err
+	}
+	member := entity.WorkspaceMember{WorkspaceID: workspaceID, UID: memberUID, Role: role, AddedAt: time.Now().UTC()}
+	if err := s.linksRepository.PutWorkspaceMember(ctx, member); err != nil {
+		return entity.WorkspaceMember{}, err
+	}
+	return member, nil
+}
+
+// RemoveWorkspaceMember исключает пользователя memberUID из пространства. Исключать участников может владелец,
+// а уйти из пространства сам - любой участник, кроме последнего владельца.
+// Ссылки, созданные участником в пространстве, остаются в нем
+func (s *Service) RemoveWorkspaceMember(ctx context.Context, uid string, workspaceID string, memberUID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	canRemove := entity.Role.CanManage
+	if memberUID == uid {
+		canRemove = entity.Role.CanView
+	}
+	if _, err := s.workspaceRole(ctx, uid, workspaceID, canRemove); err != nil {
+		return err
+	}
+	return s.linksRepository.DeleteWorkspaceMember(ctx, workspaceID, memberUID)
+}
+
+// SetWorkspace переносит новую ссылку в пространство workspaceID. Создавать ссылки в пространстве может
+// его редактор или владелец. Пустой workspaceID оставляет ссылку личной
+func (s *Service) SetWorkspace(ctx context.Context, linkEntity *entity.LinkEntity, workspaceID string) error {
+	if workspaceID == "" {
+		linkEntity.WorkspaceID = ""
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	if _, err := s.workspaceRole(ctx, linkEntity.UID, workspaceID, entity.Role.CanEdit); err != nil {
+		if errors.Is(err, repository.ErrWorkspaceNotFound) {
+			return fmt.Errorf("%w: %s", ErrInvalidWorkspace, err.Error())
+		}
+		return err
+	}
+	linkEntity.WorkspaceID = workspaceID
+	return nil
+}
+
+// authorize проверяет, что пользователю uid разрешен доступ need к ссылке.
+// Личной ссылкой распоряжается только ее создатель, ссылкой пространства - его участники по своим ролям
+func (s *Service) authorize(ctx context.Context, uid string, linkEntity entity.LinkEntity, need access) error {
+	if linkEntity.IsPersonal() {
+		if !linkEntity.IsOwnedByUser(uid) {
+			return ErrNotLinkOwner
+		}
+		return nil
+	}
+	allowed := entity.Role.CanView
+	if need == accessEdit {
+		allowed = entity.Role.CanEdit
+	}
+	_, err := s.workspaceRole(ctx, uid, linkEntity.WorkspaceID, allowed)
+	if errors.Is(err, repository.ErrWorkspaceNotFound) {
+		return ErrNotLinkOwner
+	}
+	return err
+}
+
+// workspaceRole возвращает роль пользователя uid в пространстве workspaceID, если allowed ее допускает.
+// Возвращает repository.ErrWorkspaceNotFound, если пространства нет, и ErrInsufficientRole,
+// если пользователь в нем не состоит или его роли не хватает
+func (s *Service) workspaceRole(ctx context.Context, uid string, workspaceID string, allowed func(entity.Role) bool) (entity.Role, error) {
+	if _, err := s.linksRepository.GetWorkspace(ctx, workspaceID); err != nil {
+		return "", err
+	}
+	member, err := s.linksRepository.GetWorkspaceMember(ctx, workspaceID, uid)
+	if errors.Is(err, repository.ErrMemberNotFound) {
+		return "", fmt.Errorf("%w: not a member of workspace '%s'", ErrInsufficientRole, workspaceID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !allowed(member.Role) {
+		return "", fmt.Errorf("%w: role '%s' in workspace '%s'", ErrInsufficientRole, member.Role, workspaceID)
+	}
+	return member.Role, nil
+}
@@ -0,0 +1,173 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaz600/go-musthave-shortener/internal/entity"
+	"github.com/zaz600/go-musthave-shortener/internal/infrastructure/repository"
+)
+
+func TestService_Workspaces(t *testing.T) {
+	ctx := context.Background()
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, nil)))
+
+	_, err := s.CreateWorkspace(ctx, "owner", " ")
+	assert.ErrorIs(t, err, ErrInvalidWorkspace)
+	workspace, err := s.CreateWorkspace(ctx, "owner", " Marketing ")
+	require.NoError(t, err)
+	assert.Equal(t, "Marketing", workspace.Name)
+
+	_, err = s.SetWorkspaceMember(ctx, "owner", workspace.ID, "editor", "admin")
+	assert.ErrorIs(t, err, ErrInvalidWorkspace)
+	_, err = s.SetWorkspaceMember(ctx, "owner", workspace.ID, "editor", entity.RoleEditor)
+	require.NoError(t, err)
+	_, err = s.SetWorkspaceMember(ctx, "owner", workspace.ID, "viewer", entity.RoleViewer)
+	require.NoError(t, err)
+	_, err = s.SetWorkspaceMember(ctx, "editor", workspace.ID, "stranger", entity.RoleOwner)
+	assert.ErrorIs(t, err, ErrInsufficientRole, "only owners manage members")
+
+	memberships, err := s.UserWorkspaces(ctx, "viewer")
+	require.NoError(t, err)
+	require.Len(t, memberships, 1)
+	assert.Equal(t, entity.RoleViewer, memberships[0].Role)
+
+	members, err := s.WorkspaceMembers(ctx, "viewer", workspace.ID)
+	require.NoError(t, err)
+	assert.Len(t, members, 3)
+	_, err = s.WorkspaceMembers(ctx, "stranger", workspace.ID)
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+
+	e := s.NewLinkEntity("https://ya.ru/shared", "viewer")
+	assert.ErrorIs(t, s.SetWorkspace(ctx, &e, workspace.ID), ErrInsufficientRole)
+	e = s.NewLinkEntity("https://ya.ru/shared", "editor")
+	assert.ErrorIs(t, s.SetWorkspace(ctx, &e, "missing"), ErrInvalidWorkspace)
+	require.NoError(t, s.SetWorkspace(ctx, &e, workspace.ID))
+	shared, err := s.ShortenURL(ctx, e)
+	require.NoError(t, err)
+
+	// ссылку пространства видят все участники, изменяют редакторы и владельцы
+	links, _, err := s.GetUserLinks(ctx, "viewer", ListOptions{WorkspaceID: workspace.ID})
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, shared.ID, links[0].ID)
+	_, _, err = s.GetUserLinks(ctx, "stranger", ListOptions{WorkspaceID: workspace.ID})
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	personal, _, err := s.GetUserLinks(ctx, "editor", ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, personal, "workspace links are not listed as personal")
+
+	_, err = s.LinkRevisions(ctx, "viewer", shared.ID)
+	assert.NoError(t, err)
+	title := "Shared"
+	_, err = s.UpdateLink(ctx, "viewer", shared.ID, LinkUpdate{Title: &title})
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	updated, err := s.UpdateLink(ctx, "owner", shared.ID, LinkUpdate{Title: &title})
+	require.NoError(t, err)
+	assert.Equal(t, title, updated.Title)
+
+	s.RemoveLinks([]string{shared.ID}, "viewer")
+	s.RemoveLinks([]string{shared.ID}, "owner")
+	require.Eventually(t, func() bool {
+		stored, err := s.linksRepository.Get(ctx, shared.ID)
+		return err == nil && stored.Removed
+	}, time.Second, 10*time.Millisecond)
+
+	// последний владелец не может уйти или перестать быть владельцем
+	assert.ErrorIs(t, s.RemoveWorkspaceMember(ctx, "owner", workspace.ID, "owner"), ErrLastOwner)
+	_, err = s.SetWorkspaceMember(ctx, "owner", workspace.ID, "owner", entity.RoleEditor)
+	assert.ErrorIs(t, err, ErrLastOwner)
+	assert.ErrorIs(t, s.RemoveWorkspaceMember(ctx, "editor", workspace.ID, "viewer"), ErrInsufficientRole)
+	require.NoError(t, s.RemoveWorkspaceMember(ctx, "viewer", workspace.ID, "viewer"))
+	_, err = s.WorkspaceMembers(ctx, "viewer", workspace.ID)
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+}
+
+func TestService_RemoveLinksSkipsForeign(t *testing.T) {
+	ctx := context.Background()
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, nil)))
+
+	foreign, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/foreign", "user2"))
+	require.NoError(t, err)
+	own, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/own", "user1"))
+	require.NoError(t, err)
+
+	s.RemoveLinks([]string{foreign.ID, own.ID, "missing"}, "user1")
+	require.Eventually(t, func() bool {
+		stored, err := s.linksRepository.Get(ctx, own.ID)
+		return err == nil && stored.Removed
+	}, time.Second, 10*time.Millisecond)
+	stored, err := s.linksRepository.Get(ctx, foreign.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.Removed)
+}
+
+func TestService_RemoveLinksChecksCurrentRole(t *testing.T) {
+	ctx := context.Background()
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, nil)))
+
+	workspace, err := s.CreateWorkspace(ctx, "owner", "Marketing")
+	require.NoError(t, err)
+	_, err = s.SetWorkspaceMember(ctx, "owner", workspace.ID, "editor", entity.RoleEditor)
+	require.NoError(t, err)
+	e := s.NewLinkEntity("https://ya.ru/shared", "editor")
+	require.NoError(t, s.SetWorkspace(ctx, &e, workspace.ID))
+	shared, err := s.ShortenURL(ctx, e)
+	require.NoError(t, err)
+	own, err := s.ShortenURL(ctx, s.NewLinkEntity("https://ya.ru/own", "editor"))
+	require.NoError(t, err)
+
+	// права проверяются в момент удаления: исключенный редактор удаляет только личные ссылки
+	require.NoError(t, s.RemoveWorkspaceMember(ctx, "owner", workspace.ID, "editor"))
+	s.RemoveLinks([]string{shared.ID, own.ID}, "editor")
+	require.Eventually(t, func() bool {
+		stored, err := s.linksRepository.Get(ctx, own.ID)
+		return err == nil && stored.Removed
+	}, time.Second, 10*time.Millisecond)
+	stored, err := s.linksRepository.Get(ctx, shared.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.Removed)
+
+	// второй владелец может понизить первого, но не себя
+	_, err = s.SetWorkspaceMember(ctx, "owner", workspace.ID, "co-owner", entity.RoleOwner)
+	require.NoError(t, err)
+	_, err = s.SetWorkspaceMember(ctx, "co-owner", workspace.ID, "owner", entity.RoleViewer)
+	require.NoError(t, err)
+	_, err = s.SetWorkspaceMember(ctx, "co-owner", workspace.ID, "co-owner", entity.RoleViewer)
+	assert.ErrorIs(t, err, ErrLastOwner)
+}
+
+// fixedIDs выдает заданные идентификаторы по порядку, последний - сколько угодно раз
+type fixedIDs struct {
+	ids []string
+}
+
+func (g *fixedIDs) NewID() (string, error) {
+	id := g.ids[0]
+	if len(g.ids) > 1 {
+		g.ids = g.ids[1:]
+	}
+	return id, nil
+}
+
+func TestService_CreateWorkspaceIDCollision(t *testing.T) {
+	ctx := context.Background()
+	s := NewService("http://localhost:8080", WithRepository(repository.NewInMemoryLinksRepository(ctx, nil)))
+	s.recordIDGenerator = &fixedIDs{ids: []string{"taken", "taken", "free", "taken"}}
+
+	first, err := s.CreateWorkspace(ctx, "first", "First")
+	require.NoError(t, err)
+	assert.Equal(t, "taken", first.ID)
+	second, err := s.CreateWorkspace(ctx, "second", "Second")
+	require.NoError(t, err)
+	assert.Equal(t, "free", second.ID)
+
+	// занятый идентификатор не передает чужое пространство новому создателю
+	_, err = s.WorkspaceMembers(ctx, "second", first.ID)
+	assert.ErrorIs(t, err, ErrInsufficientRole)
+	_, err = s.CreateWorkspace(ctx, "third", "Third")
+	assert.ErrorIs(t, err, repository.ErrIDCollision)
+}